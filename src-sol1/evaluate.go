@@ -43,7 +43,9 @@ func InputTileRole(p *Problem, ops []int, tensorIdx int) string {
 	return "PW"
 }
 
-// ComputeWorkingSet returns peak fast memory for one step
+// ComputeWorkingSet returns peak fast memory for one step. A tensor retained
+// from the previous subgraph stays whole in fast memory, so it counts at full
+// size even when this subgraph reads it.
 func ComputeWorkingSet(p *Problem, ops []int, gran [3]int, retainedFromPrev map[int]bool) int64 {
 	w, h, k := gran[0], gran[1], gran[2]
 
@@ -51,9 +53,13 @@ func ComputeWorkingSet(p *Problem, ops []int, gran [3]int, retainedFromPrev map[
 
 	var ws int64
 
-	// Input tiles for boundary inputs
+	// Input tiles for boundary inputs; retained inputs are held whole
 	for tIdx := range boundary.BoundaryInputs {
-		ws += InputTileSize(p, ops, tIdx, w, h, k)
+		if retainedFromPrev[tIdx] {
+			ws += int64(p.Tensors[tIdx].Width) * int64(p.Tensors[tIdx].Height)
+		} else {
+			ws += InputTileSize(p, ops, tIdx, w, h, k)
+		}
 	}
 
 	// Output tiles for boundary outputs
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+// referenceResidentInputWorkingSet is what src's ComputeWorkingSet reports
+// for residentInputProblem: the resident input counts as one 32x32 tile.
+const referenceResidentInputWorkingSet = 32*32 + 32*32 + 64*64
+
+// residentInputProblem is the case src and src-sol2 also test: a pointwise
+// op reading tensor 0, with tensor 0 and the unrelated tensor 2 retained
+// from the previous subgraph.
+func residentInputProblem() (*Problem, []int, [3]int, map[int]bool) {
+	p := &Problem{
+		Tensors:            []Tensor{{Width: 128, Height: 128}, {Width: 128, Height: 128}, {Width: 64, Height: 64}},
+		Ops:                []Op{{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 10}},
+		FastMemoryCapacity: 1 << 20,
+		NativeGranularity:  [2]int{128, 128},
+	}
+	return p, []int{0}, [3]int{32, 32, 1}, map[int]bool{0: true, 2: true}
+}
+
+// TestComputeWorkingSetResidentInput checks that a resident input counts
+// whole, as in src-sol2, and never below the reference's tile-sized count.
+func TestComputeWorkingSetResidentInput(t *testing.T) {
+	p, ops, gran, resident := residentInputProblem()
+	got := ComputeWorkingSet(p, ops, gran, resident)
+	if want := int64(128*128 + 32*32 + 64*64); got != want {
+		t.Errorf("ComputeWorkingSet = %d, want %d", got, want)
+	}
+	if got < referenceResidentInputWorkingSet {
+		t.Errorf("ComputeWorkingSet = %d, below the reference's %d", got, referenceResidentInputWorkingSet)
+	}
+}
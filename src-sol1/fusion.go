@@ -20,6 +20,19 @@ type FusionContext struct {
 	TimeoutSec   int
 	MaxDepth     int
 	CurrentDepth int
+	// Rejected collects the fusions the chain fuser turned down
+	Rejected []RejectedFusion
+}
+
+// RejectedFusion is a chain the fuser did not fuse whole. Reason is
+// "capacity", with Value the working set and Threshold the capacity, or
+// "improvement", with Value the fused over unfused latency and Threshold
+// the ratio fusion had to beat.
+type RejectedFusion struct {
+	Ops       []int
+	Reason    string
+	Value     float64
+	Threshold float64
 }
 
 func NewFusionContext() *FusionContext {
@@ -40,6 +53,14 @@ func TryFuseChainSmart(p *Problem, chain []int, residentTensors map[int]bool) []
 	return tryFuseChainWithContext(p, chain, residentTensors, ctx)
 }
 
+// TryFuseChainSmartReport is TryFuseChainSmart that also returns the fusions
+// it rejected along the way
+func TryFuseChainSmartReport(p *Problem, chain []int, residentTensors map[int]bool) ([]SubgraphCandidate, []RejectedFusion) {
+	ctx := NewFusionContext()
+	subs := tryFuseChainWithContext(p, chain, residentTensors, ctx)
+	return subs, ctx.Rejected
+}
+
 func tryFuseChainWithContext(p *Problem, chain []int, residentTensors map[int]bool, ctx *FusionContext) []SubgraphCandidate {
 	if ctx.ShouldStop() {
 		// Timeout - fall back to no fusion
@@ -69,23 +90,24 @@ func tryFuseChainWithContext(p *Problem, chain []int, residentTensors map[int]bo
 	fullLat := EvaluateSubgraphSimple(p, chain, fullGran, nil, residentTensors)
 	fullWS := ComputeWorkingSet(p, chain, fullGran, residentTensors)
 
-	// Check if full fusion is reasonable
-	fusionReasonable := fullWS <= p.FastMemoryCapacity && IsGranularityReasonable(p, fullGran)
-
-	if !fusionReasonable {
-		// Full fusion forces unreasonable granularity - split it
+	if fullWS > p.FastMemoryCapacity {
+		// Full fusion does not fit - split it
+		ctx.Rejected = append(ctx.Rejected, RejectedFusion{chain, "capacity", float64(fullWS), float64(p.FastMemoryCapacity)})
 		return splitChainBinary(p, chain, residentTensors, ctx)
 	}
 
-	// Compare fused cost vs baseline (no fusion)
+	// Compare fused cost vs baseline (no fusion). Fusion that forces a
+	// sub-native tile pays for its padding in proportion.
 	baselineLat := estimateBaselineLatency(p, chain, residentTensors)
 
 	// If fusion is significantly better (>10% improvement), use it
-	if fullLat < baselineLat*0.90 {
+	paddedLat := PaddedLatency(p, chain, fullGran, fullLat)
+	if paddedLat < baselineLat*0.90 {
 		return []SubgraphCandidate{
 			{Ops: chain, Granularity: fullGran, Latency: fullLat, Feasible: true},
 		}
 	}
+	ctx.Rejected = append(ctx.Rejected, RejectedFusion{chain, "improvement", paddedLat / baselineLat, 0.90})
 
 	// Fusion not beneficial enough - try binary split
 	splitCandidates := splitChainBinary(p, chain, residentTensors, ctx)
@@ -217,17 +217,32 @@ func findSmallestFeasibleGranularity(p *Problem, ops []int, residentTensors map[
 	return [3]int{1, 1, 1}
 }
 
-// IsGranularityReasonable checks if a granularity is acceptable
-// Returns false if tiles are too small relative to native (too much padding overhead)
-func IsGranularityReasonable(p *Problem, gran [3]int) bool {
-	nw, nh := p.NativeGranularity[0], p.NativeGranularity[1]
-	w, h := gran[0], gran[1]
+// PaddingFactor is the native tile area over the tile area, rounded up: how
+// many steps' worth of compute a sub-native tile pays per step of useful
+// work. Tiles at least native in area have factor 1.
+func PaddingFactor(p *Problem, gran [3]int) int64 {
+	native := int64(p.NativeGranularity[0]) * int64(p.NativeGranularity[1])
+	area := int64(gran[0]) * int64(gran[1])
+	if area <= 0 || area >= native {
+		return 1
+	}
+	return (native + area - 1) / area
+}
 
-	// Don't allow tiles smaller than 1/4 of native in any dimension
-	// This avoids excessive padding overhead
-	if w < nw/4 || h < nh/4 {
-		return false
+// PaddedLatency adds the compute a sub-native tile wastes to lat, scaling
+// the subgraph's effective compute by its padding factor, so small tiles
+// are penalized in proportion to their padding
+func PaddedLatency(p *Problem, ops []int, gran [3]int, lat float64) float64 {
+	factor := PaddingFactor(p, gran)
+	if factor == 1 {
+		return lat
 	}
 
-	return true
+	var computePerStep int64
+	for _, opIdx := range ops {
+		computePerStep += p.Ops[opIdx].BaseCost
+	}
+	outT := p.Tensors[GetOutputTensor(p, ops)]
+	steps := CeilDiv(outT.Width, gran[0]) * CeilDiv(outT.Height, gran[1]) * CeilDiv(GetMaxK(p, ops), gran[2])
+	return lat + float64(computePerStep)*float64(steps)*float64(factor-1)
 }
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
 func main() {
+	workers := flag.Int("workers", runtime.NumCPU(), "number of benchmarks to solve concurrently")
+	flag.Parse()
+
 	benchmarkDir := "../benchmarks"
 	outputDir := "./solutions"
 
@@ -33,78 +39,9 @@ func main() {
 	fmt.Println("=" + strings.Repeat("=", 78))
 	fmt.Println("  MLSys 2026 DAG Optimization - Optimized Solver")
 	fmt.Println("=" + strings.Repeat("=", 78))
-	fmt.Printf("Found %d benchmark files\n\n", len(files))
-
-	results := make([]BenchmarkResult, 0, len(files))
-
-	for i, inputFile := range files {
-		baseName := filepath.Base(inputFile)
-		benchmarkName := strings.TrimSuffix(baseName, ".json")
-		outputFile := filepath.Join(outputDir, benchmarkName+"-solution.json")
-
-		fmt.Printf("[%d/%d] Processing: %s\n", i+1, len(files), baseName)
-		fmt.Println(strings.Repeat("-", 80))
-
-		startTime := time.Now()
-
-		// Read problem
-		problem, err := ReadProblem(inputFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Error reading problem: %v\n\n", err)
-			continue
-		}
+	fmt.Printf("Found %d benchmark files, using %d workers\n\n", len(files), *workers)
 
-		fmt.Printf("  Problem: %d tensors, %d ops, capacity=%d, bandwidth=%d\n",
-			len(problem.Tensors), len(problem.Ops),
-			problem.FastMemoryCapacity, problem.SlowMemoryBandwidth)
-
-		// Solve
-		solution := SolveOptimized(problem)
-
-		// Verify
-		totalLat, err := EvaluateSolution(problem, solution)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Solution validation error: %v\n", err)
-			// Try to recover
-			for i := range solution.Subgraphs {
-				sg := &solution.Subgraphs[i]
-				resident := make(map[int]bool)
-				if i > 0 {
-					for _, t := range solution.Subgraphs[i-1].TensorsToRetain {
-						resident[t] = true
-					}
-				}
-				lat, _ := EvaluateSubgraphDetailed(
-					problem, sg.Ops, sg.Granularity, sg.TensorsToRetain,
-					sg.TraversalOrder, resident,
-				)
-				sg.SubgraphLatency = lat
-			}
-			totalLat, _ = EvaluateSolution(problem, solution)
-		}
-
-		elapsed := time.Since(startTime)
-
-		// Write output
-		if err := WriteSolution(outputFile, solution); err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Error writing solution: %v\n\n", err)
-			continue
-		}
-
-		fmt.Printf("  ✓ Total Latency: %.1f\n", totalLat)
-		fmt.Printf("  ✓ Subgraphs: %d\n", len(solution.Subgraphs))
-		fmt.Printf("  ✓ Time: %v\n", elapsed)
-		fmt.Printf("  ✓ Output: %s\n", outputFile)
-
-		results = append(results, BenchmarkResult{
-			Name:      benchmarkName,
-			Latency:   totalLat,
-			Subgraphs: len(solution.Subgraphs),
-			Time:      elapsed,
-		})
-
-		fmt.Println()
-	}
+	results := runBenchmarks(files, outputDir, *workers)
 
 	// Print summary
 	fmt.Println("=" + strings.Repeat("=", 78))
@@ -129,3 +66,121 @@ type BenchmarkResult struct {
 	Subgraphs int
 	Time      time.Duration
 }
+
+// runBenchmarks solves files on up to workers goroutines. Each file writes its
+// own solution; results are collected over a channel and returned in the
+// order of files so the summary is deterministic.
+func runBenchmarks(files []string, outputDir string, workers int) []BenchmarkResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type indexedResult struct {
+		idx    int
+		result BenchmarkResult
+		ok     bool
+	}
+
+	jobs := make(chan int)
+	done := make(chan indexedResult, len(files))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result, ok := processBenchmark(files[i], outputDir, i, len(files))
+				done <- indexedResult{i, result, ok}
+			}
+		}()
+	}
+
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	close(done)
+
+	ordered := make([]*BenchmarkResult, len(files))
+	for r := range done {
+		if r.ok {
+			result := r.result
+			ordered[r.idx] = &result
+		}
+	}
+
+	results := make([]BenchmarkResult, 0, len(files))
+	for _, r := range ordered {
+		if r != nil {
+			results = append(results, *r)
+		}
+	}
+	return results
+}
+
+// processBenchmark solves one benchmark file and writes its solution
+func processBenchmark(inputFile, outputDir string, i, total int) (BenchmarkResult, bool) {
+	baseName := filepath.Base(inputFile)
+	benchmarkName := strings.TrimSuffix(baseName, ".json")
+	outputFile := filepath.Join(outputDir, benchmarkName+"-solution.json")
+
+	fmt.Printf("[%d/%d] Processing: %s\n", i+1, total, baseName)
+
+	startTime := time.Now()
+
+	// Read problem
+	problem, err := ReadProblem(inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  ✗ %s: error reading problem: %v\n\n", baseName, err)
+		return BenchmarkResult{}, false
+	}
+
+	fmt.Printf("  %s: %d tensors, %d ops, capacity=%d, bandwidth=%d\n",
+		benchmarkName, len(problem.Tensors), len(problem.Ops),
+		problem.FastMemoryCapacity, problem.SlowMemoryBandwidth)
+
+	// Solve
+	solution := SolveOptimized(problem)
+
+	// Verify
+	totalLat, err := EvaluateSolution(problem, solution)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  ✗ %s: solution validation error: %v\n", baseName, err)
+		// Try to recover
+		for i := range solution.Subgraphs {
+			sg := &solution.Subgraphs[i]
+			resident := make(map[int]bool)
+			if i > 0 {
+				for _, t := range solution.Subgraphs[i-1].TensorsToRetain {
+					resident[t] = true
+				}
+			}
+			lat, _ := EvaluateSubgraphDetailed(
+				problem, sg.Ops, sg.Granularity, sg.TensorsToRetain,
+				sg.TraversalOrder, resident,
+			)
+			sg.SubgraphLatency = lat
+		}
+		totalLat, _ = EvaluateSolution(problem, solution)
+	}
+
+	elapsed := time.Since(startTime)
+
+	// Write output
+	if err := WriteSolution(outputFile, solution); err != nil {
+		fmt.Fprintf(os.Stderr, "  ✗ %s: error writing solution: %v\n\n", baseName, err)
+		return BenchmarkResult{}, false
+	}
+
+	fmt.Printf("  ✓ %s: latency %.1f, %d subgraphs, %v -> %s\n\n",
+		benchmarkName, totalLat, len(solution.Subgraphs), elapsed, outputFile)
+
+	return BenchmarkResult{
+		Name:      benchmarkName,
+		Latency:   totalLat,
+		Subgraphs: len(solution.Subgraphs),
+		Time:      elapsed,
+	}, true
+}
@@ -1,7 +1,19 @@
 package main
 
+// CeilDiv returns ceil(a / b), rounding toward positive infinity for any
+// sign of a. A non-positive b, such as a zero granularity dimension from a
+// malformed input, gives 0 instead of panicking; callers that must reject
+// such input check it themselves.
+// Example: CeilDiv(512, 128) = 4, CeilDiv(513, 128) = 5, CeilDiv(0, 128) = 0
 func CeilDiv(a, b int) int {
-	return (a + b - 1) / b
+	if b <= 0 {
+		return 0
+	}
+	q := a / b
+	if a%b > 0 {
+		q++
+	}
+	return q
 }
 
 func MaxInt(a, b int) int {
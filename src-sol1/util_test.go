@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCeilDiv(t *testing.T) {
+	for _, tc := range []struct{ a, b, want int }{
+		{512, 128, 4},
+		{513, 128, 5},
+		{0, 5, 0},
+		{1, 1, 1},
+		// A non-positive divisor has no tiles
+		{7, 0, 0},
+		{7, -3, 0},
+		// Negative dividends round toward positive infinity
+		{-3, 2, -1},
+		{-4, 2, -2},
+		{-1, 4, 0},
+		// a+b-1 would overflow
+		{math.MaxInt - 1, math.MaxInt, 1},
+		{math.MaxInt, 2, math.MaxInt/2 + 1},
+	} {
+		if got := CeilDiv(tc.a, tc.b); got != tc.want {
+			t.Errorf("CeilDiv(%d, %d) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestMinMaxIntNegative(t *testing.T) {
+	if got := MaxInt(-1, -2); got != -1 {
+		t.Errorf("MaxInt(-1, -2) = %d, want -1", got)
+	}
+	if got := MinInt(-1, -2); got != -2 {
+		t.Errorf("MinInt(-1, -2) = %d, want -2", got)
+	}
+	if got := MaxInt64(-1, -2); got != -1 {
+		t.Errorf("MaxInt64(-1, -2) = %d, want -1", got)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Bound names the constraint that limits a subgraph's latency
+type Bound int
+
+const (
+	// ComputeBound subgraphs spend most of their latency in steps where
+	// compute outlasts memory traffic
+	ComputeBound Bound = iota
+	// LoadBound subgraphs are memory bound, mostly on loads
+	LoadBound
+	// StoreBound subgraphs are memory bound, mostly on stores
+	StoreBound
+	// CapacityBound subgraphs are memory bound with a working set so close
+	// to capacity that a larger tile, which would cut traffic, cannot fit
+	CapacityBound
+)
+
+// capacityBoundFraction is the share of fast memory a memory-bound
+// subgraph's working set must fill to count as capacity bound
+const capacityBoundFraction = 0.9
+
+func (b Bound) String() string {
+	switch b {
+	case ComputeBound:
+		return "compute"
+	case LoadBound:
+		return "load"
+	case StoreBound:
+		return "store"
+	case CapacityBound:
+		return "capacity"
+	}
+	return fmt.Sprintf("Bound(%d)", int(b))
+}
+
+// ClassifySubgraph reports which constraint binds sg under the given
+// residency, and the slack to the next one as a fraction. Under a capacity
+// schedule p is the subgraph's view, from atSubgraph.
+//   - compute: how much memory time could grow before it matches compute
+//   - load/store: how much memory time must shrink before compute binds
+//   - capacity: the share of fast memory still free
+func ClassifySubgraph(p *Problem, sg Subgraph, resident map[int]bool) (Bound, float64, error) {
+	bd, err := evaluateBreakdown(p, sg.Ops, sg.Granularity, sg.TensorsToRetain, sg.TraversalOrder, resident, ReuseSnake, sg.Dataflow)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if bd.ComputeBoundTime >= bd.MemoryBoundTime {
+		slack := 0.0
+		if bd.ComputeTime > 0 {
+			slack = (bd.ComputeTime - bd.MemoryTime) / bd.ComputeTime
+		}
+		return ComputeBound, math.Max(slack, 0), nil
+	}
+
+	ws := ComputeWorkingSetWithRetained(p, sg.Ops, sg.Granularity, resident, sg.TensorsToRetain)
+	capacity := float64(p.FastMemoryCapacity)
+	if float64(ws) >= capacityBoundFraction*capacity {
+		return CapacityBound, math.Max((capacity-float64(ws))/capacity, 0), nil
+	}
+
+	slack := 0.0
+	if bd.MemoryTime > 0 {
+		slack = (bd.MemoryTime - bd.ComputeTime) / bd.MemoryTime
+	}
+	slack = math.Max(slack, 0)
+	loadTime := float64(bd.LoadBytes) / float64(p.SlowMemoryBandwidth)
+	storeTime := float64(bd.StoreBytes) / StoreBandwidth(p)
+	if storeTime > loadTime {
+		return StoreBound, slack, nil
+	}
+	return LoadBound, slack, nil
+}
+
+// SubgraphBound is one entry of a BoundReport
+type SubgraphBound struct {
+	Subgraph int
+	Bound    Bound
+	Slack    float64
+	Latency  float64
+}
+
+// BoundReport classifies every subgraph of a solution and totals the
+// latency spent under each bound
+type BoundReport struct {
+	Subgraphs []SubgraphBound
+	Count     map[Bound]int
+	Latency   map[Bound]float64
+}
+
+// ClassifySolution classifies each subgraph of sol under the residency the
+// solution's retention produces
+func ClassifySolution(p *Problem, sol *Solution) (BoundReport, error) {
+	rep := BoundReport{Count: make(map[Bound]int), Latency: make(map[Bound]float64)}
+	resident := make(map[int]bool)
+
+	for i, sg := range sol.Subgraphs {
+		bound, slack, err := ClassifySubgraph(p.atSubgraph(i), sg, resident)
+		if err != nil {
+			return rep, fmt.Errorf("subgraph %d: %w", i, err)
+		}
+		lat, err := EvaluateSubgraphDataflow(p.atSubgraph(i), sg.Ops, sg.Granularity, sg.TensorsToRetain, sg.TraversalOrder, resident, sg.Dataflow)
+		if err != nil {
+			return rep, fmt.Errorf("subgraph %d: %w", i, err)
+		}
+		rep.Subgraphs = append(rep.Subgraphs, SubgraphBound{Subgraph: i, Bound: bound, Slack: slack, Latency: lat})
+		rep.Count[bound]++
+		rep.Latency[bound] += lat
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+	}
+
+	return rep, nil
+}
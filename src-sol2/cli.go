@@ -0,0 +1,577 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// runCommand dispatches CLI modes that operate on a single problem. args
+// are what follows the solver flags, which main has already applied to
+// Config. It returns false when args do not name a known mode, leaving main
+// to run the benchmark batch.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "diagnose":
+		err = runDiagnose(args[1:])
+	case "stats":
+		err = runStats(args[1:])
+	case "bounds":
+		err = runBounds(args[1:])
+	case "traffic":
+		err = runTraffic(args[1:])
+	case "verify":
+		err = runVerify(args[1:])
+	case "groups":
+		err = runGroups(args[1:])
+	case "generate":
+		err = runGenerate(args[1:])
+	case "pareto":
+		err = runPareto(args[1:])
+	case "capacity-curve":
+		err = runCapacityCurve(args[1:])
+	case "diff":
+		err = runDiff(args[1:])
+	case "granularities":
+		err = runGranularities(args[1:])
+	case "fusion-report":
+		err = runFusionReport(args[1:])
+	default:
+		return false
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// writeJSON writes v as indented JSON to filename, or stdout if filename is empty
+func writeJSON(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling JSON: %w", err)
+	}
+	if filename == "" {
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// SubgraphDiagnosis is one entry of the diagnose report
+type SubgraphDiagnosis struct {
+	Subgraph    int    `json:"subgraph"`
+	Ops         []int  `json:"ops"`
+	Granularity [3]int `json:"granularity"`
+	Dataflow    string `json:"dataflow"`
+	Breakdown
+}
+
+// DiagnoseSolution computes the latency breakdown of every subgraph under
+// the residency the solution's retention produces and the given reuse model
+func DiagnoseSolution(p *Problem, sol *Solution, reuse ReuseModel) ([]SubgraphDiagnosis, error) {
+	report := make([]SubgraphDiagnosis, 0, len(sol.Subgraphs))
+	resident := make(map[int]bool)
+
+	for i, sg := range sol.Subgraphs {
+		bd, err := evaluateBreakdown(p.atSubgraph(i), sg.Ops, sg.Granularity, sg.TensorsToRetain, sg.TraversalOrder, resident, reuse, sg.Dataflow)
+		if err != nil {
+			return nil, fmt.Errorf("subgraph %d: %w", i, err)
+		}
+		report = append(report, SubgraphDiagnosis{
+			Subgraph:    i,
+			Ops:         sg.Ops,
+			Granularity: sg.Granularity,
+			Dataflow:    sg.Dataflow.String(),
+			Breakdown:   bd,
+		})
+
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+	}
+
+	return report, nil
+}
+
+// runDiagnose implements:
+// diagnose [-reuse none|snake|lru] <problem.json> <solution.json> [out.json]
+func runDiagnose(args []string) error {
+	fs := flag.NewFlagSet("diagnose", flag.ContinueOnError)
+	reuseName := fs.String("reuse", ReuseSnake.String(), "tile reuse model: none (cold cache), snake or lru")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	reuse, err := ParseReuseModel(*reuseName)
+	if err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) < 2 {
+		return fmt.Errorf("usage: diagnose [-reuse none|snake|lru] <problem.json> <solution.json> [out.json]")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+	sol, err := ReadSolution(args[1])
+	if err != nil {
+		return err
+	}
+
+	report, err := DiagnoseSolution(p, sol, reuse)
+	if err != nil {
+		return err
+	}
+
+	out := ""
+	if len(args) > 2 {
+		out = args[2]
+	}
+	return writeJSON(out, report)
+}
+
+// runStats implements: stats <problem.json> [solution.json]
+// It prints the graph's size, total compute, critical path and latency lower
+// bound, and compares them with the solution's latency when one is given.
+func runStats(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: stats <problem.json> [solution.json]")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+	gi := AnalyzeGraph(p)
+
+	var totalCompute int64
+	for _, op := range p.Ops {
+		totalCompute += ComputeCost(op)
+	}
+	path, pathCost := ComputeCriticalPath(p, gi)
+	lowerBound := ComputeLowerBound(p)
+
+	fmt.Printf("Graph: %d ops, %d tensors, %d graph inputs, %d graph outputs\n",
+		len(p.Ops), len(p.Tensors), len(gi.GraphInputs), len(gi.GraphOutputs))
+	fmt.Printf("Total compute: %d\n", totalCompute)
+	fmt.Printf("Critical path: %d over %d ops %v\n", pathCost, len(path), path)
+	fmt.Printf("Lower bound: %.1f\n", lowerBound)
+	if err := ValidateMatMulShapes(p); err != nil {
+		fmt.Printf("WARNING: %v\n", err)
+	}
+
+	if len(args) < 2 {
+		return nil
+	}
+	sol, err := ReadSolution(args[1])
+	if err != nil {
+		return err
+	}
+	lat, err := EvaluateSolution(p, sol)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Solution latency: %.1f (%.2fx lower bound, %.2fx critical path)\n",
+		lat, lat/lowerBound, lat/float64(pathCost))
+	return nil
+}
+
+// runBounds implements: bounds <problem.json> <solution.json>
+// It prints the binding constraint and slack of each subgraph, then the
+// number of subgraphs and share of latency under each constraint.
+func runBounds(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: bounds <problem.json> <solution.json>")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+	sol, err := ReadSolution(args[1])
+	if err != nil {
+		return err
+	}
+
+	rep, err := ClassifySolution(p, sol)
+	if err != nil {
+		return err
+	}
+
+	total := 0.0
+	for _, sb := range rep.Subgraphs {
+		fmt.Printf("Subgraph %3d: %-8s slack %5.1f%%  latency %.1f\n",
+			sb.Subgraph, sb.Bound, 100*sb.Slack, sb.Latency)
+		total += sb.Latency
+	}
+	for _, b := range []Bound{ComputeBound, LoadBound, StoreBound, CapacityBound} {
+		share := 0.0
+		if total > 0 {
+			share = rep.Latency[b] / total
+		}
+		fmt.Printf("%-8s %3d subgraphs, %5.1f%% of latency\n", b, rep.Count[b], 100*share)
+	}
+	return nil
+}
+
+// ComputeTotalTraffic returns the bytes sol loads from and stores to slow
+// memory, walking it with the residency and tile reuse EvaluateSolution
+// uses. Zero-sized subgraphs move nothing, as they are not run.
+func ComputeTotalTraffic(p *Problem, sol *Solution) (loadBytes, storeBytes int64, err error) {
+	resident := make(map[int]bool)
+
+	for i, sg := range sol.Subgraphs {
+		if len(sg.Ops) > 0 && !isZeroSized(GetOutputShape(p, sg.Ops)) {
+			bd, err := evaluateBreakdown(p.atSubgraph(i), sg.Ops, sg.Granularity, sg.TensorsToRetain, sg.TraversalOrder, resident, ReuseSnake, sg.Dataflow)
+			if err != nil {
+				return 0, 0, fmt.Errorf("subgraph %d: %w", i, err)
+			}
+			loadBytes += bd.LoadBytes
+			storeBytes += bd.StoreBytes
+		}
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+	}
+
+	return loadBytes, storeBytes, nil
+}
+
+// runTraffic implements: traffic <problem.json> <solution.json>
+// It prints the bytes the solution moves to and from slow memory.
+func runTraffic(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: traffic <problem.json> <solution.json>")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+	sol, err := ReadSolution(args[1])
+	if err != nil {
+		return err
+	}
+
+	loadBytes, storeBytes, err := ComputeTotalTraffic(p, sol)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Loaded: %d bytes\n", loadBytes)
+	fmt.Printf("Stored: %d bytes\n", storeBytes)
+	fmt.Printf("Total:  %d bytes\n", loadBytes+storeBytes)
+	return nil
+}
+
+// runVerify validates a solution and checks every stored subgraph latency
+// against a fresh evaluation, failing if any disagrees
+func runVerify(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: verify <problem.json> <solution.json>")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+	sol, err := ReadSolution(args[1])
+	if err != nil {
+		return err
+	}
+
+	lat, err := EvaluateSolution(p, sol)
+	if err != nil {
+		return fmt.Errorf("invalid solution: %w", err)
+	}
+	fmt.Printf("Valid, %d subgraphs, latency %.1f\n", len(sol.Subgraphs), lat)
+
+	mismatches := VerifyLatencies(p, sol)
+	for _, m := range mismatches {
+		if m.Err != nil {
+			fmt.Printf("  subgraph %d: stored latency %.1f, evaluation failed: %v\n", m.Subgraph, m.Stored, m.Err)
+		} else {
+			fmt.Printf("  subgraph %d: stored latency %.1f, evaluated %.1f\n", m.Subgraph, m.Stored, m.Evaluated)
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d of %d stored subgraph latencies do not match", len(mismatches), len(sol.Subgraphs))
+	}
+	return nil
+}
+
+// GroupReport is one fused group of the groups report
+type GroupReport struct {
+	Ops              []int   `json:"ops"`
+	BoundaryInputs   []int   `json:"boundary_inputs"`
+	BoundaryOutputs  []int   `json:"boundary_outputs"`
+	EstimatedLatency float64 `json:"estimated_latency"`
+}
+
+// ReportGroups runs the solver's grouping decision alone: chain and
+// cross-chain fusion (phases 1-2), ordered as the schedule runs them, with
+// no granularity, retention or traversal optimization. Each group's latency
+// is TryFuseOps's estimate with nothing resident, or EstimateUnfusedLatency
+// if the group does not fit as one subgraph.
+func ReportGroups(p *Problem, gi *GraphInfo) []GroupReport {
+	defer cacheFusions(p)()
+
+	schedule := BuildSchedule(p, gi, formGroups(p, gi, nil))
+
+	report := make([]GroupReport, 0, len(schedule))
+	for _, entry := range schedule {
+		resident := make(map[int]bool)
+		feasible, _, lat := TryFuseOps(p, entry.Ops, resident)
+		if !feasible {
+			lat = EstimateUnfusedLatency(p, entry.Ops, resident)
+		}
+		boundary := GetSubgraphBoundary(p, entry.Ops)
+		report = append(report, GroupReport{
+			Ops:              entry.Ops,
+			BoundaryInputs:   sortedKeys(boundary.BoundaryInputs),
+			BoundaryOutputs:  sortedKeys(boundary.BoundaryOutputs),
+			EstimatedLatency: lat,
+		})
+	}
+	return report
+}
+
+// runGroups implements: groups <problem.json> [out.json]
+// Solver progress goes to stderr, so stdout holds only the JSON report.
+func runGroups(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: groups <problem.json> [out.json]")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+
+	progress = os.Stderr
+	report := ReportGroups(p, AnalyzeGraph(p))
+
+	out := ""
+	if len(args) > 1 {
+		out = args[1]
+	}
+	return writeJSON(out, report)
+}
+
+// runGenerate implements:
+// generate [-pattern chain|transformer|random] [-n N] [-dim D] ... <out.json>
+// It writes a synthetic problem for scaling experiments.
+func runGenerate(args []string) error {
+	def := DefaultSyntheticConfig()
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	patternName := fs.String("pattern", def.Pattern.String(), "graph shape: chain, transformer or random")
+	size := fs.Int("n", def.Size, "chain length, transformer blocks, or random DAG ops")
+	dim := fs.Int("dim", def.Dim, "chain tensor side and transformer hidden size")
+	seqLen := fs.Int("seq", def.SeqLen, "transformer sequence length")
+	fanOut := fs.Int("fanout", def.FanOut, "most ops of a random DAG reading one tensor")
+	sizeList := fs.String("sizes", "128,256,512", "comma-separated tensor sides a random DAG draws from")
+	native := fs.Int("native", def.NativeGranularity[0], "native granularity, used for width and height")
+	capacity := fs.Int64("capacity", def.FastMemoryCapacity, "fast memory capacity")
+	bandwidth := fs.Int64("bandwidth", def.SlowMemoryBandwidth, "slow memory bandwidth")
+	seed := fs.Int64("seed", Config.Seed, "seed for random DAGs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) < 1 {
+		return fmt.Errorf("usage: generate [-pattern chain|transformer|random] [-n N] [-dim D] [-seq S] [-fanout F] [-sizes a,b,...] [-native G] [-capacity C] [-bandwidth B] [-seed S] <out.json>")
+	}
+
+	cfg := def
+	pattern, err := ParseSyntheticPattern(*patternName)
+	if err != nil {
+		return err
+	}
+	cfg.Pattern = pattern
+	cfg.Size, cfg.Dim, cfg.SeqLen, cfg.FanOut = *size, *dim, *seqLen, *fanOut
+	cfg.NativeGranularity = [2]int{*native, *native}
+	cfg.FastMemoryCapacity, cfg.SlowMemoryBandwidth = *capacity, *bandwidth
+	Config.Seed = *seed
+	if cfg.Sizes, err = parseIntList(*sizeList); err != nil {
+		return fmt.Errorf("parsing -sizes: %w", err)
+	}
+
+	p, err := GenerateSyntheticProblem(cfg)
+	if err != nil {
+		return err
+	}
+	if err := WriteProblem(args[0], p); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s problem: %d ops, %d tensors -> %s\n", cfg.Pattern, len(p.Ops), len(p.Tensors), args[0])
+	return nil
+}
+
+// runPareto implements:
+// pareto [-caps N] [-min-fraction F] <problem.json> [outdir]
+// It prints the latency / peak memory front and, given outdir, writes each
+// point's solution there as pareto-<i>.json.
+func runPareto(args []string) error {
+	def := DefaultParetoConfig()
+	fs := flag.NewFlagSet("pareto", flag.ContinueOnError)
+	caps := fs.Int("caps", def.Caps, "number of capacity caps to solve under")
+	minFraction := fs.Float64("min-fraction", def.MinFraction, "smallest cap as a fraction of the problem's capacity")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) < 1 {
+		return fmt.Errorf("usage: pareto [-caps N] [-min-fraction F] <problem.json> [outdir]")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+	gi := AnalyzeGraph(p)
+	front := SolvePareto(p, gi, ParetoConfig{Caps: *caps, MinFraction: *minFraction})
+
+	fmt.Printf("%-4s %12s %15s %12s\n", "#", "Capacity", "Latency", "Peak")
+	for i, pt := range front {
+		fmt.Printf("%-4d %12d %15.1f %12d\n", i, pt.Capacity, pt.Latency, pt.PeakWorkingSet)
+		if len(args) > 1 {
+			CanonicalizeOpOrder(p, gi, pt.Solution)
+			if err := WriteSolution(filepath.Join(args[1], fmt.Sprintf("pareto-%d.json", i)), p, pt.Solution); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runCapacityCurve implements:
+// capacity-curve [-workers N] [-fast] <problem.json> <capacity,capacity,...>
+// It prints the latency, subgraph count and slow memory traffic of the best
+// schedule found at each capacity.
+func runCapacityCurve(args []string) error {
+	fs := flag.NewFlagSet("capacity-curve", flag.ContinueOnError)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of capacities to solve concurrently")
+	fast := fs.Bool("fast", false, "solve each capacity with the quick approximate solver")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) < 2 {
+		return fmt.Errorf("usage: capacity-curve [-workers N] [-fast] <problem.json> <capacity,capacity,...>")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+	values, err := parseIntList(args[1])
+	if err != nil {
+		return fmt.Errorf("parsing capacities: %w", err)
+	}
+	capacities := make([]int64, len(values))
+	for i, v := range values {
+		capacities[i] = int64(v)
+	}
+	curve := CapacityLatencyCurve(p, CurveConfig{Workers: *workers, Fast: *fast}, capacities)
+
+	fmt.Printf("%12s %15s %10s %14s %12s\n", "Capacity", "Latency", "Subgraphs", "Traffic", "SolvedAt")
+	for _, pt := range curve {
+		fmt.Printf("%12d %15.1f %10d %14d %12d\n", pt.Capacity, pt.Latency, pt.Subgraphs, pt.Traffic, pt.SolvedAt)
+	}
+	return nil
+}
+
+// runDiff implements: diff <a.json> <b.json>
+// It prints how solution b groups, sizes and retains differently from a.
+func runDiff(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: diff <a.json> <b.json>")
+	}
+
+	a, err := ReadSolution(args[0])
+	if err != nil {
+		return err
+	}
+	b, err := ReadSolution(args[1])
+	if err != nil {
+		return err
+	}
+	printSolutionDiff(DiffSolutions(a, b), a, b)
+	return nil
+}
+
+// parseIntList parses a comma-separated list of integers
+func parseIntList(s string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// runGranularities implements: granularities <problem.json> <op,op,...>
+// It prints every granularity the search considers for the ops as one
+// subgraph with nothing resident, best ranked first.
+func runGranularities(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: granularities <problem.json> <op,op,...>")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+	ops, err := parseIntList(args[1])
+	if err != nil {
+		return fmt.Errorf("parsing ops: %w", err)
+	}
+	for _, opIdx := range ops {
+		if opIdx < 0 || opIdx >= len(p.Ops) {
+			return fmt.Errorf("op %d out of range", opIdx)
+		}
+	}
+	ops = sortOpsTopologically(AnalyzeGraph(p), ops)
+
+	fmt.Printf("%-20s %8s %12s %15s %15s\n", "Granularity", "Feasible", "WorkingSet", "Estimate", "Detailed")
+	for _, c := range EnumerateFeasibleGranularities(p, ops, make(map[int]bool)) {
+		fmt.Printf("%-20s %8v %12d %15.1f %15.1f\n",
+			fmt.Sprint([3]int{c.W, c.H, c.K}), c.Feasible, c.WorkSet, c.Estimate, c.Detailed)
+	}
+	return nil
+}
+
+// runFusionReport implements: fusion-report <problem.json> [out.json]
+// It prints the pairs of groups cross-chain fusion rejected and why, or
+// writes them as JSON to out.json.
+func runFusionReport(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: fusion-report <problem.json> [out.json]")
+	}
+
+	p, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+
+	progress = os.Stderr
+	rejected := ReportRejectedFusions(p, AnalyzeGraph(p))
+
+	if len(args) > 1 {
+		return writeJSON(args[1], rejected)
+	}
+	printRejectedFusions(rejected)
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/hex"
+	"math"
+	"math/rand"
+)
+
+// SolverConfig holds solver options that are not part of the problem itself
+type SolverConfig struct {
+	// StrictNoPadding restricts granularities to exact divisors of the
+	// output width, height and reduction depth, so no tile is padded
+	StrictNoPadding bool
+
+	// PerSubgraphOverhead is a fixed launch cost, in latency units, charged
+	// for every subgraph. Nonzero values steer fusion toward fewer subgraphs.
+	PerSubgraphOverhead float64
+
+	// ContextSwitchCost is charged between consecutive subgraphs, for
+	// targets that drain their pipeline when fast memory is flushed
+	ContextSwitchCost float64
+
+	// CheckCosts reports ops whose BaseCost is out of line with their shape
+	// before solving; FixCosts also replaces those costs with the expected
+	// value. CostTolerance is the allowed ratio either way.
+	CheckCosts    bool
+	FixCosts      bool
+	CostTolerance float64
+
+	// CheckEstimates compares QuickEstimate with the detailed evaluator on
+	// every final subgraph and warns when the relative error exceeds
+	// EstimateTolerance
+	CheckEstimates    bool
+	EstimateTolerance float64
+
+	// Seed drives every randomized heuristic through NewRand
+	Seed int64
+
+	// CheckInvariants makes the evaluator reject subgraphs whose ops are
+	// not in topological order instead of silently costing them
+	CheckInvariants bool
+
+	// PaddingPenalty weighs the compute a sub-native tile wastes when
+	// ranking granularities: 0 ranks by latency alone, 1 charges the waste
+	// in full on top of it. The evaluator already charges every padded step
+	// at native cost, so this is a bias, off by default.
+	PaddingPenalty float64
+
+	// SpatialParts, when above 1, splits every solved subgraph into that
+	// many subgraphs over contiguous tile ranges, for multi-core targets
+	SpatialParts int
+
+	// AllowShapeMismatch loads problems that fail ValidateMatMulShapes with
+	// a warning, solving them as the evaluator reads them, instead of
+	// rejecting them
+	AllowShapeMismatch bool
+
+	// CostModel prices evaluator steps; nil means RooflineCostModel
+	CostModel CostModel
+
+	// ComputeModel picks how RooflineCostModel prices compute. Under
+	// ComputeFLOPs, OpEfficiency gives the FLOPs per unit of latency each
+	// op type sustains; types it does not list sustain 1.
+	ComputeModel ComputeModel
+	OpEfficiency map[string]float64
+
+	// RetainCompressed holds retained tensors that have a compression
+	// ratio compressed between subgraphs: they take less fast memory, and
+	// every tile read from them pays their decompress cost
+	RetainCompressed bool
+
+	// Fast solves with SolveFast instead of SolveOptimized
+	Fast bool
+
+	// SkipExisting reuses a benchmark's solution file instead of solving
+	// again when the file is newer than the problem
+	SkipExisting bool
+
+	// LatencyDecimals rounds the subgraph latencies WriteSolution stores,
+	// and those EvaluateSolution totals, to this many decimals, so runs
+	// differing only in floating-point noise write identical files.
+	// Negative keeps full precision.
+	LatencyDecimals int
+
+	// MinTileArea is the fewest output elements a tile chosen by the
+	// fallback search, recovery or the baseline schedule may cover. Rather
+	// than shrink below it toward [1,1,1], they report the problem as
+	// infeasible. Outputs smaller than it may be tiled whole; 0 disables it.
+	MinTileArea int
+
+	// ReusedInputMinUses, when positive, keeps every graph input that at
+	// least this many subgraphs read resident from its first read to its
+	// last, reserving the room before tiles are sized
+	ReusedInputMinUses int
+
+	// HeavyOpRatio is the ratio of base cost to native-step slow memory
+	// time above which an op counts as heavy. Cross-chain fusion leaves
+	// heavy ops unfused, as they gain little from saved traffic.
+	HeavyOpRatio float64
+
+	// RefineCandidates is how many of the best-ranked granularities the
+	// search evaluates in detail. With RefineSpread above 0 it adapts:
+	// every candidate within RefineSpread, as a fraction, of the leader's
+	// latency is refined, from a quarter to four times RefineCandidates,
+	// so a close field gets more refinement and a clear winner less.
+	RefineCandidates int
+	RefineSpread     float64
+
+	// InputStationary lets MatMul subgraphs run input-stationary where that
+	// is cheaper. Solutions record it under "dataflows", which evaluators
+	// that do not know the key ignore, scoring such subgraphs
+	// output-stationary, so it is off by default.
+	InputStationary bool
+}
+
+// DefaultSolverConfig returns the options the solver uses unless told otherwise
+func DefaultSolverConfig() SolverConfig {
+	return SolverConfig{
+		CostTolerance:     4.0,
+		EstimateTolerance: 0.25,
+		Seed:              1,
+		LatencyDecimals:   -1,
+		HeavyOpRatio:      2,
+		RefineCandidates:  20,
+	}
+}
+
+// roundLatency rounds lat to Config.LatencyDecimals decimals, if set
+func roundLatency(lat float64) float64 {
+	if Config.LatencyDecimals < 0 || math.IsInf(lat, 0) || math.IsNaN(lat) {
+		return lat
+	}
+	scale := math.Pow(10, float64(Config.LatencyDecimals))
+	return math.Round(lat*scale) / scale
+}
+
+// perSubgraphCost is the fixed latency fusion saves by removing one
+// subgraph: its launch overhead and one context switch
+func perSubgraphCost() float64 {
+	return Config.PerSubgraphOverhead + Config.ContextSwitchCost
+}
+
+// Config is the active solver configuration. It is set from flags before
+// any benchmark is solved and only read afterwards.
+var Config = DefaultSolverConfig()
+
+// NewRand returns the random source a randomized heuristic must use while
+// solving p. It is seeded from Config.Seed and the problem's hash, so each
+// benchmark gets its own reproducible stream however many are solved
+// concurrently. Heuristics must not use the global math/rand functions.
+func NewRand(p *Problem) *rand.Rand {
+	seed := Config.Seed
+	if digest, err := hex.DecodeString(HashProblem(p)); err == nil {
+		for i := 0; i < 8 && i < len(digest); i++ {
+			seed ^= int64(digest[i]) << (8 * i)
+		}
+	}
+	return rand.New(rand.NewSource(seed))
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+// TestNewRandSeed checks random DAGs follow Config.Seed: equal seeds give
+// the same problem and different seeds different ones.
+func TestNewRandSeed(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+
+	cfg := DefaultSyntheticConfig()
+	cfg.Pattern, cfg.Size = SyntheticRandom, 20
+	generate := func(seed int64) string {
+		Config.Seed = seed
+		p, err := GenerateSyntheticProblem(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return HashProblem(p)
+	}
+
+	for _, tc := range []struct {
+		a, b int64
+		same bool
+	}{
+		{1, 1, true},
+		{42, 42, true},
+		{1, 2, false},
+		{1, 42, false},
+	} {
+		if got := generate(tc.a) == generate(tc.b); got != tc.same {
+			t.Errorf("seeds %d and %d: same problem %v, want %v", tc.a, tc.b, got, tc.same)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CostModel prices the steps the evaluator walks. Each step's latency is
+// StepCombine of its compute time and the time to load and store the bytes
+// it moves; a subgraph's latency is the sum over its steps. Set
+// Config.CostModel to evaluate against a different accelerator.
+type CostModel interface {
+	// ComputePerStep is the compute time of one step of ops at gran
+	ComputePerStep(p *Problem, ops []int, gran [3]int) float64
+	// LoadTime is the time to bring bytes in from slow memory
+	LoadTime(p *Problem, bytes int64) float64
+	// StoreTime is the time to evict bytes to slow memory
+	StoreTime(p *Problem, bytes int64) float64
+	// StepCombine merges a step's compute and memory time into its latency
+	StepCombine(compute, memory float64) float64
+}
+
+// ComputeModel is how RooflineCostModel prices the compute of a step
+type ComputeModel int
+
+const (
+	// ComputeBaseCost charges each op its BaseCost per step whatever the
+	// tile size, as the problem statement does
+	ComputeBaseCost ComputeModel = iota
+	// ComputeFLOPs charges each op the arithmetic of its tile, padded up to
+	// whole native tiles: 2*w*h*k for a MatMul, w*h for a pointwise op and
+	// nothing for a Transpose, divided by the op type's efficiency
+	ComputeFLOPs
+)
+
+// String returns the flag spelling of the compute model
+func (c ComputeModel) String() string {
+	switch c {
+	case ComputeBaseCost:
+		return "basecost"
+	case ComputeFLOPs:
+		return "flops"
+	}
+	return fmt.Sprintf("ComputeModel(%d)", int(c))
+}
+
+// ParseComputeModel parses the flag spelling of a compute model
+func ParseComputeModel(s string) (ComputeModel, error) {
+	for _, c := range []ComputeModel{ComputeBaseCost, ComputeFLOPs} {
+		if s == c.String() {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown compute model %q (want basecost or flops)", s)
+}
+
+// ParseOpEfficiency parses a comma-separated list of OpType=rate pairs, such
+// as "MatMul=8192,Pointwise=64", into Config.OpEfficiency's form
+func ParseOpEfficiency(s string) (map[string]float64, error) {
+	eff := make(map[string]float64)
+	if strings.TrimSpace(s) == "" {
+		return eff, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		opType, rate, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("op efficiency %q is not OpType=rate", pair)
+		}
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil || r <= 0 {
+			return nil, fmt.Errorf("op efficiency of %s must be a positive number, got %q", opType, rate)
+		}
+		eff[opType] = r
+	}
+	return eff, nil
+}
+
+// opFLOPs is the arithmetic op performs on one w x h x k step, with the
+// tile padded to whole native tiles and k capped at the op's own K
+func opFLOPs(p *Problem, op Op, w, h, k int) float64 {
+	nw, nh := p.NativeGranularity[0], p.NativeGranularity[1]
+	if nw > 0 && nh > 0 {
+		w, h = CeilDiv(w, nw)*nw, CeilDiv(h, nh)*nh
+	}
+	switch op.OpType {
+	case "Transpose":
+		return 0
+	case "MatMul":
+		k = MinInt(k, p.Tensors[op.Inputs[0]].Width)
+		return 2 * float64(w) * float64(h) * float64(k)
+	}
+	return float64(w) * float64(h)
+}
+
+// opEfficiency is the FLOPs per unit of latency ops of opType sustain under
+// ComputeFLOPs: Config.OpEfficiency's rate, or 1 when it has none
+func opEfficiency(opType string) float64 {
+	if eff, ok := Config.OpEfficiency[opType]; ok && eff > 0 {
+		return eff
+	}
+	return 1
+}
+
+// RooflineCostModel is the problem statement's model: each op costs its
+// base cost per step whatever the tile size, or its FLOPs under
+// ComputeFLOPs, transfers run at the problem's bandwidths, and compute and
+// memory overlap so the slower one decides
+type RooflineCostModel struct {
+	Compute ComputeModel
+}
+
+func (m RooflineCostModel) ComputePerStep(p *Problem, ops []int, gran [3]int) float64 {
+	if m.Compute == ComputeFLOPs {
+		var cost float64
+		for _, opIdx := range ops {
+			op := p.Ops[opIdx]
+			cost += opFLOPs(p, op, gran[0], gran[1], gran[2]) / opEfficiency(op.OpType)
+		}
+		return cost
+	}
+
+	var cost int64
+	for _, opIdx := range ops {
+		cost += ComputeCost(p.Ops[opIdx])
+	}
+	return float64(cost)
+}
+
+func (RooflineCostModel) LoadTime(p *Problem, bytes int64) float64 {
+	return float64(bytes) / float64(p.SlowMemoryBandwidth)
+}
+
+func (RooflineCostModel) StoreTime(p *Problem, bytes int64) float64 {
+	return float64(bytes) / StoreBandwidth(p)
+}
+
+func (RooflineCostModel) StepCombine(compute, memory float64) float64 {
+	return MaxFloat(compute, memory)
+}
+
+// activeCostModel returns Config.CostModel, or the roofline model with
+// Config.ComputeModel if unset
+func activeCostModel() CostModel {
+	if Config.CostModel != nil {
+		return Config.CostModel
+	}
+	return RooflineCostModel{Compute: Config.ComputeModel}
+}
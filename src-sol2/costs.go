@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CostAnomaly is an op whose BaseCost deviates from the cost its shape implies
+type CostAnomaly struct {
+	Op       int
+	OpType   string
+	BaseCost int64
+	Expected int64
+	// Ratio is BaseCost / Expected
+	Ratio float64
+}
+
+// expectedWork is the arithmetic one native tile of op performs, up to a
+// per-op-type constant: a MatMul does a K-deep dot product per element, a
+// pointwise op a fixed amount per element
+func expectedWork(p *Problem, op Op) float64 {
+	if op.OpType == "Transpose" {
+		// Free by definition; nothing to compare against
+		return 0
+	}
+	work := float64(p.NativeGranularity[0]) * float64(p.NativeGranularity[1])
+	if op.OpType == "MatMul" && len(op.Inputs) > 0 {
+		work *= float64(p.Tensors[op.Inputs[0]].Width)
+	}
+	return work
+}
+
+// NormalizeCosts compares each op's BaseCost with its expected work, scaled
+// by the median cost-per-work of ops of the same type, and returns the ops
+// off by more than a factor of tolerance in either direction. With replace
+// set, anomalous BaseCosts are overwritten with the expected cost. An op
+// type needs at least two ops before any of them can be judged.
+func NormalizeCosts(p *Problem, tolerance float64, replace bool) []CostAnomaly {
+	byType := make(map[string][]int)
+	for opIdx, op := range p.Ops {
+		if expectedWork(p, op) > 0 {
+			byType[op.OpType] = append(byType[op.OpType], opIdx)
+		}
+	}
+
+	types := make([]string, 0, len(byType))
+	for opType := range byType {
+		types = append(types, opType)
+	}
+	sort.Strings(types)
+
+	var anomalies []CostAnomaly
+	for _, opType := range types {
+		opIdxs := byType[opType]
+		if len(opIdxs) < 2 {
+			continue
+		}
+
+		rates := make([]float64, len(opIdxs))
+		for i, opIdx := range opIdxs {
+			rates[i] = float64(p.Ops[opIdx].BaseCost) / expectedWork(p, p.Ops[opIdx])
+		}
+		sorted := append([]float64{}, rates...)
+		sort.Float64s(sorted)
+		median := sorted[len(sorted)/2]
+		if len(sorted)%2 == 0 {
+			median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+		}
+		if median <= 0 {
+			continue
+		}
+
+		for i, opIdx := range opIdxs {
+			ratio := rates[i] / median
+			if ratio <= tolerance && ratio >= 1/tolerance {
+				continue
+			}
+			expected := int64(math.Round(median * expectedWork(p, p.Ops[opIdx])))
+			anomalies = append(anomalies, CostAnomaly{
+				Op:       opIdx,
+				OpType:   opType,
+				BaseCost: p.Ops[opIdx].BaseCost,
+				Expected: expected,
+				Ratio:    ratio,
+			})
+		}
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].Op < anomalies[j].Op
+	})
+	if replace {
+		for _, a := range anomalies {
+			p.Ops[a.Op].BaseCost = a.Expected
+		}
+	}
+	return anomalies
+}
+
+// reportCostAnomalies prints one warning per anomalous op
+func reportCostAnomalies(anomalies []CostAnomaly, replaced bool) {
+	for _, a := range anomalies {
+		action := ""
+		if replaced {
+			action = ", replaced"
+		}
+		fmt.Fprintf(progress, "  WARNING: op %d (%s) BaseCost %d is %.2fx the expected %d%s\n",
+			a.Op, a.OpType, a.BaseCost, a.Ratio, a.Expected, action)
+	}
+}
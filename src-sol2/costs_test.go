@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// costProblem has one independent 64x64-output MatMul per entry of ks, with
+// reduction depth ks[i] and BaseCost costs[i], then a single pointwise op
+// on the first MatMul's output with cost pointwise
+func costProblem(ks []int, costs []int64, pointwise int64) *Problem {
+	p := &Problem{
+		FastMemoryCapacity:  1 << 20,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{64, 64},
+	}
+	for i, k := range ks {
+		t := len(p.Tensors)
+		p.Tensors = append(p.Tensors, Tensor{Width: k, Height: 64}, Tensor{Width: 64, Height: k}, Tensor{Width: 64, Height: 64})
+		p.Ops = append(p.Ops, Op{OpType: "MatMul", Inputs: []int{t, t + 1}, Outputs: []int{t + 2}, BaseCost: costs[i]})
+	}
+	p.Tensors = append(p.Tensors, Tensor{Width: 64, Height: 64})
+	p.Ops = append(p.Ops, Op{OpType: "Pointwise", Inputs: []int{2}, Outputs: []int{len(p.Tensors) - 1}, BaseCost: pointwise})
+	return p
+}
+
+func TestNormalizeCosts(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		ks      []int
+		costs   []int64
+		replace bool
+		want    []int // flagged ops
+		fixed   []int64
+	}{
+		{"consistent", []int{64, 64, 64}, []int64{1000, 1000, 1000}, false, nil, nil},
+		// Twice the depth, twice the cost
+		{"scales with K", []int{64, 128, 256}, []int64{1000, 2000, 4000}, false, nil, nil},
+		{"wrong cost", []int{64, 64, 64}, []int64{1000, 100000, 1000}, false, []int{1}, nil},
+		{"tiny K", []int{64, 64, 1}, []int64{1000, 1000, 1000}, false, []int{2}, nil},
+		{"within tolerance", []int{64, 64, 64}, []int64{1000, 3000, 1000}, false, nil, nil},
+		{"replaced", []int{64, 64, 64}, []int64{1000, 100000, 1000}, true, []int{1}, []int64{1000, 1000, 1000}},
+	} {
+		// The lone pointwise op has nothing to be compared with
+		p := costProblem(tc.ks, tc.costs, 1e9)
+		anomalies := NormalizeCosts(p, 4, tc.replace)
+
+		var flagged []int
+		for _, a := range anomalies {
+			flagged = append(flagged, a.Op)
+		}
+		if !reflect.DeepEqual(flagged, tc.want) {
+			t.Errorf("%s: flagged %v, want %v", tc.name, flagged, tc.want)
+		}
+
+		want := tc.fixed
+		if want == nil {
+			want = tc.costs
+		}
+		for i, c := range want {
+			if p.Ops[i].BaseCost != c {
+				t.Errorf("%s: op %d BaseCost %d, want %d", tc.name, i, p.Ops[i].BaseCost, c)
+			}
+		}
+	}
+}
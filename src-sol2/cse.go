@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CSEResult is a problem rewritten by CommonSubexpressionElimination.
+// Tensor indices are unchanged; outputs of removed ops are left unused.
+type CSEResult struct {
+	Problem *Problem
+	// OpMap maps each op of Problem to its index in the original problem
+	OpMap []int
+	// Removed maps each eliminated original op to the original op it duplicated
+	Removed map[int]int
+}
+
+// CommonSubexpressionElimination merges ops that have the same type, cost,
+// inputs and output shapes, so they would compute identical tensors.
+// Consumers of a duplicate are rewritten to read the surviving op's outputs.
+// Ops whose outputs are graph outputs, declared or unread, are kept, since
+// those tensors must still be written, and so are unfusable ops. Ops are
+// visited in topological order, so duplicates that only become visible
+// after their inputs are merged are found too.
+func CommonSubexpressionElimination(p *Problem, gi *GraphInfo) *CSEResult {
+	alias := make(map[int]int)
+	canonical := func(tIdx int) int {
+		if a, ok := alias[tIdx]; ok {
+			return a
+		}
+		return tIdx
+	}
+
+	seen := make(map[string]int)
+	removed := make(map[int]int)
+
+	for _, opIdx := range gi.TopoOrder {
+		op := p.Ops[opIdx]
+		// An unfusable op may have effects beyond its outputs
+		if containsInt(p.Unfusable, opIdx) {
+			continue
+		}
+
+		var key strings.Builder
+		fmt.Fprintf(&key, "%s|%d|in", op.OpType, op.BaseCost)
+		for _, tIdx := range op.Inputs {
+			fmt.Fprintf(&key, ",%d", canonical(tIdx))
+		}
+		key.WriteString("|out")
+		for _, tIdx := range op.Outputs {
+			fmt.Fprintf(&key, ",%dx%d", p.Tensors[tIdx].Width, p.Tensors[tIdx].Height)
+		}
+
+		keep, dup := seen[key.String()]
+		if !dup {
+			seen[key.String()] = opIdx
+			continue
+		}
+
+		writesOutput := false
+		for _, tIdx := range op.Outputs {
+			if isGraphOutput(p, tIdx) {
+				writesOutput = true
+			}
+		}
+		if writesOutput {
+			continue
+		}
+
+		removed[opIdx] = keep
+		for i, tIdx := range op.Outputs {
+			alias[tIdx] = canonical(p.Ops[keep].Outputs[i])
+		}
+	}
+
+	res := &CSEResult{
+		Problem: &Problem{
+			Tensors:             p.Tensors,
+			FastMemoryCapacity:  p.FastMemoryCapacity,
+			SlowMemoryBandwidth: p.SlowMemoryBandwidth,
+			NativeGranularity:   p.NativeGranularity,
+			StoreBandwidth:      p.StoreBandwidth,
+			PinnedTensors:       p.PinnedTensors,
+			MaxSubgraphOps:      p.MaxSubgraphOps,
+			OutputTensors:       p.OutputTensors,
+			Alignment:           p.Alignment,
+			CapacitySchedule:    p.CapacitySchedule,
+		},
+		Removed: removed,
+	}
+	for opIdx, op := range p.Ops {
+		if _, ok := removed[opIdx]; ok {
+			continue
+		}
+		inputs := make([]int, len(op.Inputs))
+		for i, tIdx := range op.Inputs {
+			inputs[i] = canonical(tIdx)
+		}
+		if containsInt(p.Unfusable, opIdx) {
+			res.Problem.Unfusable = append(res.Problem.Unfusable, len(res.Problem.Ops))
+		}
+		res.Problem.Ops = append(res.Problem.Ops, Op{
+			OpType:   op.OpType,
+			Inputs:   inputs,
+			Outputs:  append([]int{}, op.Outputs...),
+			BaseCost: op.BaseCost,
+		})
+		res.OpMap = append(res.OpMap, opIdx)
+	}
+
+	res.Problem.indexGraphOutputs()
+
+	if len(removed) > 0 {
+		fmt.Fprintf(progress, "  CSE: removed %d duplicate ops\n", len(removed))
+	}
+	return res
+}
+
+// MapSolution rewrites op indices of a solution for res.Problem back to the
+// original problem's indices. Eliminated ops do not appear in the result.
+func (res *CSEResult) MapSolution(sol *Solution) *Solution {
+	mapped := &Solution{Subgraphs: make([]Subgraph, len(sol.Subgraphs))}
+	for i, sg := range sol.Subgraphs {
+		mapped.Subgraphs[i] = sg
+		mapped.Subgraphs[i].Ops = make([]int, len(sg.Ops))
+		for j, opIdx := range sg.Ops {
+			mapped.Subgraphs[i].Ops[j] = res.OpMap[opIdx]
+		}
+	}
+	return mapped
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+// duplicatedMatMulProblem computes T0 @ T1 twice, applies the same pointwise
+// op to each copy, and multiplies the two results into the graph output
+func duplicatedMatMulProblem() *Problem {
+	p := &Problem{
+		FastMemoryCapacity:  1 << 20,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{64, 64},
+	}
+	for i := 0; i < 7; i++ {
+		p.Tensors = append(p.Tensors, Tensor{Width: 64, Height: 64})
+	}
+	p.Ops = []Op{
+		{OpType: "MatMul", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 1000},
+		{OpType: "MatMul", Inputs: []int{0, 1}, Outputs: []int{3}, BaseCost: 1000},
+		{OpType: "Pointwise", Inputs: []int{2}, Outputs: []int{4}, BaseCost: 100},
+		{OpType: "Pointwise", Inputs: []int{3}, Outputs: []int{5}, BaseCost: 100},
+		{OpType: "MatMul", Inputs: []int{4, 5}, Outputs: []int{6}, BaseCost: 1000},
+	}
+	return p
+}
+
+func TestCommonSubexpressionElimination(t *testing.T) {
+	defer func(w io.Writer) { progress = w }(progress)
+	progress = io.Discard
+
+	for _, tc := range []struct {
+		name        string
+		edit        func(p *Problem)
+		wantOps     []int
+		wantRemoved map[int]int
+		wantLast    []int // inputs of the final MatMul after CSE
+	}{
+		{"duplicated subtree", func(p *Problem) {},
+			[]int{0, 2, 4}, map[int]int{1: 0, 3: 2}, []int{4, 4}},
+		{"different cost", func(p *Problem) { p.Ops[3].BaseCost = 200 },
+			[]int{0, 2, 3, 4}, map[int]int{1: 0}, []int{4, 5}},
+		{"different inputs", func(p *Problem) { p.Ops[1].Inputs = []int{1, 0} },
+			[]int{0, 1, 2, 3, 4}, map[int]int{}, []int{4, 5}},
+		{"unfusable duplicate", func(p *Problem) { p.Unfusable = []int{1} },
+			[]int{0, 1, 2, 3, 4}, map[int]int{}, []int{4, 5}},
+		{"declared output duplicate", func(p *Problem) { p.OutputTensors = []int{3, 6} },
+			[]int{0, 1, 2, 3, 4}, map[int]int{}, []int{4, 5}},
+		// Tensor 5 is left unread, so op 3 writes a graph output
+		{"graph output duplicate", func(p *Problem) { p.Ops[4].Inputs = []int{4, 4} },
+			[]int{0, 2, 3, 4}, map[int]int{1: 0}, []int{4, 4}},
+	} {
+		p := duplicatedMatMulProblem()
+		tc.edit(p)
+		p.indexGraphOutputs()
+		res := CommonSubexpressionElimination(p, AnalyzeGraph(p))
+
+		if !reflect.DeepEqual(res.OpMap, tc.wantOps) {
+			t.Errorf("%s: kept ops %v, want %v", tc.name, res.OpMap, tc.wantOps)
+		}
+		if len(res.Problem.Ops) != len(tc.wantOps) {
+			t.Errorf("%s: %d ops after CSE, want %d", tc.name, len(res.Problem.Ops), len(tc.wantOps))
+		}
+		if !reflect.DeepEqual(res.Removed, tc.wantRemoved) {
+			t.Errorf("%s: removed %v, want %v", tc.name, res.Removed, tc.wantRemoved)
+		}
+		last := res.Problem.Ops[len(res.Problem.Ops)-1]
+		if !reflect.DeepEqual(last.Inputs, tc.wantLast) {
+			t.Errorf("%s: final MatMul reads %v, want %v", tc.name, last.Inputs, tc.wantLast)
+		}
+	}
+}
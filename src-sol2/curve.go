@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// CurveConfig sets how CapacityLatencyCurve solves
+type CurveConfig struct {
+	// Workers is the number of capacities solved concurrently
+	Workers int
+	// Fast solves each capacity with SolveFast instead of SolveOptimized
+	Fast bool
+}
+
+// CurvePoint is the fastest schedule CapacityLatencyCurve found for one
+// fast memory capacity
+type CurvePoint struct {
+	Solution  *Solution `json:"-"`
+	Capacity  int64     `json:"capacity"`
+	Latency   float64   `json:"latency"`
+	Subgraphs int       `json:"subgraphs"`
+	// Traffic is the bytes the schedule loads from and stores to slow memory
+	Traffic int64 `json:"traffic"`
+	// SolvedAt is the capacity the schedule was found under, below Capacity
+	// when a schedule for a smaller capacity was faster
+	SolvedAt int64 `json:"solved_at"`
+}
+
+// CapacityLatencyCurve solves p again with its fast memory set to each of
+// capacities, in place of its capacity and any capacity schedule, and
+// returns the points by increasing capacity. Each solve works on its own
+// copy of p, so capacities are solved concurrently and p is unchanged. A
+// schedule that fits one capacity fits every larger one, so each point
+// keeps the fastest schedule found at or below its capacity and latency
+// never rises along the curve. Capacities some op cannot fit in are skipped.
+func CapacityLatencyCurve(p *Problem, cfg CurveConfig, capacities []int64) []CurvePoint {
+	caps := append([]int64{}, capacities...)
+	sort.Slice(caps, func(a, b int) bool { return caps[a] < caps[b] })
+
+	workers := MaxInt(cfg.Workers, 1)
+	solved := make([]*CurvePoint, len(caps))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				solved[i] = solveAtCapacity(p, cfg, caps[i])
+			}
+		}()
+	}
+	for i := range caps {
+		if i > 0 && caps[i] == caps[i-1] {
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var curve []CurvePoint
+	for _, pt := range solved {
+		if pt == nil {
+			continue
+		}
+		if n := len(curve); n > 0 && !latencyLess(pt.Latency, curve[n-1].Latency) {
+			kept := curve[n-1]
+			kept.Capacity = pt.Capacity
+			pt = &kept
+		}
+		curve = append(curve, *pt)
+	}
+	return curve
+}
+
+// solveAtCapacity solves a copy of p with the given capacity throughout. It
+// returns nil, after printing why, if the capacity admits no schedule.
+func solveAtCapacity(p *Problem, cfg CurveConfig, capacity int64) *CurvePoint {
+	capped := *p
+	capped.FastMemoryCapacity = capacity
+	capped.CapacitySchedule = nil
+	if err := CheckMinimumFootprint(&capped); err != nil {
+		fmt.Fprintf(progress, "  Capacity %d: skipped, %v\n", capacity, err)
+		return nil
+	}
+
+	var sol *Solution
+	var err error
+	if cfg.Fast {
+		sol, err = SolveFast(&capped, AnalyzeGraph(&capped))
+	} else {
+		sol, err = SolveOptimized(&capped)
+	}
+	if err != nil {
+		fmt.Fprintf(progress, "  Capacity %d: skipped, %v\n", capacity, err)
+		return nil
+	}
+	lat, err := EvaluateSolution(&capped, sol)
+	if err != nil {
+		fmt.Fprintf(progress, "  WARNING: capacity %d: %v\n", capacity, err)
+		return nil
+	}
+	loads, stores, err := ComputeTotalTraffic(&capped, sol)
+	if err != nil {
+		fmt.Fprintf(progress, "  WARNING: capacity %d: %v\n", capacity, err)
+		return nil
+	}
+
+	return &CurvePoint{
+		Solution:  sol,
+		Capacity:  capacity,
+		Latency:   lat,
+		Subgraphs: len(sol.Subgraphs),
+		Traffic:   loads + stores,
+		SolvedAt:  capacity,
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import "fmt"
+
+// LiveOps reports, per op, whether the op feeds one of the problem's
+// OutputTensors, directly or through other ops. Without declared outputs
+// every op is live and gi is not used.
+func LiveOps(p *Problem, gi *GraphInfo) []bool {
+	live := make([]bool, len(p.Ops))
+	if len(p.OutputTensors) == 0 {
+		for i := range live {
+			live[i] = true
+		}
+		return live
+	}
+
+	var stack []int
+	for _, tIdx := range p.OutputTensors {
+		if opIdx, ok := gi.ProducerOf[tIdx]; ok && !live[opIdx] {
+			live[opIdx] = true
+			stack = append(stack, opIdx)
+		}
+	}
+	for len(stack) > 0 {
+		opIdx := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, dep := range gi.Dependencies[opIdx] {
+			if !live[dep] {
+				live[dep] = true
+				stack = append(stack, dep)
+			}
+		}
+	}
+	return live
+}
+
+// DCEResult is a problem rewritten by DeadOpElimination. Tensor indices are
+// unchanged; tensors only dead ops touched are left unused.
+type DCEResult struct {
+	Problem *Problem
+	// OpMap maps each op of Problem to its index in the original problem
+	OpMap []int
+	// Removed lists the eliminated original ops in index order
+	Removed []int
+}
+
+// DeadOpElimination drops ops that feed none of the problem's declared
+// output tensors. Problems without declared outputs come back unchanged.
+func DeadOpElimination(p *Problem, gi *GraphInfo) *DCEResult {
+	live := LiveOps(p, gi)
+
+	res := &DCEResult{
+		Problem: &Problem{
+			Tensors:             p.Tensors,
+			FastMemoryCapacity:  p.FastMemoryCapacity,
+			SlowMemoryBandwidth: p.SlowMemoryBandwidth,
+			NativeGranularity:   p.NativeGranularity,
+			StoreBandwidth:      p.StoreBandwidth,
+			PinnedTensors:       p.PinnedTensors,
+			MaxSubgraphOps:      p.MaxSubgraphOps,
+			OutputTensors:       p.OutputTensors,
+			Alignment:           p.Alignment,
+			CapacitySchedule:    p.CapacitySchedule,
+		},
+	}
+	for opIdx, op := range p.Ops {
+		if !live[opIdx] {
+			res.Removed = append(res.Removed, opIdx)
+			continue
+		}
+		if containsInt(p.Unfusable, opIdx) {
+			res.Problem.Unfusable = append(res.Problem.Unfusable, len(res.Problem.Ops))
+		}
+		res.Problem.Ops = append(res.Problem.Ops, op)
+		res.OpMap = append(res.OpMap, opIdx)
+	}
+
+	res.Problem.indexGraphOutputs()
+
+	if len(res.Removed) > 0 {
+		fmt.Fprintf(progress, "  DCE: removed %d dead ops %v\n", len(res.Removed), res.Removed)
+	}
+	return res
+}
+
+// MapSolution rewrites op indices of a solution for res.Problem back to the
+// original problem's indices. Dead ops do not appear in the result.
+func (res *DCEResult) MapSolution(sol *Solution) *Solution {
+	mapped := &Solution{Subgraphs: make([]Subgraph, len(sol.Subgraphs))}
+	for i, sg := range sol.Subgraphs {
+		mapped.Subgraphs[i] = sg
+		mapped.Subgraphs[i].Ops = make([]int, len(sg.Ops))
+		for j, opIdx := range sg.Ops {
+			mapped.Subgraphs[i].Ops[j] = res.OpMap[opIdx]
+		}
+	}
+	return mapped
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+// TestDeadOpElimination checks an op feeding no declared output is dropped
+// before solving, is absent from the mapped solution, and that the mapped
+// solution costs less than solving with the dead op kept
+func TestDeadOpElimination(t *testing.T) {
+	defer func(w io.Writer) { progress = w }(progress)
+	progress = io.Discard
+
+	for _, tc := range []struct {
+		name    string
+		outputs []int
+		removed []int
+	}{
+		{"dead branch", []int{2}, []int{2}},
+		{"both declared", []int{2, 3}, nil},
+		{"undeclared", nil, nil},
+	} {
+		// The chain 0 -> 1 with op 2 branching off tensor 1 into tensor 3
+		p := chainProblem(2)
+		p.Tensors = append(p.Tensors, Tensor{Width: 256, Height: 256})
+		p.Ops = append(p.Ops, Op{OpType: "Pointwise", Inputs: []int{1}, Outputs: []int{3}, BaseCost: 1000})
+		p.OutputTensors = tc.outputs
+		p.indexGraphOutputs()
+
+		res := DeadOpElimination(p, AnalyzeGraph(p))
+		if !reflect.DeepEqual(res.Removed, tc.removed) {
+			t.Errorf("%s: removed %v, want %v", tc.name, res.Removed, tc.removed)
+		}
+		if got, want := len(res.Problem.Ops), len(p.Ops)-len(tc.removed); got != want {
+			t.Errorf("%s: %d ops after DCE, want %d", tc.name, got, want)
+		}
+
+		pruned, err := SolveOptimized(res.Problem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sol := res.MapSolution(pruned)
+		for _, sg := range sol.Subgraphs {
+			for _, opIdx := range sg.Ops {
+				if containsInt(tc.removed, opIdx) {
+					t.Errorf("%s: dead op %d scheduled", tc.name, opIdx)
+				}
+			}
+		}
+		lat, err := EvaluateSolution(p, sol)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		full, err := SolveOptimized(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fullLat, err := EvaluateSolution(p, full)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tc.removed) > 0 && lat >= fullLat {
+			t.Errorf("%s: latency %.1f after DCE, want below %.1f", tc.name, lat, fullLat)
+		}
+		if len(tc.removed) == 0 && lat != fullLat {
+			t.Errorf("%s: latency %.1f after DCE, want unchanged %.1f", tc.name, lat, fullLat)
+		}
+	}
+}
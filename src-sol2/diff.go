@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GroupChange is a subgraph with the same op set in both solutions whose
+// granularity or retained tensors differ
+type GroupChange struct {
+	// Ops is the op set, sorted; IndexA and IndexB are the subgraph's
+	// position in each solution
+	Ops            []int
+	IndexA, IndexB int
+
+	GranularityA, GranularityB [3]int
+	// RetainOnlyA and RetainOnlyB are the tensors only one side retains
+	RetainOnlyA, RetainOnlyB []int
+	LatencyA, LatencyB       float64
+}
+
+// SolutionDiff is what DiffSolutions finds between two solutions
+type SolutionDiff struct {
+	// Matched counts subgraphs whose op set appears in both solutions
+	Matched int
+	Changed []GroupChange
+	// OnlyA and OnlyB index the subgraphs with no match in the other solution
+	OnlyA, OnlyB []int
+	// RegroupedOps are the ops of unmatched subgraphs, sorted
+	RegroupedOps []int
+	// LatencyA and LatencyB sum each solution's subgraph latencies
+	LatencyA, LatencyB float64
+}
+
+// LatencyDelta is b's total latency minus a's
+func (d SolutionDiff) LatencyDelta() float64 {
+	return d.LatencyB - d.LatencyA
+}
+
+// Identical reports whether the solutions group, size and retain alike
+func (d SolutionDiff) Identical() bool {
+	return len(d.Changed) == 0 && len(d.OnlyA) == 0 && len(d.OnlyB) == 0
+}
+
+// DiffSolutions compares two solutions to the same problem. Subgraphs are
+// matched by op set, in order when several share one, as a spatially split
+// subgraph does. Matched subgraphs are compared by granularity and retained
+// tensors; unmatched ones are ops the solutions group differently.
+func DiffSolutions(a, b *Solution) SolutionDiff {
+	var d SolutionDiff
+
+	opSet := func(sg Subgraph) []int {
+		ops := append([]int{}, sg.Ops...)
+		sort.Ints(ops)
+		return ops
+	}
+	unmatchedB := make(map[string][]int)
+	for j, sg := range b.Subgraphs {
+		key := fmt.Sprint(opSet(sg))
+		unmatchedB[key] = append(unmatchedB[key], j)
+		d.LatencyB += sg.SubgraphLatency
+	}
+
+	matchedB := make(map[int]bool)
+	regrouped := make(map[int]bool)
+	for i, sgA := range a.Subgraphs {
+		d.LatencyA += sgA.SubgraphLatency
+		ops := opSet(sgA)
+		key := fmt.Sprint(ops)
+		if len(unmatchedB[key]) == 0 {
+			d.OnlyA = append(d.OnlyA, i)
+			for _, opIdx := range ops {
+				regrouped[opIdx] = true
+			}
+			continue
+		}
+		j := unmatchedB[key][0]
+		unmatchedB[key] = unmatchedB[key][1:]
+		matchedB[j] = true
+		d.Matched++
+
+		sgB := b.Subgraphs[j]
+		onlyA := setDifference(sgA.TensorsToRetain, sgB.TensorsToRetain)
+		onlyB := setDifference(sgB.TensorsToRetain, sgA.TensorsToRetain)
+		if sgA.Granularity != sgB.Granularity || len(onlyA) > 0 || len(onlyB) > 0 {
+			d.Changed = append(d.Changed, GroupChange{
+				Ops:          ops,
+				IndexA:       i,
+				IndexB:       j,
+				GranularityA: sgA.Granularity,
+				GranularityB: sgB.Granularity,
+				RetainOnlyA:  onlyA,
+				RetainOnlyB:  onlyB,
+				LatencyA:     sgA.SubgraphLatency,
+				LatencyB:     sgB.SubgraphLatency,
+			})
+		}
+	}
+	for j, sg := range b.Subgraphs {
+		if matchedB[j] {
+			continue
+		}
+		d.OnlyB = append(d.OnlyB, j)
+		for _, opIdx := range sg.Ops {
+			regrouped[opIdx] = true
+		}
+	}
+
+	d.RegroupedOps = sortedKeys(regrouped)
+	return d
+}
+
+// setDifference returns the values of a not in b, sorted
+func setDifference(a, b []int) []int {
+	inB := make(map[int]bool, len(b))
+	for _, v := range b {
+		inB[v] = true
+	}
+	var diff []int
+	for _, v := range a {
+		if !inB[v] && !containsInt(diff, v) {
+			diff = append(diff, v)
+		}
+	}
+	sort.Ints(diff)
+	return diff
+}
+
+// printSolutionDiff prints d as a readable report of a against b
+func printSolutionDiff(d SolutionDiff, a, b *Solution) {
+	fmt.Printf("Subgraphs: %d in a, %d in b, %d matched by op set, %d of those changed\n",
+		len(a.Subgraphs), len(b.Subgraphs), d.Matched, len(d.Changed))
+
+	for _, c := range d.Changed {
+		fmt.Printf("Ops %v (a #%d, b #%d):\n", c.Ops, c.IndexA, c.IndexB)
+		if c.GranularityA != c.GranularityB {
+			fmt.Printf("  granularity %v -> %v\n", c.GranularityA, c.GranularityB)
+		}
+		if len(c.RetainOnlyA) > 0 || len(c.RetainOnlyB) > 0 {
+			fmt.Printf("  retain -%v +%v\n", c.RetainOnlyA, c.RetainOnlyB)
+		}
+		fmt.Printf("  latency %.1f -> %.1f\n", c.LatencyA, c.LatencyB)
+	}
+
+	if len(d.RegroupedOps) > 0 {
+		fmt.Printf("Ops grouped differently: %v\n", d.RegroupedOps)
+		for _, i := range d.OnlyA {
+			fmt.Printf("  only in a: #%d %v\n", i, a.Subgraphs[i].Ops)
+		}
+		for _, j := range d.OnlyB {
+			fmt.Printf("  only in b: #%d %v\n", j, b.Subgraphs[j].Ops)
+		}
+	}
+
+	if d.Identical() {
+		fmt.Println("Same grouping, granularities and retention")
+	}
+	fmt.Printf("Latency: %.1f -> %.1f (%+.1f)\n", d.LatencyA, d.LatencyB, d.LatencyDelta())
+}
@@ -0,0 +1,48 @@
+package main
+
+import "fmt"
+
+// The evaluator's errors. Each is returned as a pointer, possibly wrapped
+// with the subgraph it concerns, so callers tell them apart with errors.As.
+
+// WorkingSetError reports a subgraph whose working set exceeds the fast
+// memory capacity at its position
+type WorkingSetError struct {
+	SubgraphIdx int
+	WorkingSet  int64
+	Capacity    int64
+}
+
+func (e *WorkingSetError) Error() string {
+	return fmt.Sprintf("subgraph %d: working set %d exceeds capacity %d", e.SubgraphIdx, e.WorkingSet, e.Capacity)
+}
+
+// OpNotCoveredError reports a live op that no subgraph runs
+type OpNotCoveredError struct {
+	OpIdx int
+}
+
+func (e *OpNotCoveredError) Error() string {
+	return fmt.Sprintf("op %d not covered", e.OpIdx)
+}
+
+// GranularityError reports a granularity with a non-positive dimension
+type GranularityError struct {
+	Granularity [3]int
+}
+
+func (e *GranularityError) Error() string {
+	g := e.Granularity
+	return fmt.Sprintf("invalid granularity [%d,%d,%d]", g[0], g[1], g[2])
+}
+
+// RetentionError reports a subgraph retaining a tensor it neither
+// produces, reads nor holds resident
+type RetentionError struct {
+	SubgraphIdx int
+	TensorIdx   int
+}
+
+func (e *RetentionError) Error() string {
+	return fmt.Sprintf("subgraph %d retains tensor %d, which it neither produces, reads nor holds", e.SubgraphIdx, e.TensorIdx)
+}
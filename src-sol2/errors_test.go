@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestEvaluateSolutionErrorTypes checks each evaluator failure comes back,
+// wrapped or not, as its typed error with the fields describing it
+func TestEvaluateSolutionErrorTypes(t *testing.T) {
+	p := chainProblem(2)
+	p.FastMemoryCapacity = 100000
+	small, whole := [3]int{128, 128, 1}, [3]int{256, 256, 1}
+
+	for _, tc := range []struct {
+		name      string
+		subgraphs []Subgraph
+		want      error
+	}{
+		{"working set", []Subgraph{{Ops: []int{0}, Granularity: small}, {Ops: []int{1}, Granularity: whole}},
+			&WorkingSetError{SubgraphIdx: 1, WorkingSet: 2 * 256 * 256, Capacity: 100000}},
+		{"op not covered", []Subgraph{{Ops: []int{0}, Granularity: small}},
+			&OpNotCoveredError{OpIdx: 1}},
+		{"granularity", []Subgraph{{Ops: []int{0}, Granularity: small}, {Ops: []int{1}, Granularity: [3]int{0, 128, 1}}},
+			&GranularityError{Granularity: [3]int{0, 128, 1}}},
+		{"retention", []Subgraph{{Ops: []int{0}, Granularity: small, TensorsToRetain: []int{2}}, {Ops: []int{1}, Granularity: small}},
+			&RetentionError{SubgraphIdx: 0, TensorIdx: 2}},
+	} {
+		_, err := EvaluateSolution(p, &Solution{Subgraphs: tc.subgraphs})
+		if err == nil {
+			t.Errorf("%s: no error, want %v", tc.name, tc.want)
+			continue
+		}
+		switch want := tc.want.(type) {
+		case *WorkingSetError:
+			var got *WorkingSetError
+			if !errors.As(err, &got) || *got != *want {
+				t.Errorf("%s: error %v, want %+v", tc.name, err, *want)
+			}
+		case *OpNotCoveredError:
+			var got *OpNotCoveredError
+			if !errors.As(err, &got) || *got != *want {
+				t.Errorf("%s: error %v, want %+v", tc.name, err, *want)
+			}
+		case *GranularityError:
+			var got *GranularityError
+			if !errors.As(err, &got) || *got != *want {
+				t.Errorf("%s: error %v, want %+v", tc.name, err, *want)
+			}
+		case *RetentionError:
+			var got *RetentionError
+			if !errors.As(err, &got) || *got != *want {
+				t.Errorf("%s: error %v, want %+v", tc.name, err, *want)
+			}
+		}
+	}
+
+	// The subgraph evaluator returns the same granularity error unwrapped
+	_, err := EvaluateSubgraphDetailed(p, []int{0}, [3]int{128, 0, 1}, nil, nil, nil, ReuseSnake)
+	var gErr *GranularityError
+	if !errors.As(err, &gErr) || gErr.Granularity != [3]int{128, 0, 1} {
+		t.Errorf("EvaluateSubgraphDetailed: error %v, want a GranularityError for [128 0 1]", err)
+	}
+}
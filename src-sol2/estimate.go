@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// EstimateSample compares the two latency models on one subgraph
+type EstimateSample struct {
+	Subgraph int
+	Estimate float64
+	Detailed float64
+	// RelError is (Estimate - Detailed) / Detailed, so negative values mean
+	// QuickEstimate is optimistic
+	RelError float64
+}
+
+// EstimateReport summarizes how well QuickEstimate tracks the detailed
+// evaluator over the subgraphs of a solution
+type EstimateReport struct {
+	Samples []EstimateSample
+	// MaxRelError and MeanRelError are taken over |RelError|
+	MaxRelError  float64
+	MeanRelError float64
+	// Correlation is Pearson's r between the two models, NaN when there are
+	// fewer than two subgraphs or either model is constant
+	Correlation float64
+}
+
+// EstimateAccuracyReport evaluates every subgraph of sol with QuickEstimate
+// and with the detailed evaluator, under the residency the solution's
+// retention produces, and summarizes the disagreement
+func EstimateAccuracyReport(p *Problem, sol *Solution) EstimateReport {
+	var rep EstimateReport
+	resident := make(map[int]bool)
+
+	for i, sg := range sol.Subgraphs {
+		est := QuickEstimate(p, sg.Ops, sg.Granularity, resident)
+		det, err := EvaluateSubgraphDataflow(p.atSubgraph(i), sg.Ops, sg.Granularity, sg.TensorsToRetain, sg.TraversalOrder, resident, sg.Dataflow)
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+		if err != nil || det <= 0 || math.IsInf(est, 0) {
+			continue
+		}
+
+		s := EstimateSample{Subgraph: i, Estimate: est, Detailed: det, RelError: (est - det) / det}
+		rep.Samples = append(rep.Samples, s)
+		rep.MaxRelError = math.Max(rep.MaxRelError, math.Abs(s.RelError))
+		rep.MeanRelError += math.Abs(s.RelError)
+	}
+
+	n := float64(len(rep.Samples))
+	rep.Correlation = math.NaN()
+	if n == 0 {
+		return rep
+	}
+	rep.MeanRelError /= n
+
+	var meanE, meanD float64
+	for _, s := range rep.Samples {
+		meanE += s.Estimate / n
+		meanD += s.Detailed / n
+	}
+	var cov, varE, varD float64
+	for _, s := range rep.Samples {
+		cov += (s.Estimate - meanE) * (s.Detailed - meanD)
+		varE += (s.Estimate - meanE) * (s.Estimate - meanE)
+		varD += (s.Detailed - meanD) * (s.Detailed - meanD)
+	}
+	if n >= 2 && varE > 0 && varD > 0 {
+		rep.Correlation = cov / math.Sqrt(varE*varD)
+	}
+	return rep
+}
+
+// reportEstimateAccuracy prints the summary line of rep and a warning for
+// each subgraph whose estimate is off by more than tolerance
+func reportEstimateAccuracy(rep EstimateReport, tolerance float64) {
+	fmt.Fprintf(progress, "  QuickEstimate over %d subgraphs: max error %.1f%%, mean %.1f%%, correlation %.3f\n",
+		len(rep.Samples), 100*rep.MaxRelError, 100*rep.MeanRelError, rep.Correlation)
+	for _, s := range rep.Samples {
+		if math.Abs(s.RelError) > tolerance {
+			fmt.Fprintf(progress, "  WARNING: subgraph %d: QuickEstimate %.1f vs detailed %.1f (%+.1f%%)\n",
+				s.Subgraph, s.Estimate, s.Detailed, 100*s.RelError)
+		}
+	}
+}
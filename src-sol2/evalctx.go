@@ -0,0 +1,119 @@
+package main
+
+import "fmt"
+
+// EvaluationContext caches the latency of each entry of a schedule and the
+// residency it starts with, so a local edit re-evaluates only the entries it
+// affects. An entry's latency depends only on the entry and the tensors the
+// entry before it retains, so after entry i changes, entries past i need
+// evaluating again only while their residency keeps changing.
+type EvaluationContext struct {
+	p        *Problem
+	schedule []ScheduleEntry
+	resident []map[int]bool
+	latency  []float64
+	errs     []error
+	// memo holds every latency evaluated per entry, keyed by the entry and
+	// its residency, so undoing a rejected edit costs no evaluation
+	memo []map[string]float64
+}
+
+// NewEvaluationContext evaluates every entry of schedule. The context keeps
+// schedule, not a copy: callers edit its entries in place and then call
+// InvalidateFrom with the first entry they changed.
+func NewEvaluationContext(p *Problem, schedule []ScheduleEntry) *EvaluationContext {
+	ec := &EvaluationContext{
+		p:        p,
+		schedule: schedule,
+		resident: make([]map[int]bool, len(schedule)),
+		latency:  make([]float64, len(schedule)),
+		errs:     make([]error, len(schedule)),
+		memo:     make([]map[string]float64, len(schedule)),
+	}
+	for i := range schedule {
+		ec.resident[i] = ec.residentAt(i)
+		ec.evaluate(i)
+	}
+	return ec
+}
+
+// InvalidateFrom re-evaluates entry i, then each later entry until one
+// starts with the same residency as before. Evaluated entries get their
+// Latency updated in the schedule.
+func (ec *EvaluationContext) InvalidateFrom(i int) {
+	for k := i; k < len(ec.schedule); k++ {
+		resident := ec.residentAt(k)
+		if k > i && sameKeys(resident, ec.resident[k]) {
+			return
+		}
+		ec.resident[k] = resident
+		ec.evaluate(k)
+	}
+}
+
+// Total returns the latency of the schedule as EvaluateSolution adds it
+// up, or the first error an entry failed with. Capacity and the other
+// checks EvaluateSolution makes beyond the entries' own latency are not
+// repeated.
+func (ec *EvaluationContext) Total() (float64, error) {
+	total := 0.0
+	ran := 0
+	for i, entry := range ec.schedule {
+		if ec.errs[i] != nil {
+			return 0, fmt.Errorf("subgraph %d: %w", i, ec.errs[i])
+		}
+		if len(entry.Ops) > 0 && isZeroSized(GetOutputShape(ec.p, entry.Ops)) {
+			continue
+		}
+		total += roundLatency(ec.latency[i]) + Config.PerSubgraphOverhead
+		if ran > 0 {
+			total += Config.ContextSwitchCost
+		}
+		ran++
+	}
+	return total, nil
+}
+
+// residentAt is the residency entry i starts with, given the cached
+// residency of entry i-1
+func (ec *EvaluationContext) residentAt(i int) map[int]bool {
+	if i == 0 {
+		return make(map[int]bool)
+	}
+	return entryResidentAfter(ec.p, ec.schedule, i-1, ec.resident[i-1])
+}
+
+// evaluate sets the latency of entry i under its cached residency
+func (ec *EvaluationContext) evaluate(i int) {
+	entry := &ec.schedule[i]
+	key := fmt.Sprint(entry.Granularity, entry.Retain, entry.Traversal, entry.Dataflow, sortedKeys(ec.resident[i]))
+	if lat, ok := ec.memo[i][key]; ok {
+		ec.latency[i], ec.errs[i] = lat, nil
+		entry.Latency = lat
+		return
+	}
+
+	lat, err := EvaluateSubgraphDataflow(ec.p.atSubgraph(i), entry.Ops, entry.Granularity, entry.Retain, entry.Traversal, ec.resident[i], entry.Dataflow)
+	ec.latency[i], ec.errs[i] = lat, err
+	if err != nil {
+		return
+	}
+	entry.Latency = lat
+	if ec.memo[i] == nil {
+		ec.memo[i] = make(map[string]float64)
+	}
+	ec.memo[i][key] = lat
+}
+
+// sameKeys reports whether a and b hold the same tensors
+func sameKeys(a, b map[int]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"math"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestEvaluationContextEdits applies a sequence of local edits to solved
+// schedules, invalidating from each edited entry, and checks the
+// incremental Total stays equal to a full EvaluateSolution after each one
+func TestEvaluationContextEdits(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+	defer func(w io.Writer) { progress = w }(progress)
+	progress = io.Discard
+	Config.PerSubgraphOverhead = 500
+	Config.ContextSwitchCost = 100
+
+	edits := []struct {
+		name string
+		// apply edits entry i of s and reports whether it changed anything
+		apply func(p *Problem, s []ScheduleEntry, i int) bool
+	}{
+		{"unretain", func(p *Problem, s []ScheduleEntry, i int) bool {
+			if len(s[i].Retain) == 0 {
+				return false
+			}
+			s[i].Retain = slices.Clone(s[i].Retain[1:])
+			return true
+		}},
+		{"retain outputs", func(p *Problem, s []ScheduleEntry, i int) bool {
+			outs := sortedKeys(GetSubgraphBoundary(p, s[i].Ops).BoundaryOutputs)
+			if slices.Equal(outs, s[i].Retain) {
+				return false
+			}
+			s[i].Retain = outs
+			return true
+		}},
+		{"drop resident", func(p *Problem, s []ScheduleEntry, i int) bool {
+			s[i].Drop = sortedKeys(entryResidentAfter(p, s, i, entryResidentBefore(p, s, i)))
+			return len(s[i].Drop) > 0
+		}},
+		{"halve tile", func(p *Problem, s []ScheduleEntry, i int) bool {
+			if s[i].Granularity[0] < 2 {
+				return false
+			}
+			s[i].Granularity[0] /= 2
+			s[i].Traversal = nil
+			return true
+		}},
+	}
+
+	for _, name := range []string{"mlsys-2026-5", "mlsys-2026-13"} {
+		p, err := ReadProblem(filepath.Join("..", "benchmarks", name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sol, err := SolveOptimized(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schedule := make([]ScheduleEntry, len(sol.Subgraphs))
+		for i, sg := range sol.Subgraphs {
+			schedule[i] = ScheduleEntry{Ops: sg.Ops, Granularity: sg.Granularity, Traversal: sg.TraversalOrder,
+				Retain: sg.TensorsToRetain, Dataflow: sg.Dataflow, Drop: sg.TensorsToDrop}
+		}
+		ec := NewEvaluationContext(p, schedule)
+
+		kept := 0
+		for i := range schedule {
+			for _, e := range edits {
+				// Edits assign fresh slices, so a shallow copy undoes them
+				before := schedule[i]
+				if !e.apply(p, schedule, i) {
+					continue
+				}
+				ec.InvalidateFrom(i)
+				want, err := EvaluateSolution(p, scheduleSolution(schedule))
+				if err != nil {
+					// Capacity is EvaluateSolution's check alone; undo the
+					// edit and compare the restored schedule instead
+					schedule[i] = before
+					ec.InvalidateFrom(i)
+					if want, err = EvaluateSolution(p, scheduleSolution(schedule)); err != nil {
+						t.Fatalf("%s: undoing %s at %d: %v", name, e.name, i, err)
+					}
+				} else {
+					kept++
+				}
+				got, err := ec.Total()
+				if err != nil {
+					t.Fatalf("%s: %s at %d: %v", name, e.name, i, err)
+				}
+				if math.Abs(got-want) > 1e-6*want {
+					t.Errorf("%s: %s at %d: incremental total %.1f, full %.1f", name, e.name, i, got, want)
+				}
+			}
+		}
+		if kept < len(schedule) {
+			t.Errorf("%s: only %d edits kept over %d entries", name, kept, len(schedule))
+		}
+	}
+}
@@ -1,46 +1,118 @@
 package main
 
 import (
+	"container/list"
 	"fmt"
 	"math"
 )
 
 // InputTileSize computes the tile size for a boundary input tensor
 func InputTileSize(p *Problem, ops []int, tensorIdx int, w, h, k int) int64 {
+	if isZeroSized(p.Tensors[tensorIdx]) {
+		return 0
+	}
+	tw, th := InputTileShape(p, ops, tensorIdx, w, h, k)
+	return int64(tw) * int64(th)
+}
+
+// InputTileShape returns the width and height of the tile of an input
+// tensor that one step reads. A tensor several ops of the subgraph read,
+// such as a MatMul RHS that a pointwise op also reads, needs the largest
+// of their tiles.
+func InputTileShape(p *Problem, ops []int, tensorIdx int, w, h, k int) (int, int) {
+	tw, th, found := 0, 0, false
 	for _, opIdx := range ops {
 		op := p.Ops[opIdx]
 		for pos, inp := range op.Inputs {
-			if inp == tensorIdx {
-				if op.OpType == "MatMul" {
-					if pos == 0 {
-						// LHS: [h, k]
-						// If h > tensorHeight (padding), we still pay for h
-						// But here h is the tile height.
-						return int64(k) * int64(h)
-					}
-					// RHS: [k, w]
-					return int64(w) * int64(k)
-				}
-				// Pointwise: [w, h]
-				return int64(w) * int64(h)
+			if inp != tensorIdx {
+				continue
+			}
+			uw, uh := useTileShape(p, ops, op, pos, w, h, k)
+			if !found || int64(uw)*int64(uh) > int64(tw)*int64(th) {
+				tw, th, found = uw, uh, true
 			}
 		}
 	}
-	return int64(w) * int64(h)
+	if !found {
+		return w, h
+	}
+	return tw, th
 }
 
-// InputTileRole returns "LHS", "RHS", or "PW"
+// useTileShape returns the tile op reads as its input pos
+func useTileShape(p *Problem, ops []int, op Op, pos int, w, h, k int) (int, int) {
+	tensorIdx := op.Inputs[pos]
+	if op.OpType == "Transpose" {
+		if consumedInOps(p, ops, op.Outputs[0]) {
+			// Fused transpose: read the transpose of the tile
+			// its consumer reads
+			tw, th := InputTileShape(p, ops, op.Outputs[0], w, h, k)
+			return th, tw
+		}
+		// The output tile is [w, h], so the input tile is [h, w]
+		return h, w
+	}
+	if op.OpType == "MatMul" {
+		if pos == 0 {
+			// LHS: [h, k]
+			// If h > tensorHeight (padding), we still pay for h
+			// But here h is the tile height.
+			return k, h
+		}
+		// RHS: [k, w]
+		return w, k
+	}
+	if isBroadcastInput(p, op, tensorIdx) {
+		// Broadcast: loaded whole and kept for every tile
+		t := p.Tensors[tensorIdx]
+		return t.Width, t.Height
+	}
+	// Pointwise: [w, h]
+	return w, h
+}
+
+// consumedInOps reports whether some op in ops reads tensor tIdx
+func consumedInOps(p *Problem, ops []int, tIdx int) bool {
+	for _, opIdx := range ops {
+		if containsInt(p.Ops[opIdx].Inputs, tIdx) {
+			return true
+		}
+	}
+	return false
+}
+
+// ComputeCost returns the per-step compute cost of op. Transposes only
+// change how a tile is addressed and cost nothing.
+func ComputeCost(op Op) int64 {
+	if op.OpType == "Transpose" {
+		return 0
+	}
+	return op.BaseCost
+}
+
+// InputTileRole returns "LHS", "RHS", "PW", or "BROADCAST". A tensor read
+// through a fused transpose takes the role of the transposed tensor: the
+// same loop indices select its tile, only the tile's orientation flips.
 func InputTileRole(p *Problem, ops []int, tensorIdx int) string {
 	for _, opIdx := range ops {
 		op := p.Ops[opIdx]
 		for pos, inp := range op.Inputs {
 			if inp == tensorIdx {
+				if op.OpType == "Transpose" {
+					if consumedInOps(p, ops, op.Outputs[0]) {
+						return InputTileRole(p, ops, op.Outputs[0])
+					}
+					return "PW"
+				}
 				if op.OpType == "MatMul" {
 					if pos == 0 {
 						return "LHS"
 					}
 					return "RHS"
 				}
+				if isBroadcastInput(p, op, tensorIdx) {
+					return "BROADCAST"
+				}
 				return "PW"
 			}
 		}
@@ -48,36 +120,206 @@ func InputTileRole(p *Problem, ops []int, tensorIdx int) string {
 	return "PW"
 }
 
+// isBroadcastInput reports whether tensorIdx is a row, column or scalar that
+// a pointwise op broadcasts against its larger output, such as a 1xW bias.
+// Such inputs are loaded once per subgraph rather than once per tile.
+func isBroadcastInput(p *Problem, op Op, tensorIdx int) bool {
+	if op.OpType == "MatMul" || op.OpType == "Transpose" || len(op.Outputs) == 0 {
+		return false
+	}
+	t := p.Tensors[tensorIdx]
+	out := p.Tensors[op.Outputs[0]]
+	if t.Width != 1 && t.Height != 1 {
+		return false
+	}
+	return t.Width != out.Width || t.Height != out.Height
+}
+
+// OutputTileSize returns the size of one output tile of tensor tIdx
+func OutputTileSize(p *Problem, tIdx int, w, h int) int64 {
+	if isZeroSized(p.Tensors[tIdx]) {
+		return 0
+	}
+	return int64(w) * int64(h)
+}
+
+// StoreBandwidth returns the bandwidth for output eviction, falling back to
+// SlowMemoryBandwidth when the problem does not set one
+func StoreBandwidth(p *Problem) float64 {
+	if p.StoreBandwidth > 0 {
+		return float64(p.StoreBandwidth)
+	}
+	return float64(p.SlowMemoryBandwidth)
+}
+
+// SpillTime returns the time to evict a tensor of size elements and load it
+// back, the cost of splitting a producer and consumer into two subgraphs
+func SpillTime(p *Problem, size int64) float64 {
+	return float64(size)/StoreBandwidth(p) + float64(size)/float64(p.SlowMemoryBandwidth)
+}
+
 // FullTensorSize returns size of entire tensor
 func FullTensorSize(p *Problem, tIdx int) int64 {
 	t := p.Tensors[tIdx]
 	return int64(t.Width) * int64(t.Height)
 }
 
+// retainedCompressed reports whether tIdx is held compressed while it is
+// retained between subgraphs. Pinned tensors are always held whole.
+func retainedCompressed(p *Problem, tIdx int) bool {
+	return Config.RetainCompressed && p.Tensors[tIdx].CompressionRatio > 1 && !IsPinnedTensor(p, tIdx)
+}
+
+// ResidentSize is the fast memory tIdx takes while retained between
+// subgraphs: its full size, or that over its compression ratio when it is
+// retained compressed
+func ResidentSize(p *Problem, tIdx int) int64 {
+	size := FullTensorSize(p, tIdx)
+	if retainedCompressed(p, tIdx) {
+		return int64(math.Ceil(float64(size) / p.Tensors[tIdx].CompressionRatio))
+	}
+	return size
+}
+
+// decompressTime is the compute time of decompressing a tile of size
+// elements read from tIdx, zero unless tIdx is retained compressed
+func decompressTime(p *Problem, tIdx int, size int64) float64 {
+	if !retainedCompressed(p, tIdx) {
+		return 0
+	}
+	return float64(size) * p.Tensors[tIdx].DecompressCost
+}
+
+// AlignedSize is the fast memory a block of size elements occupies once
+// rounded up to the problem's alignment
+func AlignedSize(p *Problem, size int64) int64 {
+	if p.Alignment <= 1 || size <= 0 {
+		return size
+	}
+	return (size + p.Alignment - 1) / p.Alignment * p.Alignment
+}
+
+// IsPinnedTensor reports whether tIdx is pinned to fast memory by the problem
+func IsPinnedTensor(p *Problem, tIdx int) bool {
+	return containsInt(p.PinnedTensors, tIdx)
+}
+
+// isGraphOutput reports whether tIdx is a result of the graph: a declared
+// output tensor, or an op's output no op reads. Results must reach slow
+// memory, so they are never retained in place of their store.
+func isGraphOutput(p *Problem, tIdx int) bool {
+	if len(p.graphOutputs) == len(p.Tensors) && tIdx >= 0 && tIdx < len(p.graphOutputs) {
+		return p.graphOutputs[tIdx]
+	}
+	// Problems built field by field, as tests do, have no index
+	if containsInt(p.OutputTensors, tIdx) {
+		return true
+	}
+	produced := false
+	for _, op := range p.Ops {
+		if containsInt(op.Inputs, tIdx) {
+			return false
+		}
+		if containsInt(op.Outputs, tIdx) {
+			produced = true
+		}
+	}
+	return produced
+}
+
+// indexGraphOutputs records which tensors isGraphOutput reports, so the
+// evaluator and retention planners need not scan every op per tensor. It
+// must be called again after Ops or OutputTensors change.
+func (p *Problem) indexGraphOutputs() {
+	produced := make([]bool, len(p.Tensors))
+	read := make([]bool, len(p.Tensors))
+	for _, op := range p.Ops {
+		for _, tIdx := range op.Inputs {
+			read[tIdx] = true
+		}
+		for _, tIdx := range op.Outputs {
+			produced[tIdx] = true
+		}
+	}
+	outputs := make([]bool, len(p.Tensors))
+	for tIdx := range outputs {
+		outputs[tIdx] = produced[tIdx] && !read[tIdx]
+	}
+	for _, tIdx := range p.OutputTensors {
+		outputs[tIdx] = true
+	}
+	p.graphOutputs = outputs
+}
+
+// PinnedFootprint returns the fast memory permanently taken by pinned tensors
+func PinnedFootprint(p *Problem) int64 {
+	var total int64
+	for _, tIdx := range uniqueInts(p.PinnedTensors) {
+		total += AlignedSize(p, FullTensorSize(p, tIdx))
+	}
+	return total
+}
+
+// withPinned returns residentTensors plus the problem's pinned tensors. A
+// pinned tensor behaves like one retained by every previous subgraph.
+func withPinned(p *Problem, residentTensors map[int]bool) map[int]bool {
+	if len(p.PinnedTensors) == 0 {
+		return residentTensors
+	}
+	merged := make(map[int]bool, len(residentTensors)+len(p.PinnedTensors))
+	for tIdx, ok := range residentTensors {
+		if ok {
+			merged[tIdx] = true
+		}
+	}
+	for _, tIdx := range p.PinnedTensors {
+		merged[tIdx] = true
+	}
+	return merged
+}
+
 // ComputeWorkingSet returns peak fast memory for one step
 func ComputeWorkingSet(p *Problem, ops []int, gran [3]int, residentTensors map[int]bool) int64 {
+	return workingSetWithBoundary(p, ops, GetSubgraphBoundary(p, ops), gran, residentTensors)
+}
+
+// workingSetWithBoundary is ComputeWorkingSet for a boundary the caller
+// already has, such as one grown incrementally with AddOp
+func workingSetWithBoundary(p *Problem, ops []int, boundary *SubgraphBoundary, gran [3]int, residentTensors map[int]bool) int64 {
 	w, h, k := gran[0], gran[1], gran[2]
-	boundary := GetSubgraphBoundary(p, ops)
+	residentTensors = withPinned(p, residentTensors)
 
 	var ws int64
 
 	for tIdx := range boundary.BoundaryInputs {
 		if residentTensors[tIdx] {
-			// Resident tensor occupies its FULL size, not just a tile
-			ws += FullTensorSize(p, tIdx)
+			// Resident tensor occupies its FULL size, not just a tile;
+			// a compressed one also needs the tile it decompresses into
+			ws += AlignedSize(p, ResidentSize(p, tIdx))
+			if retainedCompressed(p, tIdx) {
+				ws += AlignedSize(p, InputTileSize(p, ops, tIdx, w, h, k))
+			}
 		} else {
-			ws += InputTileSize(p, ops, tIdx, w, h, k)
+			ws += AlignedSize(p, InputTileSize(p, ops, tIdx, w, h, k))
 		}
 	}
 
-	for range boundary.BoundaryOutputs {
-		ws += int64(w) * int64(h)
+	for tIdx := range boundary.BoundaryOutputs {
+		if boundary.InPlace[tIdx] {
+			// Updated in the tile counted as an input
+			continue
+		}
+		if IsPinnedTensor(p, tIdx) {
+			ws += AlignedSize(p, FullTensorSize(p, tIdx))
+		} else {
+			ws += AlignedSize(p, OutputTileSize(p, tIdx, w, h))
+		}
 	}
 
 	// Retained tensors not used by this subgraph
 	for tIdx := range residentTensors {
 		if !boundary.BoundaryInputs[tIdx] && !boundary.AllProduced[tIdx] {
-			ws += FullTensorSize(p, tIdx)
+			ws += AlignedSize(p, ResidentSize(p, tIdx))
 		}
 	}
 
@@ -91,14 +333,35 @@ func ComputeWorkingSetWithRetained(p *Problem, ops []int, gran [3]int, residentT
 	// Add retained output tensors that need to stay as full tensors
 	boundary := GetSubgraphBoundary(p, ops)
 	for _, tIdx := range retainedAfter {
-		if boundary.BoundaryOutputs[tIdx] {
+		// A resident in-place tensor is already counted in full
+		if boundary.InPlace[tIdx] && residentTensors[tIdx] {
+			continue
+		}
+		if boundary.BoundaryOutputs[tIdx] && retainedCompressed(p, tIdx) {
+			// Tiles are compressed into the retained tensor as they finish
+			ws += AlignedSize(p, ResidentSize(p, tIdx))
+			continue
+		}
+		if boundary.BoundaryOutputs[tIdx] && !IsPinnedTensor(p, tIdx) {
 			// The output tile is w*h but we need full tensor for retention
 			// We already counted w*h for the output; add the rest
-			fullSize := FullTensorSize(p, tIdx)
-			tileSize := int64(gran[0]) * int64(gran[1])
+			fullSize := AlignedSize(p, FullTensorSize(p, tIdx))
+			tileSize := AlignedSize(p, OutputTileSize(p, tIdx, gran[0], gran[1]))
 			if fullSize > tileSize {
 				ws += fullSize - tileSize
 			}
+			continue
+		}
+		// A loaded input kept for later accumulates whole; its tiles are
+		// already counted unless it is kept compressed
+		if boundary.BoundaryInputs[tIdx] && !residentTensors[tIdx] && !IsPinnedTensor(p, tIdx) {
+			fullSize := AlignedSize(p, ResidentSize(p, tIdx))
+			tileSize := AlignedSize(p, InputTileSize(p, ops, tIdx, gran[0], gran[1], gran[2]))
+			if retainedCompressed(p, tIdx) {
+				ws += fullSize
+			} else if fullSize > tileSize {
+				ws += fullSize - tileSize
+			}
 		}
 	}
 
@@ -120,10 +383,132 @@ func GetMaxK(p *Problem, ops []int) int {
 	return maxK
 }
 
-// GetOutputTensor returns primary output tensor
+// opKSteps returns how many of a subgraph's nK k-steps op runs at reduction
+// depth k: a MatMul only the steps its own K needs, any other op all of them
+func opKSteps(p *Problem, op Op, k, nK int) int {
+	if op.OpType != "MatMul" {
+		return nK
+	}
+	return MinInt(CeilDiv(p.Tensors[op.Inputs[0]].Width, k), nK)
+}
+
+// InputKSteps returns how many k-steps input tensorIdx of ops is loaded in
+// at reduction depth k. A MatMul operand, directly or through a Transpose,
+// is needed only while the deepest MatMul reading it still reduces; other
+// inputs span every k-step.
+func InputKSteps(p *Problem, ops []int, tensorIdx, k int) int {
+	nK := CeilDiv(GetMaxK(p, ops), k)
+	steps := 0
+	for _, opIdx := range ops {
+		op := p.Ops[opIdx]
+		for _, inp := range op.Inputs {
+			if inp != tensorIdx {
+				continue
+			}
+			switch {
+			case op.OpType == "MatMul":
+				steps = MaxInt(steps, opKSteps(p, op, k, nK))
+			case op.OpType == "Transpose" && consumedInOps(p, ops, op.Outputs[0]):
+				steps = MaxInt(steps, InputKSteps(p, ops, op.Outputs[0], k))
+			default:
+				return nK
+			}
+		}
+	}
+	if steps == 0 {
+		return nK
+	}
+	return steps
+}
+
+// kStepCompute returns the compute time of each of the nK k-steps of ops at
+// gran, where MatMuls with a shallower K than the deepest drop out once their
+// reduction is done. It returns nil if every step costs the same.
+func kStepCompute(cm CostModel, p *Problem, ops []int, gran [3]int, nK int) []float64 {
+	ends := make(map[int]bool)
+	for _, opIdx := range ops {
+		if s := opKSteps(p, p.Ops[opIdx], gran[2], nK); s < nK {
+			ends[s] = true
+		}
+	}
+	if len(ends) == 0 {
+		return nil
+	}
+
+	steps := make([]float64, nK)
+	for s := range steps {
+		if s > 0 && !ends[s] {
+			steps[s] = steps[s-1]
+			continue
+		}
+		var active []int
+		for _, opIdx := range ops {
+			if s < opKSteps(p, p.Ops[opIdx], gran[2], nK) {
+				active = append(active, opIdx)
+			}
+		}
+		steps[s] = cm.ComputePerStep(p, active, gran)
+	}
+	return steps
+}
+
+// GetOutputTensor returns primary output tensor: the last op's first output,
+// as the reference evaluator takes it, when that output is a boundary output.
+// It always is when ops are in topological order, as every emitted subgraph
+// is. Otherwise the largest boundary output stands in for the ephemeral one,
+// preferring later ops on ties, and the last op's first output remains the
+// fallback when every output is ephemeral. Returns -1 if no op in ops
+// produces an output. On a withPrimaryOutput view, the view's tensor is
+// returned whenever ops produce it.
 func GetOutputTensor(p *Problem, ops []int) int {
-	lastOp := p.Ops[ops[len(ops)-1]]
-	return lastOp.Outputs[0]
+	if len(ops) == 0 {
+		return -1
+	}
+	boundary := GetSubgraphBoundary(p, ops)
+	if t := p.primaryOutput; t != nil && boundary.AllProduced[*t] {
+		return *t
+	}
+	if last := p.Ops[ops[len(ops)-1]].Outputs; len(last) > 0 && boundary.BoundaryOutputs[last[0]] {
+		return last[0]
+	}
+
+	best := -1
+	var bestSize int64 = -1
+	for i := len(ops) - 1; i >= 0; i-- {
+		for _, tIdx := range p.Ops[ops[i]].Outputs {
+			if !boundary.BoundaryOutputs[tIdx] {
+				continue
+			}
+			if size := FullTensorSize(p, tIdx); size > bestSize {
+				best, bestSize = tIdx, size
+			}
+		}
+	}
+	if best >= 0 {
+		return best
+	}
+
+	for i := len(ops) - 1; i >= 0; i-- {
+		if outs := p.Ops[ops[i]].Outputs; len(outs) > 0 {
+			return outs[0]
+		}
+	}
+	return -1
+}
+
+// GetOutputShape returns the shape of the primary output, which drives the
+// spatial tile grid. A subgraph without outputs gets an empty grid.
+func GetOutputShape(p *Problem, ops []int) Tensor {
+	tIdx := GetOutputTensor(p, ops)
+	if tIdx < 0 {
+		return Tensor{}
+	}
+	return p.Tensors[tIdx]
+}
+
+// isZeroSized reports whether a tensor has no elements
+func isZeroSized(t Tensor) bool {
+	return t.Width <= 0 || t.Height <= 0
 }
 
 // HasMatMul checks if any op in ops is a MatMul
@@ -138,12 +523,67 @@ func HasMatMul(p *Problem, ops []int) bool {
 
 type tileInputInfo struct {
 	tensorIdx int
-	role      string // "LHS", "RHS", "PW"
+	role      string // "LHS", "RHS", "PW", "BROADCAST"
 	tileSize  int64
 	fullSize  int64
+	kSteps    int // k-steps the tile is loaded in; later ones skip it
+}
+
+// Breakdown splits a subgraph's latency into its compute and memory parts.
+// ComputeBoundTime + MemoryBoundTime == Latency: each step contributes its
+// binding side to exactly one of them.
+type Breakdown struct {
+	Latency          float64 `json:"latency"`
+	ComputeTime      float64 `json:"compute_time"`
+	MemoryTime       float64 `json:"memory_time"`
+	ComputeBoundTime float64 `json:"compute_bound_time"`
+	MemoryBoundTime  float64 `json:"memory_bound_time"`
+	SpatialTiles     int     `json:"spatial_tiles"`
+	KSteps           int     `json:"k_steps"`
+	LoadBytes        int64   `json:"load_bytes"`
+	StoreBytes       int64   `json:"store_bytes"`
 }
 
-// EvaluateSubgraphDetailed computes latency with reuse model
+// ReuseModel selects which input tiles the step evaluator treats as
+// already in fast memory
+type ReuseModel int
+
+const (
+	// ReuseNone charges every input tile on every step, like the baseline
+	// evaluator. It gives a cold-cache upper bound.
+	ReuseNone ReuseModel = iota
+	// ReuseSnake reuses a tile when the previous step used the same one.
+	// This is the model the solver optimizes against.
+	ReuseSnake
+	// ReuseLRU also hits older tiles kept, least recently used first out,
+	// in the capacity the working set leaves free
+	ReuseLRU
+)
+
+// String returns the flag spelling of the reuse model
+func (r ReuseModel) String() string {
+	switch r {
+	case ReuseNone:
+		return "none"
+	case ReuseSnake:
+		return "snake"
+	case ReuseLRU:
+		return "lru"
+	}
+	return fmt.Sprintf("ReuseModel(%d)", int(r))
+}
+
+// ParseReuseModel parses the flag spelling of a reuse model
+func ParseReuseModel(s string) (ReuseModel, error) {
+	for _, r := range []ReuseModel{ReuseNone, ReuseSnake, ReuseLRU} {
+		if s == r.String() {
+			return r, nil
+		}
+	}
+	return ReuseSnake, fmt.Errorf("unknown reuse model %q (want none, snake or lru)", s)
+}
+
+// EvaluateSubgraphDetailed computes latency under the given reuse model
 func EvaluateSubgraphDetailed(
 	p *Problem,
 	ops []int,
@@ -151,21 +591,103 @@ func EvaluateSubgraphDetailed(
 	tensorsToRetain []int,
 	traversalOrder []int,
 	residentTensors map[int]bool,
+	reuse ReuseModel,
 ) (float64, error) {
+	bd, err := EvaluateSubgraphBreakdown(p, ops, gran, tensorsToRetain, traversalOrder, residentTensors, reuse)
+	if err != nil {
+		return 0, err
+	}
+	return bd.Latency, nil
+}
+
+// EvaluateSubgraphDataflow computes snake-reuse latency for a subgraph run
+// with the given dataflow
+func EvaluateSubgraphDataflow(
+	p *Problem,
+	ops []int,
+	gran [3]int,
+	tensorsToRetain []int,
+	traversalOrder []int,
+	residentTensors map[int]bool,
+	dataflow Dataflow,
+) (float64, error) {
+	bd, err := evaluateBreakdown(p, ops, gran, tensorsToRetain, traversalOrder, residentTensors, ReuseSnake, dataflow)
+	if err != nil {
+		return 0, err
+	}
+	return bd.Latency, nil
+}
+
+// EvaluateSubgraphBreakdown walks the same step model as
+// EvaluateSubgraphDetailed and reports where the time goes
+func EvaluateSubgraphBreakdown(
+	p *Problem,
+	ops []int,
+	gran [3]int,
+	tensorsToRetain []int,
+	traversalOrder []int,
+	residentTensors map[int]bool,
+	reuse ReuseModel,
+) (Breakdown, error) {
+	return evaluateBreakdown(p, ops, gran, tensorsToRetain, traversalOrder, residentTensors, reuse, OutputStationary)
+}
+
+// evaluateBreakdown is the step model behind every detailed evaluator.
+// Output-stationary runs all k-steps of a tile before moving on, so each
+// output tile is stored once. Input-stationary sweeps every tile once per
+// k-step, reusing input tiles along the sweep but spilling and reloading
+// the MatMul partial sums between sweeps; pointwise inputs are only read by
+// the final sweep. ReuseLRU caches tiles in the capacity the working set
+// leaves free, so under a capacity schedule p is the subgraph's view, from
+// atSubgraph.
+func evaluateBreakdown(
+	p *Problem,
+	ops []int,
+	gran [3]int,
+	tensorsToRetain []int,
+	traversalOrder []int,
+	residentTensors map[int]bool,
+	reuse ReuseModel,
+	dataflow Dataflow,
+) (Breakdown, error) {
+	return walkSteps(p, ops, gran, tensorsToRetain, traversalOrder, residentTensors, reuse, dataflow, nil)
+}
+
+// walkSteps is evaluateBreakdown that also appends every load and store it
+// charges to trace, unless trace is nil
+func walkSteps(
+	p *Problem,
+	ops []int,
+	gran [3]int,
+	tensorsToRetain []int,
+	traversalOrder []int,
+	residentTensors map[int]bool,
+	reuse ReuseModel,
+	dataflow Dataflow,
+	trace *[]MemEvent,
+) (Breakdown, error) {
+
+	var bd Breakdown
 
 	if len(ops) == 0 {
-		return 0, fmt.Errorf("empty ops")
+		return bd, fmt.Errorf("empty ops")
 	}
 
 	w, h, k := gran[0], gran[1], gran[2]
 	if w <= 0 || h <= 0 || k <= 0 {
-		return 0, fmt.Errorf("invalid granularity [%d,%d,%d]", w, h, k)
+		return bd, &GranularityError{Granularity: gran}
+	}
+
+	if Config.CheckInvariants {
+		if err := checkTopologicalOrder(p, ops); err != nil {
+			return bd, err
+		}
 	}
 
 	boundary := GetSubgraphBoundary(p, ops)
+	residentTensors = withPinned(p, residentTensors)
 
-	primaryOutput := GetOutputTensor(p, ops)
-	outT := p.Tensors[primaryOutput]
+	outT := GetOutputShape(p, ops)
 
 	nCols := CeilDiv(outT.Width, w)
 	nRows := CeilDiv(outT.Height, h)
@@ -174,14 +696,18 @@ func EvaluateSubgraphDetailed(
 	maxK := GetMaxK(p, ops)
 	nK := CeilDiv(maxK, k)
 
-	var computePerStep int64
-	for _, opIdx := range ops {
-		computePerStep += p.Ops[opIdx].BaseCost
-	}
-
-	bw := float64(p.SlowMemoryBandwidth)
+	cm := activeCostModel()
+	computePerStep := cm.ComputePerStep(p, ops, gran)
+	stepCompute := kStepCompute(cm, p, ops, gran, nK)
 
-	if traversalOrder == nil || len(traversalOrder) != nSpatial {
+	// An empty order is row-major. A shorter order of distinct tiles is a
+	// partial grid from SplitSpatial and runs only those tiles.
+	if err := checkTraversal(traversalOrder, nSpatial); err != nil {
+		return bd, err
+	}
+	if isPartialGrid(traversalOrder, nSpatial) {
+		nSpatial = len(traversalOrder)
+	} else if len(traversalOrder) == 0 {
 		traversalOrder = make([]int, nSpatial)
 		for i := 0; i < nSpatial; i++ {
 			traversalOrder[i] = i
@@ -189,38 +715,108 @@ func EvaluateSubgraphDetailed(
 	}
 
 	var boundaryInputList []tileInputInfo
-	for tIdx := range boundary.BoundaryInputs {
+	for _, tIdx := range sortedKeys(boundary.BoundaryInputs) {
 		role := InputTileRole(p, ops, tIdx)
 		size := InputTileSize(p, ops, tIdx, w, h, k)
 		full := FullTensorSize(p, tIdx)
-		boundaryInputList = append(boundaryInputList, tileInputInfo{tIdx, role, size, full})
+		kSteps := nK
+		if role == "LHS" || role == "RHS" {
+			kSteps = InputKSteps(p, ops, tIdx, k)
+		}
+		boundaryInputList = append(boundaryInputList, tileInputInfo{tIdx, role, size, full, kSteps})
 	}
 
+	// Retaining a graph output does not spare its store
 	retainSet := make(map[int]bool)
 	for _, tIdx := range tensorsToRetain {
-		retainSet[tIdx] = true
+		if !isGraphOutput(p, tIdx) {
+			retainSet[tIdx] = true
+		}
+	}
+
+	bd.SpatialTiles = nSpatial
+	bd.KSteps = nK
+
+	var cache *tileCache
+	if reuse == ReuseLRU {
+		spare := p.FastMemoryCapacity - ComputeWorkingSetWithRetained(p, ops, gran, residentTensors, tensorsToRetain)
+		cache = newTileCache(MaxInt64(spare, 0))
+	}
+
+	type stepPos struct{ step, kStep int }
+	order := make([]stepPos, 0, nSpatial*nK)
+	if dataflow == InputStationary {
+		for kStep := 0; kStep < nK; kStep++ {
+			for step := 0; step < nSpatial; step++ {
+				order = append(order, stepPos{step, kStep})
+			}
+		}
+	} else {
+		for step := 0; step < nSpatial; step++ {
+			for kStep := 0; kStep < nK; kStep++ {
+				order = append(order, stepPos{step, kStep})
+			}
+		}
+	}
+
+	// Input-stationary partial sums: one tile per MatMul output, swapped
+	// between sweeps until that MatMul's own reduction is done
+	type partialSum struct {
+		tensor int
+		size   int64
+		kSteps int
+	}
+	var partials []partialSum
+	if dataflow == InputStationary && nK > 1 {
+		for _, opIdx := range ops {
+			if op := p.Ops[opIdx]; op.OpType == "MatMul" {
+				partials = append(partials, partialSum{op.Outputs[0], OutputTileSize(p, op.Outputs[0], w, h), opKSteps(p, op, k, nK)})
+			}
+		}
 	}
 
-	totalLatency := 0.0
 	prevRow := -1
 	prevCol := -1
+	prevK := -1
 
-	for step := 0; step < nSpatial; step++ {
+	for i, pos := range order {
+		step, kStep := pos.step, pos.kStep
 		tileIdx := traversalOrder[step]
 		row := tileIdx / nCols
 		col := tileIdx % nCols
 
-		for kStep := 0; kStep < nK; kStep++ {
-			var memoryBytes int64
+		var loadBytes, storeBytes int64
+		var decompress float64
 
-			for _, info := range boundaryInputList {
-				// Check if fully resident from previous subgraph
-				if residentTensors[info.tensorIdx] {
-					continue
-				}
+		for _, info := range boundaryInputList {
+			// Check if fully resident from previous subgraph; a compressed
+			// one is decompressed wherever it would have been loaded
+			resident := residentTensors[info.tensorIdx]
+			if resident && !retainedCompressed(p, info.tensorIdx) {
+				continue
+			}
+			// A shallower MatMul's operands are used up before the last k-step
+			if kStep >= info.kSteps {
+				continue
+			}
+			// Input-stationary applies pointwise inputs in the last sweep
+			if dataflow == InputStationary && info.role == "PW" && kStep < nK-1 {
+				continue
+			}
 
-				canReuse := false
-				if step > 0 && kStep == 0 {
+			// Under ReuseNone nothing is reused: every tile is loaded again
+			canReuse := false
+			if reuse != ReuseNone && i > 0 {
+				if dataflow == InputStationary {
+					switch info.role {
+					case "LHS":
+						canReuse = kStep == prevK && row == prevRow
+					case "RHS":
+						canReuse = kStep == prevK && col == prevCol
+					case "BROADCAST":
+						canReuse = true
+					}
+				} else if kStep == 0 {
 					switch info.role {
 					case "LHS":
 						if row == prevRow {
@@ -233,43 +829,245 @@ func EvaluateSubgraphDetailed(
 					case "PW":
 						// PW inputs change every spatial tile
 						canReuse = false
+					case "BROADCAST":
+						// Broadcast inputs stay loaded for the whole subgraph
+						canReuse = true
 					}
-				} else if kStep > 0 {
+				} else {
 					// Within k-steps: PW inputs don't change with k
-					if info.role == "PW" {
+					if info.role == "PW" || info.role == "BROADCAST" {
 						canReuse = true
 					}
 					// MatMul inputs (LHS[h,k], RHS[k,w]) change with k, so need reload
 				}
+			}
+
+			if cache != nil {
+				key := tileKey{tensor: info.tensorIdx, a: tileIdx, b: 0}
+				switch info.role {
+				case "LHS":
+					key.a, key.b = row, kStep
+				case "RHS":
+					key.a, key.b = col, kStep
+				case "BROADCAST":
+					key.a = 0
+				}
+				if cache.touch(key, info.tileSize) {
+					canReuse = true
+				}
+			}
+
+			if !canReuse {
+				if resident {
+					decompress += decompressTime(p, info.tensorIdx, info.tileSize)
+				} else {
+					loadBytes += info.tileSize
+					if trace != nil {
+						x, y, tw, th := inputTileRegion(p, ops, info.tensorIdx, gran, row, col, kStep)
+						*trace = append(*trace, MemEvent{i, tileIdx, kStep, MemLoad, info.tensorIdx, x, y, tw, th, info.tileSize})
+					}
+				}
+			}
+		}
 
-				if !canReuse {
-					memoryBytes += info.tileSize
+		// Partial sums of earlier sweeps come back in; unfinished ones go
+		// out. Under ReuseLRU the cache holds those it has room for ahead of
+		// input tiles, and a held one is neither stored nor re-read.
+		for _, ps := range partials {
+			held := false
+			if cache != nil {
+				key := tileKey{tensor: ps.tensor, a: tileIdx, b: -1}
+				if kStep == 0 && ps.kSteps > 1 {
+					held = cache.hold(key, ps.size)
+				} else if held = cache.isHeld(key); held && kStep == ps.kSteps-1 {
+					cache.release(key)
+				}
+			}
+			if held {
+				continue
+			}
+			if kStep > 0 && kStep < ps.kSteps {
+				loadBytes += ps.size
+				if trace != nil {
+					*trace = append(*trace, MemEvent{i, tileIdx, kStep, MemLoad, ps.tensor, col * w, row * h, w, h, ps.size})
+				}
+			}
+			if kStep < ps.kSteps-1 {
+				storeBytes += ps.size
+				if trace != nil {
+					*trace = append(*trace, MemEvent{i, tileIdx, kStep, MemStore, ps.tensor, col * w, row * h, w, h, ps.size})
 				}
 			}
+		}
+		if cache != nil {
+			cache.evict()
+		}
 
-			// Output eviction on last k-step
-			if kStep == nK-1 {
-				for tIdx := range boundary.BoundaryOutputs {
-					if !retainSet[tIdx] {
-						memoryBytes += int64(w) * int64(h)
+		// Output eviction on last k-step
+		if kStep == nK-1 {
+			for _, tIdx := range sortedKeys(boundary.BoundaryOutputs) {
+				if !retainSet[tIdx] && !IsPinnedTensor(p, tIdx) {
+					size := OutputTileSize(p, tIdx, w, h)
+					storeBytes += size
+					if trace != nil {
+						*trace = append(*trace, MemEvent{i, tileIdx, kStep, MemStore, tIdx, col * w, row * h, w, h, size})
 					}
 				}
 			}
+		}
 
-			memTime := float64(memoryBytes) / bw
-			compTime := float64(computePerStep)
-			stepLatency := MaxFloat(compTime, memTime)
-			totalLatency += stepLatency
+		memTime := cm.LoadTime(p, loadBytes) + cm.StoreTime(p, storeBytes)
+		compTime := computePerStep
+		if stepCompute != nil {
+			compTime = stepCompute[kStep]
 		}
+		compTime += decompress
+		stepLatency := cm.StepCombine(compTime, memTime)
+
+		bd.Latency += stepLatency
+		bd.ComputeTime += compTime
+		bd.MemoryTime += memTime
+		if compTime >= memTime {
+			bd.ComputeBoundTime += stepLatency
+		} else {
+			bd.MemoryBoundTime += stepLatency
+		}
+		bd.LoadBytes += loadBytes
+		bd.StoreBytes += storeBytes
 
 		prevRow = row
 		prevCol = col
+		prevK = kStep
 	}
 
-	return totalLatency, nil
+	return bd, nil
+}
+
+// checkTopologicalOrder returns an error if some op in ops reads a tensor
+// that a later op in ops produces
+func checkTopologicalOrder(p *Problem, ops []int) error {
+	producedAt := make(map[int]int)
+	for i, opIdx := range ops {
+		for _, tIdx := range p.Ops[opIdx].Outputs {
+			producedAt[tIdx] = i
+		}
+	}
+	for i, opIdx := range ops {
+		for _, tIdx := range p.Ops[opIdx].Inputs {
+			if j, ok := producedAt[tIdx]; ok && j >= i {
+				return fmt.Errorf("ops %v not in topological order: op %d reads tensor %d before op %d produces it",
+					ops, opIdx, tIdx, ops[j])
+			}
+		}
+	}
+	return nil
+}
+
+// checkTraversal returns an error unless order is empty, which means raster
+// order, a permutation of the nSpatial tiles, or a partial grid of distinct
+// tiles from SplitSpatial. Any other order is most likely a traversal left
+// over from an earlier granularity.
+func checkTraversal(order []int, nSpatial int) error {
+	if len(order) == 0 || isPartialGrid(order, nSpatial) {
+		return nil
+	}
+	if len(order) != nSpatial {
+		return fmt.Errorf("traversal order has %d tiles, granularity gives %d", len(order), nSpatial)
+	}
+	seen := make([]bool, nSpatial)
+	for _, tileIdx := range order {
+		if tileIdx < 0 || tileIdx >= nSpatial {
+			return fmt.Errorf("traversal order visits tile %d, granularity gives %d tiles", tileIdx, nSpatial)
+		}
+		if seen[tileIdx] {
+			return fmt.Errorf("traversal order visits tile %d twice", tileIdx)
+		}
+		seen[tileIdx] = true
+	}
+	return nil
+}
+
+// tileKey identifies one input tile: LHS tiles by (row, k-step), RHS tiles
+// by (column, k-step) and pointwise tiles by spatial tile index
+type tileKey struct {
+	tensor, a, b int
+}
+
+// tileCache is an LRU set of input tiles. Tiles used by the current step
+// live in their working-set slots; older ones must fit in spare, less the
+// input-stationary partial sums held there until their reduction ends.
+type tileCache struct {
+	spare   int64
+	order   *list.List
+	entries map[tileKey]*list.Element
+	// stepBytes is the size of the tiles touched since the last evict
+	stepBytes int64
+	total     int64
+	held      map[tileKey]int64
+	heldBytes int64
+}
+
+type tileCacheEntry struct {
+	key  tileKey
+	size int64
+}
+
+func newTileCache(spare int64) *tileCache {
+	return &tileCache{spare: spare, order: list.New(), entries: make(map[tileKey]*list.Element), held: make(map[tileKey]int64)}
+}
+
+// hold keeps a partial sum in spare, evicting input tiles at the next evict
+// if needed. It returns false if the held partial sums leave no room.
+func (c *tileCache) hold(key tileKey, size int64) bool {
+	if c.heldBytes+size > c.spare {
+		return false
+	}
+	c.held[key] = size
+	c.heldBytes += size
+	return true
+}
+
+// isHeld reports whether the partial sum key is held
+func (c *tileCache) isHeld(key tileKey) bool {
+	_, ok := c.held[key]
+	return ok
+}
+
+// release frees a held partial sum whose reduction is complete
+func (c *tileCache) release(key tileKey) {
+	c.heldBytes -= c.held[key]
+	delete(c.held, key)
+}
+
+// touch marks key as most recently used and reports whether it was cached
+func (c *tileCache) touch(key tileKey, size int64) bool {
+	c.stepBytes += size
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return true
+	}
+	c.entries[key] = c.order.PushFront(tileCacheEntry{key, size})
+	c.total += size
+	return false
+}
+
+// evict drops least recently used tiles until the older tiles fit in the
+// spare room held partial sums leave
+func (c *tileCache) evict() {
+	for c.total > c.spare-c.heldBytes+c.stepBytes && c.order.Len() > 0 {
+		e := c.order.Back()
+		entry := e.Value.(tileCacheEntry)
+		c.order.Remove(e)
+		delete(c.entries, entry.key)
+		c.total -= entry.size
+	}
+	c.stepBytes = 0
 }
 
-// QuickEstimate provides a fast latency estimate for search purposes
+// QuickEstimate provides a fast latency estimate for search purposes. The
+// first step cold-loads a tile of every input and is combined on its own;
+// the remaining steps are combined as averaged totals with snake reuse, so
+// subgraphs of one or a few steps are estimated as the evaluator runs them.
 func QuickEstimate(
 	p *Problem,
 	ops []int,
@@ -286,8 +1084,8 @@ func QuickEstimate(
 	}
 
 	boundary := GetSubgraphBoundary(p, ops)
-	primaryOutput := GetOutputTensor(p, ops)
-	outT := p.Tensors[primaryOutput]
+	residentTensors = withPinned(p, residentTensors)
+	outT := GetOutputShape(p, ops)
 
 	nCols := CeilDiv(outT.Width, w)
 	nRows := CeilDiv(outT.Height, h)
@@ -296,45 +1094,102 @@ func QuickEstimate(
 	maxK := GetMaxK(p, ops)
 	nK := CeilDiv(maxK, k)
 
-	var computePerStep int64
-	for _, opIdx := range ops {
-		computePerStep += p.Ops[opIdx].BaseCost
-	}
+	cm := activeCostModel()
 
-	bw := float64(p.SlowMemoryBandwidth)
-
-	// Estimate memory with snake reuse
-	var totalMemory float64
+	// Estimate memory with snake reuse; resident compressed tensors are
+	// decompressed as often as they would have been loaded. The first step
+	// loads or decompresses one tile of each.
+	var totalMemory, totalDecompress float64
+	var firstMemory, firstDecompress float64
 
 	for tIdx := range boundary.BoundaryInputs {
-		if residentTensors[tIdx] {
+		resident := residentTensors[tIdx]
+		if resident && !retainedCompressed(p, tIdx) {
 			continue
 		}
 		role := InputTileRole(p, ops, tIdx)
-		tileSize := float64(InputTileSize(p, ops, tIdx, w, h, k))
+		tileSize := InputTileSize(p, ops, tIdx, w, h, k)
 
+		var loads float64
 		switch role {
 		case "LHS":
 			// LHS reused across columns in same row
-			totalMemory += tileSize * float64(nRows) * float64(nK)
+			loads = float64(nRows) * float64(InputKSteps(p, ops, tIdx, k))
 		case "RHS":
 			// RHS reused across rows in same column
-			totalMemory += tileSize * float64(nCols) * float64(nK)
+			loads = float64(nCols) * float64(InputKSteps(p, ops, tIdx, k))
 		case "PW":
 			// PW loaded every spatial tile
-			totalMemory += tileSize * float64(nSpatial)
+			loads = float64(nSpatial)
+		case "BROADCAST":
+			// Broadcast loaded once
+			loads = 1
+		}
+
+		if resident {
+			totalDecompress += decompressTime(p, tIdx, tileSize) * loads
+			firstDecompress += decompressTime(p, tIdx, tileSize)
+		} else {
+			totalMemory += float64(tileSize) * loads
+			firstMemory += float64(tileSize)
+		}
+	}
+
+	// Output eviction, which the first step does only without k-steps
+	var totalStore, firstStore float64
+	for tIdx := range boundary.BoundaryOutputs {
+		if !IsPinnedTensor(p, tIdx) {
+			totalStore += float64(OutputTileSize(p, tIdx, w, h)) * float64(nSpatial)
+			if nK == 1 {
+				firstStore += float64(OutputTileSize(p, tIdx, w, h))
+			}
+		}
+	}
+
+	perStep := cm.ComputePerStep(p, ops, gran)
+	tileCompute, firstCompute := perStep*float64(nK), perStep
+	if stepCompute := kStepCompute(cm, p, ops, gran, nK); stepCompute != nil {
+		tileCompute, firstCompute = 0, stepCompute[0]
+		for _, c := range stepCompute {
+			tileCompute += c
 		}
 	}
+	totalCompute := tileCompute*float64(nSpatial) + totalDecompress
+	firstCompute += firstDecompress
 
-	// Output eviction
-	for range boundary.BoundaryOutputs {
-		totalMemory += float64(int64(w)*int64(h)) * float64(nSpatial)
+	first := cm.StepCombine(firstCompute, cm.LoadTime(p, int64(firstMemory))+cm.StoreTime(p, int64(firstStore)))
+	if nSpatial*nK == 1 {
+		return first
 	}
+	restMemTime := cm.LoadTime(p, int64(totalMemory-firstMemory)) + cm.StoreTime(p, int64(totalStore-firstStore))
+	return first + cm.StepCombine(totalCompute-firstCompute, restMemTime)
+}
 
-	totalCompute := float64(computePerStep) * float64(nSpatial) * float64(nK)
-	totalMemTime := totalMemory / bw
+// ComputeLowerBound returns a latency no schedule can beat under the active
+// cost model: the least compute of every live op, plus the overhead of one
+// subgraph. An op runs in at least one step, whose compute is least with a
+// 1x1 tile, and across its k-steps it reduces over all of its K; a step
+// takes at least its compute time. This holds for both roofline compute
+// models and any CostModel whose compute grows with the tile and adds up
+// across ops. Memory traffic is left out: tiles follow one output's grid,
+// so a fused op may read only part of an input and no load or store is
+// certain.
+func ComputeLowerBound(p *Problem) float64 {
+	cm := activeCostModel()
+	var gi *GraphInfo
+	if len(p.OutputTensors) > 0 {
+		gi = AnalyzeGraph(p)
+	}
 
-	return MaxFloat(totalCompute, totalMemTime)
+	var compute float64
+	for i, live := range LiveOps(p, gi) {
+		ops := []int{i}
+		if !live || isZeroSized(GetOutputShape(p, ops)) {
+			continue
+		}
+		compute += cm.ComputePerStep(p, ops, [3]int{1, 1, GetMaxK(p, ops)})
+	}
+	return compute + Config.PerSubgraphOverhead
 }
 
 func EvaluateSolution(p *Problem, sol *Solution) (float64, error) {
@@ -344,35 +1199,79 @@ func EvaluateSolution(p *Problem, sol *Solution) (float64, error) {
 			coveredOps[opIdx] = true
 		}
 	}
-	for i := range p.Ops {
-		if !coveredOps[i] {
-			return 0, fmt.Errorf("op %d not covered", i)
+	// Dead ops need not run. Only declared outputs can make an op dead,
+	// so the graph is analyzed only then.
+	var gi *GraphInfo
+	if len(p.OutputTensors) > 0 {
+		gi = AnalyzeGraph(p)
+	}
+	for i, live := range LiveOps(p, gi) {
+		if live && !coveredOps[i] {
+			return 0, &OpNotCoveredError{OpIdx: i}
+		}
+	}
+	for i, sg := range sol.Subgraphs {
+		if p.MaxSubgraphOps > 0 && len(sg.Ops) > p.MaxSubgraphOps {
+			return 0, fmt.Errorf("subgraph %d has %d ops, limit is %d", i, len(sg.Ops), p.MaxSubgraphOps)
+		}
+		if !fusible(p, sg.Ops) {
+			return 0, fmt.Errorf("subgraph %d fuses an unfusable op", i)
 		}
 	}
+	if err := checkTileCoverage(p, sol); err != nil {
+		return 0, err
+	}
 
 	totalLatency := 0.0
 	resident := make(map[int]bool)
+	ran := 0
 
 	for i, sg := range sol.Subgraphs {
-		ws := ComputeWorkingSet(p, sg.Ops, sg.Granularity, resident)
-		if ws > p.FastMemoryCapacity {
-			return 0, fmt.Errorf("subgraph %d: working set %d exceeds capacity %d", i, ws, p.FastMemoryCapacity)
+		pi := p.atSubgraph(i).withPrimaryOutput(sg.PrimaryOutput)
+		if t := sg.PrimaryOutput; t != nil && !GetSubgraphBoundary(p, sg.Ops).AllProduced[*t] {
+			return 0, fmt.Errorf("subgraph %d: primary output %d is not produced by ops %v", i, *t, sg.Ops)
+		}
+		if len(sg.Ops) > 0 && isZeroSized(GetOutputShape(pi, sg.Ops)) {
+			fmt.Fprintf(progress, "  WARNING: subgraph %d: output of ops %v has a zero dimension, skipping\n", i, sg.Ops)
+			resident = residentAfter(p, sol.Subgraphs, i, resident)
+			continue
+		}
+
+		ws := ComputeWorkingSet(pi, sg.Ops, sg.Granularity, resident)
+		if capacity := p.CapacityAt(i); ws > capacity {
+			return 0, &WorkingSetError{SubgraphIdx: i, WorkingSet: ws, Capacity: capacity}
 		}
 
-		lat, err := EvaluateSubgraphDetailed(
-			p, sg.Ops, sg.Granularity, sg.TensorsToRetain,
-			sg.TraversalOrder, resident,
+		if err := checkTraversal(sg.TraversalOrder, gridTiles(pi, sg.Ops, sg.Granularity)); err != nil {
+			return 0, fmt.Errorf("subgraph %d: %w", i, err)
+		}
+
+		// A tensor can be kept only if this subgraph has it: it produced or
+		// read it, or holds it resident from an earlier subgraph. A resident
+		// tensor it does not use stays resident without being listed while
+		// a later subgraph reads it; see residentAfter.
+		boundary := GetSubgraphBoundary(p, sg.Ops)
+		for _, tIdx := range sg.TensorsToRetain {
+			if !boundary.AllProduced[tIdx] && !boundary.AllConsumed[tIdx] && !resident[tIdx] {
+				return 0, &RetentionError{SubgraphIdx: i, TensorIdx: tIdx}
+			}
+		}
+
+		lat, err := EvaluateSubgraphDataflow(
+			pi, sg.Ops, sg.Granularity, sg.TensorsToRetain,
+			sg.TraversalOrder, resident, sg.Dataflow,
 		)
 		if err != nil {
 			return 0, fmt.Errorf("subgraph %d: %w", i, err)
 		}
 
-		totalLatency += lat
-
-		resident = make(map[int]bool)
-		for _, tIdx := range sg.TensorsToRetain {
-			resident[tIdx] = true
+		totalLatency += roundLatency(lat) + Config.PerSubgraphOverhead
+		if ran > 0 {
+			totalLatency += Config.ContextSwitchCost
 		}
+		ran++
+
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
 	}
 
 	return totalLatency, nil
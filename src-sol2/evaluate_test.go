@@ -0,0 +1,562 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// referenceResidentInputWorkingSet is what src's ComputeWorkingSet reports
+// for residentInputProblem: the resident input counts as one 32x32 tile.
+const referenceResidentInputWorkingSet = 32*32 + 32*32 + 64*64
+
+// residentInputProblem is the case src and src-sol1 also test: a pointwise
+// op reading tensor 0, with tensor 0 and the unrelated tensor 2 retained
+// from the previous subgraph.
+func residentInputProblem() (*Problem, []int, [3]int, map[int]bool) {
+	p := &Problem{
+		Tensors:            []Tensor{{Width: 128, Height: 128}, {Width: 128, Height: 128}, {Width: 64, Height: 64}},
+		Ops:                []Op{{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 10}},
+		FastMemoryCapacity: 1 << 20,
+		NativeGranularity:  [2]int{128, 128},
+	}
+	return p, []int{0}, [3]int{32, 32, 1}, map[int]bool{0: true, 2: true}
+}
+
+// TestComputeWorkingSetResidentInput checks that a resident input counts
+// whole, as in src-sol1, and never below the reference's tile-sized count.
+func TestComputeWorkingSetResidentInput(t *testing.T) {
+	p, ops, gran, resident := residentInputProblem()
+	got := ComputeWorkingSet(p, ops, gran, resident)
+	if want := int64(128*128 + 32*32 + 64*64); got != want {
+		t.Errorf("ComputeWorkingSet = %d, want %d", got, want)
+	}
+	if got < referenceResidentInputWorkingSet {
+		t.Errorf("ComputeWorkingSet = %d, below the reference's %d", got, referenceResidentInputWorkingSet)
+	}
+}
+
+// scaledCostModel is the roofline model with compute scaled by factor
+type scaledCostModel struct {
+	RooflineCostModel
+	factor float64
+}
+
+func (m scaledCostModel) ComputePerStep(p *Problem, ops []int, gran [3]int) float64 {
+	return m.factor * m.RooflineCostModel.ComputePerStep(p, ops, gran)
+}
+
+// TestComputeLowerBound checks the bound never exceeds the latency the
+// solver reaches, under both compute models. mlsys-2026-13 once beat it.
+func TestComputeLowerBound(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+
+	for _, model := range []ComputeModel{ComputeBaseCost, ComputeFLOPs} {
+		Config.ComputeModel = model
+		for _, name := range []string{"mlsys-2026-1", "mlsys-2026-5", "mlsys-2026-13"} {
+			p, err := ReadProblem("../benchmarks/" + name + ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sol, err := SolveOptimized(p)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			lat, err := EvaluateSolution(p, sol)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if lb := ComputeLowerBound(p); lb > lat {
+				t.Errorf("%s, %v: lower bound %.1f exceeds latency %.1f", name, model, lb, lat)
+			}
+		}
+	}
+}
+
+// TestComputeLowerBoundCostModel checks the bound prices compute with
+// Config.CostModel
+func TestComputeLowerBoundCostModel(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+
+	p, err := ReadProblem("../benchmarks/mlsys-2026-1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := ComputeLowerBound(p)
+	Config.CostModel = scaledCostModel{factor: 3}
+	if got := ComputeLowerBound(p); !FloatEqual(got, 3*base, 1e-9, 0) {
+		t.Errorf("ComputeLowerBound = %.1f under 3x compute, want %.1f", got, 3*base)
+	}
+}
+
+// TestGetOutputTensor checks that the grid comes from the last op's first
+// output whenever the reference evaluator would take a boundary output, and
+// from the true boundary output when that tensor is ephemeral.
+func TestGetOutputTensor(t *testing.T) {
+	p := &Problem{
+		Tensors: []Tensor{{Width: 64, Height: 64}, {Width: 64, Height: 64}, {Width: 128, Height: 256}, {Width: 256, Height: 256}},
+		Ops: []Op{
+			{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 10},
+			{OpType: "Pointwise", Inputs: []int{1}, Outputs: []int{2}, BaseCost: 10},
+			{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{3}, BaseCost: 10},
+		},
+	}
+	for _, tc := range []struct {
+		ops  []int
+		want int
+	}{
+		// Op 0's output is ephemeral, consumed by op 1 listed before it
+		{[]int{1, 0}, 2},
+		// In topological order the last op's first output is a boundary
+		// output, and it wins over the larger tensor 3 as in the reference
+		{[]int{2, 0}, 1},
+		{[]int{0, 2}, 3},
+		{[]int{0, 1}, 2},
+		{nil, -1},
+	} {
+		if got := GetOutputTensor(p, tc.ops); got != tc.want {
+			t.Errorf("GetOutputTensor(%v) = %d, want %d", tc.ops, got, tc.want)
+		}
+	}
+}
+
+// TestKStepsPerMatMul fuses a K=512 MatMul, a K=128 MatMul and an add at
+// k=128. The shallow MatMul runs and loads its operands in the first of the
+// four k-steps only. The reference evaluator charges every op on every
+// k-step, 4 * 2100 = 8400.
+func TestKStepsPerMatMul(t *testing.T) {
+	p := &Problem{
+		Tensors: []Tensor{
+			{Width: 512, Height: 128}, {Width: 128, Height: 512}, {Width: 128, Height: 128},
+			{Width: 128, Height: 128}, {Width: 128, Height: 128}, {Width: 128, Height: 128}, {Width: 128, Height: 128},
+		},
+		Ops: []Op{
+			{OpType: "MatMul", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 1000},
+			{OpType: "MatMul", Inputs: []int{3, 4}, Outputs: []int{5}, BaseCost: 1000},
+			{OpType: "Pointwise", Inputs: []int{2, 5}, Outputs: []int{6}, BaseCost: 100},
+		},
+		FastMemoryCapacity:  1 << 30,
+		SlowMemoryBandwidth: 1 << 30,
+		NativeGranularity:   [2]int{128, 128},
+	}
+	ops, gran := []int{0, 1, 2}, [3]int{128, 128, 128}
+	bd, err := evaluateBreakdown(p, ops, gran, nil, nil, nil, ReuseSnake, OutputStationary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2100.0 + 3*1100; bd.ComputeTime != want {
+		t.Errorf("compute = %.0f, want %.0f", bd.ComputeTime, want)
+	}
+	// Tensors 0 and 1 load in all four k-steps, tensors 3 and 4 in the first
+	if want := int64(10 * 128 * 128); bd.LoadBytes != want {
+		t.Errorf("loads = %d, want %d", bd.LoadBytes, want)
+	}
+	if got := QuickEstimate(p, ops, gran, nil); got != 5400 {
+		t.Errorf("QuickEstimate = %.1f, want 5400", got)
+	}
+}
+
+// TestEvaluateSubgraphTraversal checks a traversal order that does not fit
+// the granularity's grid is an error rather than silently run row-major
+func TestEvaluateSubgraphTraversal(t *testing.T) {
+	p := chainProblem(1)
+	gran := [3]int{128, 128, 1} // 2x2 tiles
+	for _, tc := range []struct {
+		order []int
+		want  string
+	}{
+		{nil, ""},
+		{[]int{3, 2, 1, 0}, ""},
+		{[]int{1, 3}, ""}, // partial grid from SplitSpatial
+		{[]int{0, 1, 2, 3, 4, 5, 6, 7, 8}, "traversal order has 9 tiles, granularity gives 4"},
+		{[]int{0, 1, 2, 4}, "visits tile 4"},
+		{[]int{0, 1, 1, 2}, "visits tile 1 twice"},
+	} {
+		_, err := EvaluateSubgraphDetailed(p, []int{0}, gran, nil, tc.order, nil, ReuseNone)
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("order %v: unexpected error %v", tc.order, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Errorf("order %v: error %v, want %q", tc.order, err, tc.want)
+		}
+	}
+}
+
+// TestIsGraphOutputIndex checks the index indexGraphOutputs builds agrees
+// with scanning the ops, for declared outputs and unread op outputs alike
+func TestIsGraphOutputIndex(t *testing.T) {
+	declared := chainProblem(3)
+	declared.OutputTensors = []int{1}
+	for _, tc := range []struct {
+		p    *Problem
+		want []int
+	}{
+		{chainProblem(3), []int{3}},
+		{declared, []int{1, 3}},
+	} {
+		scanned := *tc.p
+		tc.p.indexGraphOutputs()
+		var got []int
+		for tIdx := range tc.p.Tensors {
+			if isGraphOutput(tc.p, tIdx) {
+				got = append(got, tIdx)
+			}
+			if isGraphOutput(&scanned, tIdx) != isGraphOutput(tc.p, tIdx) {
+				t.Errorf("tensor %d: index and scan disagree", tIdx)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("outputs %v, want %v", got, tc.want)
+		}
+	}
+}
+
+// TestPrimaryOutputGrid builds a subgraph whose last op writes a small
+// 128x128 output while a 512x512 tensor also leaves it. GetOutputTensor
+// picks the small one; naming the large one as the primary output tiles
+// the larger grid, in the evaluator and in EvaluateSolution alike.
+func TestPrimaryOutputGrid(t *testing.T) {
+	p := &Problem{
+		Tensors: []Tensor{{Width: 512, Height: 512}, {Width: 512, Height: 512}, {Width: 128, Height: 128}, {Width: 512, Height: 512}},
+		Ops: []Op{
+			{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 1000},
+			{OpType: "Pointwise", Inputs: []int{1}, Outputs: []int{2}, BaseCost: 1000},
+			{OpType: "Pointwise", Inputs: []int{1}, Outputs: []int{3}, BaseCost: 1000},
+		},
+		FastMemoryCapacity:  1 << 20,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{128, 128},
+	}
+	ops, gran := []int{0, 1}, [3]int{128, 128, 1}
+	large := 1
+
+	for _, tc := range []struct {
+		primary    *int
+		wantTensor int
+		wantTiles  int
+	}{
+		{nil, 2, 1},
+		{&large, 1, 16},
+	} {
+		view := p.withPrimaryOutput(tc.primary)
+		if got := GetOutputTensor(view, ops); got != tc.wantTensor {
+			t.Errorf("primary %v: output tensor %d, want %d", tc.primary, got, tc.wantTensor)
+		}
+		bd, err := EvaluateSubgraphBreakdown(view, ops, gran, nil, nil, nil, ReuseSnake)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bd.SpatialTiles != tc.wantTiles {
+			t.Errorf("primary %v: %d spatial tiles, want %d", tc.primary, bd.SpatialTiles, tc.wantTiles)
+		}
+
+		sol := &Solution{Subgraphs: []Subgraph{
+			{Ops: ops, Granularity: gran, PrimaryOutput: tc.primary},
+			{Ops: []int{2}, Granularity: [3]int{128, 128, 1}},
+		}}
+		total, err := EvaluateSolution(p, sol)
+		if err != nil {
+			t.Fatalf("primary %v: %v", tc.primary, err)
+		}
+		rest, err := EvaluateSubgraphDetailed(p, []int{2}, [3]int{128, 128, 1}, nil, nil, nil, ReuseSnake)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := bd.Latency + rest; math.Abs(total-want) > 1e-6 {
+			t.Errorf("primary %v: EvaluateSolution %.1f, want %.1f", tc.primary, total, want)
+		}
+
+		file := filepath.Join(t.TempDir(), "solution.json")
+		if err := WriteSolution(file, p, sol); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadSolution(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := read.Subgraphs[0].PrimaryOutput; !reflect.DeepEqual(got, tc.primary) {
+			t.Errorf("primary %v: read back %v", tc.primary, got)
+		}
+	}
+
+	// The granularity search sizes its candidates by the primary output
+	if g := FindBestGranularity(p, ops, nil); g[0] > 128 || g[1] > 128 {
+		t.Errorf("heuristic primary: granularity %v exceeds the 128x128 output", g)
+	}
+	if g := FindBestGranularity(p.withPrimaryOutput(&large), ops, nil); g[0] <= 128 && g[1] <= 128 {
+		t.Errorf("explicit primary: granularity %v, want one wider than 128 over the 512x512 output", g)
+	}
+}
+
+// TestEvaluateSolutionCarry checks a skip-one-subgraph reuse: subgraph 0
+// retains tensor 1, subgraph 1 neither reads nor lists it, and subgraph 2
+// reads it. It stays resident through subgraph 1, taking room there, unless
+// subgraph 1 drops it once it finishes and subgraph 2 loads it again. The written solution
+// lists it after subgraph 1 when it is carried.
+func TestEvaluateSolutionCarry(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+	Config.PerSubgraphOverhead = 0
+	Config.ContextSwitchCost = 0
+
+	tensor := Tensor{Width: 128, Height: 128}
+	p := &Problem{
+		Tensors: []Tensor{tensor, tensor, tensor, tensor, tensor},
+		Ops: []Op{
+			{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 1000},
+			{OpType: "Pointwise", Inputs: []int{2}, Outputs: []int{3}, BaseCost: 1000},
+			{OpType: "Pointwise", Inputs: []int{1}, Outputs: []int{4}, BaseCost: 1000},
+		},
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{128, 128},
+	}
+	gran := [3]int{128, 128, 1}
+	solution := func(drop []int) *Solution {
+		return &Solution{Subgraphs: []Subgraph{
+			{Ops: []int{0}, Granularity: gran, TensorsToRetain: []int{1}},
+			{Ops: []int{1}, Granularity: gran, TensorsToDrop: drop},
+			{Ops: []int{2}, Granularity: gran},
+		}}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		capacity int64
+		drop     []int
+		resident [][]int // what each subgraph starts with
+		written  [][]int
+		errAt    int // subgraph a WorkingSetError names, or -1
+	}{
+		{"carried", 1 << 20, nil, [][]int{{}, {1}, {1}}, [][]int{{1}, {1}, {}}, -1},
+		{"dropped", 1 << 20, []int{1}, [][]int{{}, {1}, {}}, [][]int{{1}, {}, {}}, -1},
+		{"carried over capacity", 40000, nil, nil, nil, 1},
+	} {
+		p.FastMemoryCapacity = tc.capacity
+		sol := solution(tc.drop)
+		total, err := EvaluateSolution(p, sol)
+		if tc.errAt >= 0 {
+			var wsErr *WorkingSetError
+			if !errors.As(err, &wsErr) || wsErr.SubgraphIdx != tc.errAt {
+				t.Errorf("%s: error %v, want a working set error at subgraph %d", tc.name, err, tc.errAt)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		want := 0.0
+		for i, sg := range sol.Subgraphs {
+			lat, err := EvaluateSubgraphDataflow(p, sg.Ops, sg.Granularity, sg.TensorsToRetain, nil, residentFrom(tc.resident[i]), sg.Dataflow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want += roundLatency(lat)
+		}
+		if math.Abs(total-want) > 1e-6 {
+			t.Errorf("%s: latency %.1f, want %.1f", tc.name, total, want)
+		}
+
+		file := filepath.Join(t.TempDir(), "solution.json")
+		if err := WriteSolution(file, p, sol); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadSolution(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, sg := range read.Subgraphs {
+			if got := append([]int{}, sg.TensorsToRetain...); !reflect.DeepEqual(got, tc.written[i]) {
+				t.Errorf("%s: subgraph %d written with %v, want %v", tc.name, i, got, tc.written[i])
+			}
+		}
+		if lat, err := EvaluateSolution(p, read); err != nil || math.Abs(lat-total) > 1e-6 {
+			t.Errorf("%s: read back latency %.1f (%v), want %.1f", tc.name, lat, err, total)
+		}
+	}
+
+	p.FastMemoryCapacity = 1 << 20
+	carried, _ := EvaluateSolution(p, solution(nil))
+	dropped, _ := EvaluateSolution(p, solution([]int{1}))
+	if !latencyLess(carried, dropped) {
+		t.Errorf("carried latency %.1f, want below dropped %.1f", carried, dropped)
+	}
+}
+
+// TestBroadcastInputLoadedOnce checks a bias, row or scalar added pointwise
+// to a 512x512 tensor is loaded once for the subgraph, not once per tile,
+// while the full-size input is loaded tile by tile
+func TestBroadcastInputLoadedOnce(t *testing.T) {
+	square := Tensor{Width: 512, Height: 512}
+	for _, tc := range []struct {
+		name string
+		bias Tensor
+	}{
+		{"row", Tensor{Width: 512, Height: 1}},
+		{"column", Tensor{Width: 1, Height: 512}},
+		{"scalar", Tensor{Width: 1, Height: 1}},
+	} {
+		p := &Problem{
+			Tensors:             []Tensor{square, tc.bias, square},
+			Ops:                 []Op{{OpType: "Pointwise", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 1000}},
+			FastMemoryCapacity:  1 << 20,
+			SlowMemoryBandwidth: 10,
+			NativeGranularity:   [2]int{128, 128},
+		}
+		ops := []int{0}
+		if role := InputTileRole(p, ops, 1); role != "BROADCAST" {
+			t.Errorf("%s: bias role %s, want BROADCAST", tc.name, role)
+		}
+		if role := InputTileRole(p, ops, 0); role != "PW" {
+			t.Errorf("%s: input role %s, want PW", tc.name, role)
+		}
+
+		bd, err := evaluateBreakdown(p, ops, [3]int{128, 128, 1}, nil, nil, nil, ReuseSnake, OutputStationary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := FullTensorSize(p, 0) + FullTensorSize(p, 1); bd.LoadBytes != want {
+			t.Errorf("%s: loaded %d over 16 tiles, want %d", tc.name, bd.LoadBytes, want)
+		}
+	}
+}
+
+// TestStoreBandwidth checks output eviction runs at StoreBandwidth while
+// loads keep SlowMemoryBandwidth, so halving the store bandwidth makes an
+// evicting subgraph costlier and leaves one that retains its output alone
+func TestStoreBandwidth(t *testing.T) {
+	// The first of two 256x256 pointwise ops at 128x128: each of the 4
+	// tiles loads and stores 16384 elements against 1000 compute
+	const tile = 128 * 128
+	for _, tc := range []struct {
+		name    string
+		storeBW int64
+		retain  []int
+		want    float64
+	}{
+		{"default", 0, nil, 4 * (tile/10.0 + tile/10.0)},
+		{"equal", 10, nil, 4 * (tile/10.0 + tile/10.0)},
+		{"half", 5, nil, 4 * (tile/10.0 + tile/5.0)},
+		{"retained default", 0, []int{1}, 4 * tile / 10.0},
+		{"retained half", 5, []int{1}, 4 * tile / 10.0},
+	} {
+		p := chainProblem(2)
+		p.StoreBandwidth = tc.storeBW
+		got, err := EvaluateSubgraphDetailed(p, []int{0}, [3]int{128, 128, 1}, tc.retain, nil, nil, ReuseNone)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if math.Abs(got-tc.want) > 1e-6 {
+			t.Errorf("%s: latency %.1f, want %.1f", tc.name, got, tc.want)
+		}
+	}
+
+	// The JSON key is optional and defaults to the load bandwidth
+	for _, tc := range []struct{ key, want int64 }{{0, 10}, {4, 4}} {
+		pj := validProblemJSON()
+		pj.StoreBandwidth = tc.key
+		p, err := problemFromJSON(pj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := StoreBandwidth(p); got != float64(tc.want) {
+			t.Errorf("store_bandwidth %d: StoreBandwidth = %g, want %d", tc.key, got, tc.want)
+		}
+	}
+}
+
+// TestPinnedTensor checks a pinned weight read by two subgraphs is never
+// loaded, and takes its full size from the capacity of every subgraph
+func TestPinnedTensor(t *testing.T) {
+	const full, tile = 256 * 256, 128 * 128
+	for _, tc := range []struct {
+		name   string
+		pinned []int
+		// Per subgraph, at 128x128 over a 2x2 grid
+		wantLoad int64
+		wantWS   int64
+	}{
+		{"unpinned", nil, 2 * full, 3 * tile},
+		{"pinned", []int{1}, full, 2*tile + full},
+	} {
+		// Two pointwise ops each adding the 256x256 weight T1
+		square := Tensor{Width: 256, Height: 256}
+		p := &Problem{
+			Tensors: []Tensor{square, square, square, square},
+			Ops: []Op{
+				{OpType: "Pointwise", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 1000},
+				{OpType: "Pointwise", Inputs: []int{2, 1}, Outputs: []int{3}, BaseCost: 1000},
+			},
+			FastMemoryCapacity:  1 << 20,
+			SlowMemoryBandwidth: 10,
+			NativeGranularity:   [2]int{128, 128},
+		}
+		p.PinnedTensors = tc.pinned
+		gran := [3]int{128, 128, 1}
+
+		for _, opIdx := range []int{0, 1} {
+			bd, err := evaluateBreakdown(p, []int{opIdx}, gran, nil, nil, nil, ReuseSnake, OutputStationary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bd.LoadBytes != tc.wantLoad {
+				t.Errorf("%s: op %d loaded %d, want %d", tc.name, opIdx, bd.LoadBytes, tc.wantLoad)
+			}
+			if ws := ComputeWorkingSet(p, []int{opIdx}, gran, nil); ws != tc.wantWS {
+				t.Errorf("%s: op %d working set %d, want %d", tc.name, opIdx, ws, tc.wantWS)
+			}
+		}
+
+		p.FastMemoryCapacity = full - 1
+		err := CheckMinimumFootprint(p)
+		if tc.pinned == nil && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if want := "pinned tensors [1] need 65536, capacity is 65535"; tc.pinned != nil && (err == nil || err.Error() != want) {
+			t.Errorf("%s: error %v, want %q", tc.name, err, want)
+		}
+	}
+}
+
+// TestReuseModelOrder checks the cold-cache model is never cheaper than
+// snake reuse, and snake never cheaper than LRU, for the same subgraph
+func TestReuseModelOrder(t *testing.T) {
+	square := Tensor{Width: 512, Height: 512}
+	matmul := &Problem{
+		Tensors:             []Tensor{square, square, square},
+		Ops:                 []Op{{OpType: "MatMul", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 100}},
+		FastMemoryCapacity:  1 << 22,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{128, 128},
+	}
+	for _, tc := range []struct {
+		name string
+		p    *Problem
+		ops  []int
+		gran [3]int
+		// Whether reuse must make the subgraph strictly cheaper
+		strict bool
+	}{
+		{"matmul full K", matmul, []int{0}, [3]int{128, 128, 512}, true},
+		{"matmul split K", matmul, []int{0}, [3]int{128, 128, 128}, true},
+		{"matmul one tile", matmul, []int{0}, [3]int{512, 512, 512}, false},
+		{"pointwise chain", chainProblem(3), []int{0, 1, 2}, [3]int{64, 64, 1}, false},
+	} {
+		var lat [3]float64
+		for i, reuse := range []ReuseModel{ReuseNone, ReuseSnake, ReuseLRU} {
+			var err error
+			lat[i], err = EvaluateSubgraphDetailed(tc.p, tc.ops, tc.gran, nil, nil, nil, reuse)
+			if err != nil {
+				t.Fatalf("%s %v: %v", tc.name, reuse, err)
+			}
+		}
+		if lat[0] < lat[1] || lat[1] < lat[2] {
+			t.Errorf("%s: none %.1f, snake %.1f, lru %.1f, want none >= snake >= lru", tc.name, lat[0], lat[1], lat[2])
+		}
+		if tc.strict && !(lat[0] > lat[1] && lat[1] > lat[2]) {
+			t.Errorf("%s: none %.1f, snake %.1f, lru %.1f, want each strictly cheaper", tc.name, lat[0], lat[1], lat[2])
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// SolveFast is a quick approximate solver for interactive what-if runs. It
+// fuses chains greedily, without the DP or cross-chain fusion, sizes every
+// subgraph with fastGranularity instead of a candidate search, and plans
+// retention one subgraph ahead with PlanRetentionSimple. The solution is
+// verified like SolveOptimized's, so it is valid, but its latency is usually
+// higher.
+func SolveFast(p *Problem, gi *GraphInfo) (*Solution, error) {
+	var groups [][]int
+	for _, chain := range FindLinearChains(p, gi) {
+		groups = append(groups, fuseChainGreedy(p, gi, chain, make(map[int]bool), nil, tryFuseFast)...)
+	}
+	schedule := BuildSchedule(p, gi, groups)
+
+	nextGran := func(i int) [3]int {
+		if i+1 >= len(schedule) {
+			return [3]int{}
+		}
+		gran, _ := fastGranularity(p.atSubgraph(i+1), schedule[i+1].Ops, nil)
+		return gran
+	}
+	evaluate := func(i int, resident map[int]bool) {
+		entry := &schedule[i]
+		lat, err := EvaluateSubgraphDetailed(p, entry.Ops, entry.Granularity, entry.Retain, entry.Traversal, resident, ReuseSnake)
+		if err != nil {
+			lat = 0
+		}
+		entry.Latency = lat
+	}
+
+	resident := make(map[int]bool)
+	prevResident := make(map[int]bool)
+	for i := range schedule {
+		entry := &schedule[i]
+		pi := p.atSubgraph(i)
+		gran, ok := fastGranularity(pi, entry.Ops, resident)
+		if !ok && len(resident) > 0 {
+			// Give up the previous retention rather than the tile size
+			schedule[i-1].Retain = []int{}
+			schedule[i-1].Drop = sortedKeys(prevResident)
+			evaluate(i-1, prevResident)
+			resident = make(map[int]bool)
+			gran, ok = fastGranularity(pi, entry.Ops, resident)
+		}
+		if !ok {
+			gran = FindBestGranularity(pi, entry.Ops, resident)
+		}
+		entry.Granularity = gran
+		entry.Traversal = BestTraversal(p, entry.Ops, gran)
+
+		entry.Retain = []int{}
+		entry.Drop = sortedKeys(resident)
+		if i+1 < len(schedule) {
+			retain := PlanRetentionSimple(p, entry.Ops, schedule[i+1].Ops, gran, nextGran(i), resident, i+1)
+			if ComputeWorkingSetWithRetained(p, entry.Ops, gran, resident, retain) <= pi.FastMemoryCapacity {
+				entry.Retain = retain
+			}
+		}
+		evaluate(i, resident)
+
+		prevResident, resident = resident, entryResidentAfter(p, schedule, i, resident)
+	}
+
+	subgraphs := make([]Subgraph, len(schedule))
+	for i, entry := range schedule {
+		subgraphs[i] = Subgraph{
+			Ops:             entry.Ops,
+			Granularity:     entry.Granularity,
+			TensorsToRetain: entry.Retain,
+			TraversalOrder:  entry.Traversal,
+			SubgraphLatency: entry.Latency,
+			TensorsToDrop:   entry.Drop,
+		}
+	}
+	fmt.Fprintf(progress, "  Fast solve: %d subgraphs\n", len(subgraphs))
+
+	return verifyOrRecover(p, gi, &Solution{Subgraphs: subgraphs})
+}
+
+// tryFuseFast is TryFuseOps sized with fastGranularity
+func tryFuseFast(p *Problem, ops []int, residentTensors map[int]bool) (bool, [3]int, float64) {
+	if len(ops) > maxFusedOps(p, len(ops)) || !fusible(p, ops) || !gridCompatible(p, ops) {
+		return false, [3]int{1, 1, 1}, math.Inf(1)
+	}
+	gran, ok := fastGranularity(p, ops, residentTensors)
+	if !ok {
+		return false, gran, math.Inf(1)
+	}
+	lat, err := EvaluateSubgraphDetailed(p, ops, gran, nil, nil, residentTensors, ReuseSnake)
+	if err != nil {
+		return false, gran, math.Inf(1)
+	}
+	return true, gran, lat
+}
+
+// fastGranularity returns the native tile clamped to the output, with the
+// deepest K that fits in fast memory. If even K=1 does not fit, the tile is
+// halved until it does; ok is false if no tile fits.
+func fastGranularity(p *Problem, ops []int, resident map[int]bool) (gran [3]int, ok bool) {
+	outT := GetOutputShape(p, ops)
+	w := MaxInt(1, MinInt(p.NativeGranularity[0], outT.Width))
+	h := MaxInt(1, MinInt(p.NativeGranularity[1], outT.Height))
+	k := 1
+	if HasMatMul(p, ops) {
+		k = GetMaxK(p, ops)
+	}
+
+	fits := func() bool {
+		return ComputeWorkingSet(p, ops, [3]int{w, h, k}, resident) <= p.FastMemoryCapacity
+	}
+	for k > 1 && !fits() {
+		k = CeilDiv(k, 2)
+	}
+	for (w > 1 || h > 1) && !fits() {
+		if w >= h {
+			w = CeilDiv(w, 2)
+		} else {
+			h = CeilDiv(h, 2)
+		}
+	}
+	return [3]int{w, h, k}, fits()
+}
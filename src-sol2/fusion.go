@@ -5,8 +5,25 @@ import (
 	"sort"
 )
 
-// TryFuseOps checks if fusing a set of ops is feasible and beneficial
+// TryFuseOps checks if fusing a set of ops is feasible and beneficial.
+// Within a cacheFusions scope, results are cached per problem, ops and
+// residency.
 func TryFuseOps(p *Problem, ops []int, residentTensors map[int]bool) (feasible bool, gran [3]int, lat float64) {
+	key := newFusionKey(ops, residentTensors)
+	if r, ok := lookupFusion(p, key); ok {
+		return r.feasible, r.gran, r.lat
+	}
+	feasible, gran, lat = tryFuseOps(p, ops, residentTensors)
+	storeFusion(p, key, fusionResult{feasible, gran, lat})
+	return feasible, gran, lat
+}
+
+// tryFuseOps is TryFuseOps without the cache
+func tryFuseOps(p *Problem, ops []int, residentTensors map[int]bool) (feasible bool, gran [3]int, lat float64) {
+	if len(ops) > maxFusedOps(p, len(ops)) || !fusible(p, ops) || !gridCompatible(p, ops) {
+		return false, [3]int{1, 1, 1}, math.Inf(1)
+	}
+
 	gran = FindBestGranularity(p, ops, residentTensors)
 	ws := ComputeWorkingSet(p, ops, gran, residentTensors)
 
@@ -15,7 +32,7 @@ func TryFuseOps(p *Problem, ops []int, residentTensors map[int]bool) (feasible b
 	}
 
 	trav := BestTraversal(p, ops, gran)
-	lat, err := EvaluateSubgraphDetailed(p, ops, gran, nil, trav, residentTensors)
+	lat, err := EvaluateSubgraphDetailed(p, ops, gran, nil, trav, residentTensors, ReuseSnake)
 	if err != nil {
 		return false, gran, math.Inf(1)
 	}
@@ -23,27 +40,74 @@ func TryFuseOps(p *Problem, ops []int, residentTensors map[int]bool) (feasible b
 	return true, gran, lat
 }
 
+// maxFusedOps returns the problem's op limit per subgraph, or def when the
+// problem has none or a looser one
+func maxFusedOps(p *Problem, def int) int {
+	if p.MaxSubgraphOps > 0 {
+		return MinInt(def, p.MaxSubgraphOps)
+	}
+	return def
+}
+
+// fusible reports whether ops may share a subgraph: a single op always may,
+// more than one only if none of them is unfusable
+func fusible(p *Problem, ops []int) bool {
+	if len(ops) <= 1 {
+		return true
+	}
+	for _, opIdx := range ops {
+		if containsInt(p.Unfusable, opIdx) {
+			return false
+		}
+	}
+	return true
+}
+
+// gridCompatible reports whether all boundary outputs of ops can share one
+// tile grid: every output must match the primary output's shape or broadcast
+// against it. Ephemeral tensors never leave fast memory and are not checked.
+func gridCompatible(p *Problem, ops []int) bool {
+	outIdx := GetOutputTensor(p, ops)
+	if outIdx < 0 {
+		return true
+	}
+	primary := p.Tensors[outIdx]
+
+	boundary := GetSubgraphBoundary(p, ops)
+	for tIdx := range boundary.BoundaryOutputs {
+		if !broadcastCompatible(p.Tensors[tIdx], primary) {
+			return false
+		}
+	}
+	return true
+}
+
+// broadcastCompatible reports whether each dimension of a and b is equal or 1
+func broadcastCompatible(a, b Tensor) bool {
+	return (a.Width == b.Width || a.Width == 1 || b.Width == 1) &&
+		(a.Height == b.Height || a.Height == 1 || b.Height == 1)
+}
+
 // EstimateUnfusedLatency estimates cost of running ops individually in sequence
 func EstimateUnfusedLatency(p *Problem, ops []int, residentTensors map[int]bool) float64 {
 	total := 0.0
-	bw := float64(p.SlowMemoryBandwidth)
 
 	for i, opIdx := range ops {
 		singleOps := []int{opIdx}
 		gran := FindBestGranularity(p, singleOps, residentTensors)
 		trav := BestTraversal(p, singleOps, gran)
-		lat, err := EvaluateSubgraphDetailed(p, singleOps, gran, nil, trav, residentTensors)
+		lat, err := EvaluateSubgraphDetailed(p, singleOps, gran, nil, trav, residentTensors, ReuseSnake)
 		if err != nil {
 			lat = math.Inf(1)
 		}
-		total += lat
+		total += lat + perSubgraphCost()
 
 		// Add intermediate transfer cost (evict + reload)
 		if i < len(ops)-1 {
 			op := p.Ops[opIdx]
 			for _, outT := range op.Outputs {
 				size := FullTensorSize(p, outT)
-				total += 2.0 * float64(size) / bw
+				total += SpillTime(p, size)
 			}
 		}
 	}
@@ -51,8 +115,10 @@ func EstimateUnfusedLatency(p *Problem, ops []int, residentTensors map[int]bool)
 	return total
 }
 
-// FuseChainDP uses dynamic programming to find the best fusion of a chain
-func FuseChainDP(p *Problem, chain []int, residentTensors map[int]bool) [][]int {
+// FuseChainDP uses dynamic programming to find the best fusion of a chain.
+// The chain is put in topological order first, so every segment is too.
+func FuseChainDP(p *Problem, gi *GraphInfo, chain []int, residentTensors map[int]bool, fc *FusionConstraints) [][]int {
+	chain = sortOpsTopologically(gi, chain)
 	n := len(chain)
 	if n == 0 {
 		return nil
@@ -61,7 +127,7 @@ func FuseChainDP(p *Problem, chain []int, residentTensors map[int]bool) [][]int
 		return [][]int{chain}
 	}
 
-	maxSegLen := MinInt(n, 6)
+	maxSegLen := maxFusedOps(p, MinInt(n, 6))
 
 	dp := make([]float64, n+1)
 	split := make([]int, n+1)
@@ -71,6 +137,9 @@ func FuseChainDP(p *Problem, chain []int, residentTensors map[int]bool) [][]int
 		dp[i] = math.Inf(1)
 		for j := MaxInt(0, i-maxSegLen); j < i; j++ {
 			segment := chain[j:i]
+			if !fc.Allows(segment) || !fusible(p, segment) {
+				continue
+			}
 			segResident := residentTensors
 			if j > 0 {
 				segResident = make(map[int]bool)
@@ -78,25 +147,36 @@ func FuseChainDP(p *Problem, chain []int, residentTensors map[int]bool) [][]int
 
 			feasible, _, segLat := TryFuseOps(p, segment, segResident)
 
-			if !feasible {
+			if feasible {
+				segLat += perSubgraphCost()
+			} else {
 				segLat = EstimateUnfusedLatency(p, segment, segResident)
 			}
 
-			transferCost := 0.0
+			// Segment latencies already include storing each tensor that
+			// crosses the split and loading it back, so a split adds no
+			// transfer of its own unless the crossing tensors stay resident
+			crossing := make(map[int]bool)
 			if j > 0 {
 				boundary := GetSubgraphBoundary(p, segment)
-				bw := float64(p.SlowMemoryBandwidth)
 				for tIdx := range boundary.BoundaryInputs {
 					for _, prevOp := range chain[:j] {
-						for _, outT := range p.Ops[prevOp].Outputs {
-							if outT == tIdx {
-								transferCost += 2.0 * float64(FullTensorSize(p, tIdx)) / bw
-							}
+						if containsInt(p.Ops[prevOp].Outputs, tIdx) {
+							crossing[tIdx] = true
 						}
 					}
 				}
 			}
 
+			// A split whose crossing tensors fit retained is credited with
+			// the transfer retention saves; retention planning then keeps
+			// them, since each is a boundary output of one segment read by
+			// the next
+			transferCost := 0.0
+			if saved, ok := retainedTransferSavings(p, gi, chain[split[j]:j], segment, crossing); ok {
+				transferCost = -saved
+			}
+
 			cost := dp[j] + segLat + transferCost
 			if cost < dp[i] {
 				dp[i] = cost
@@ -116,41 +196,116 @@ func FuseChainDP(p *Problem, chain []int, residentTensors map[int]bool) [][]int
 	return segments
 }
 
-// FuseChainGreedy uses a greedy approach to fuse consecutive ops
-func FuseChainGreedy(p *Problem, chain []int, residentTensors map[int]bool) [][]int {
+// retainedTransferSavings is the transfer FuseChainDP saves on a split
+// whose crossing tensors stay in fast memory from prev, the segment before
+// the split, into segment: every reload, and the store of each crossing
+// tensor the graph neither reads outside segment nor outputs. It returns
+// false if nothing crosses, if a crossing tensor comes from before prev, or
+// if prev or segment cannot fit with the crossing tensors held whole.
+func retainedTransferSavings(p *Problem, gi *GraphInfo, prev, segment []int, crossing map[int]bool) (float64, bool) {
+	if len(crossing) == 0 {
+		return 0, false
+	}
+	prevOutputs := GetSubgraphBoundary(p, prev).BoundaryOutputs
+	for tIdx := range crossing {
+		if IsPinnedTensor(p, tIdx) || !prevOutputs[tIdx] {
+			return 0, false
+		}
+	}
+	retain := sortedKeys(crossing)
+	prevGran := FindBestGranularityWithRetain(p, prev, nil, retain)
+	if ComputeWorkingSetWithRetained(p, prev, prevGran, nil, retain) > p.FastMemoryCapacity {
+		return 0, false
+	}
+	if feasible, _, _ := TryFuseOps(p, segment, crossing); !feasible {
+		return 0, false
+	}
+
+	saved := 0.0
+	for tIdx := range crossing {
+		size := float64(FullTensorSize(p, tIdx))
+		saved += size / float64(p.SlowMemoryBandwidth)
+		readAfter := false
+		for _, consumer := range gi.ConsumersOf[tIdx] {
+			if !containsInt(segment, consumer) {
+				readAfter = true
+			}
+		}
+		if !readAfter && !isGraphOutput(p, tIdx) {
+			saved += size / StoreBandwidth(p)
+		}
+	}
+	return saved, true
+}
+
+// FuseChainGreedy uses a greedy approach to fuse consecutive ops. The
+// current group's boundary is grown op by op, so candidates whose smallest
+// tile already overflows are rejected without a granularity search, and the
+// current group's latency is carried over from the step that formed it.
+// The chain is put in topological order first, so every group is too.
+func FuseChainGreedy(p *Problem, gi *GraphInfo, chain []int, residentTensors map[int]bool, fc *FusionConstraints) [][]int {
+	return fuseChainGreedy(p, gi, chain, residentTensors, fc, TryFuseOps)
+}
+
+// fuseChainGreedy is FuseChainGreedy with the fusion test and latency
+// estimate supplied by tryFuse, which has the signature of TryFuseOps
+func fuseChainGreedy(p *Problem, gi *GraphInfo, chain []int, residentTensors map[int]bool, fc *FusionConstraints,
+	tryFuse func(p *Problem, ops []int, residentTensors map[int]bool) (bool, [3]int, float64)) [][]int {
+	chain = sortOpsTopologically(gi, chain)
 	if len(chain) <= 1 {
 		return [][]int{chain}
 	}
 
 	var groups [][]int
 	currentGroup := []int{chain[0]}
+	currentBoundary := GetSubgraphBoundary(p, currentGroup)
+	_, _, currentLat := tryFuse(p, currentGroup, residentTensors)
+
+	startGroup := func(opIdx int) {
+		groups = append(groups, currentGroup)
+		currentGroup = []int{opIdx}
+		currentBoundary = GetSubgraphBoundary(p, currentGroup)
+		_, _, currentLat = tryFuse(p, currentGroup, residentTensors)
+	}
 
 	for i := 1; i < len(chain); i++ {
 		candidate := append(append([]int{}, currentGroup...), chain[i])
-		feasible, _, fusedLat := TryFuseOps(p, candidate, residentTensors)
+		if !fc.Allows(candidate) {
+			startGroup(chain[i])
+			continue
+		}
+
+		// The boundary is only kept if the candidate is accepted; every
+		// other path below starts a new group and rebuilds it
+		currentBoundary.AddOp(p, chain[i])
+		if workingSetWithBoundary(p, candidate, currentBoundary, [3]int{1, 1, 1}, residentTensors) > p.FastMemoryCapacity {
+			startGroup(chain[i])
+			continue
+		}
+
+		feasible, _, fusedLat := tryFuse(p, candidate, residentTensors)
 
 		if !feasible {
-			groups = append(groups, currentGroup)
-			currentGroup = []int{chain[i]}
+			startGroup(chain[i])
 			continue
 		}
 
-		separateLat := 0.0
-		_, _, currentLat := TryFuseOps(p, currentGroup, residentTensors)
-		_, _, nextLat := TryFuseOps(p, []int{chain[i]}, make(map[int]bool))
-		separateLat = currentLat + nextLat
+		_, _, nextLat := tryFuse(p, []int{chain[i]}, make(map[int]bool))
+		separateLat := currentLat + nextLat
+
+		// Splitting launches one more subgraph, and switches once more, than fusing
+		separateLat += perSubgraphCost()
 
-		bw := float64(p.SlowMemoryBandwidth)
 		prevOp := p.Ops[chain[i-1]]
 		for _, outT := range prevOp.Outputs {
-			separateLat += 2.0 * float64(FullTensorSize(p, outT)) / bw
+			separateLat += SpillTime(p, FullTensorSize(p, outT))
 		}
 
 		if fusedLat < separateLat {
 			currentGroup = candidate
+			currentLat = fusedLat
 		} else {
-			groups = append(groups, currentGroup)
-			currentGroup = []int{chain[i]}
+			startGroup(chain[i])
 		}
 	}
 
@@ -158,8 +313,35 @@ func FuseChainGreedy(p *Problem, chain []int, residentTensors map[int]bool) [][]
 	return groups
 }
 
+// computeToTraffic is the base cost of op opIdx over the slow memory time of
+// one of its steps alone at native granularity: a tile of each input, with
+// a native-width K slice for a MatMul, in and its output tiles out. Both are
+// in the benchmark's latency units, so the ratio compares across benchmarks.
+func computeToTraffic(p *Problem, opIdx int) float64 {
+	op := p.Ops[opIdx]
+	nw, nh := p.NativeGranularity[0], p.NativeGranularity[1]
+	var loads, stores int64
+	for _, tIdx := range uniqueInts(op.Inputs) {
+		loads += InputTileSize(p, []int{opIdx}, tIdx, nw, nh, nw)
+	}
+	for _, tIdx := range op.Outputs {
+		stores += OutputTileSize(p, tIdx, nw, nh)
+	}
+	traffic := float64(loads)/float64(p.SlowMemoryBandwidth) + float64(stores)/StoreBandwidth(p)
+	if traffic == 0 {
+		return math.Inf(1)
+	}
+	return float64(op.BaseCost) / traffic
+}
+
 // tryCrossChainFusion tries to fuse groups that share large inputs
-func tryCrossChainFusion(p *Problem, gi *GraphInfo, groups [][]int) [][]int {
+func tryCrossChainFusion(p *Problem, gi *GraphInfo, groups [][]int, fc *FusionConstraints) [][]int {
+	return crossChainFusion(p, gi, groups, fc, nil)
+}
+
+// crossChainFusion is tryCrossChainFusion that appends every pair it turns
+// down to rejected, unless rejected is nil
+func crossChainFusion(p *Problem, gi *GraphInfo, groups [][]int, fc *FusionConstraints, rejected *[]RejectedFusion) [][]int {
 	if len(groups) <= 1 {
 		return groups
 	}
@@ -179,7 +361,16 @@ func tryCrossChainFusion(p *Problem, gi *GraphInfo, groups [][]int) [][]int {
 
 	var candidates []fusionCandidate
 
-	for tIdx, gIdxs := range tensorToGroups {
+	// Shared tensors in index order and a stable sort keep ties between
+	// equally large tensors deterministic
+	sharedTensors := make([]int, 0, len(tensorToGroups))
+	for tIdx := range tensorToGroups {
+		sharedTensors = append(sharedTensors, tIdx)
+	}
+	sort.Ints(sharedTensors)
+
+	for _, tIdx := range sharedTensors {
+		gIdxs := tensorToGroups[tIdx]
 		if len(gIdxs) < 2 {
 			continue
 		}
@@ -198,7 +389,7 @@ func tryCrossChainFusion(p *Problem, gi *GraphInfo, groups [][]int) [][]int {
 		}
 	}
 
-	sort.Slice(candidates, func(i, j int) bool {
+	sort.SliceStable(candidates, func(i, j int) bool {
 		return candidates[i].sharedBW > candidates[j].sharedBW
 	})
 
@@ -223,37 +414,39 @@ func tryCrossChainFusion(p *Problem, gi *GraphInfo, groups [][]int) [][]int {
 		if merged[g1] || merged[g2] {
 			continue
 		}
+		reject := func(reason FusionRejectReason, value, threshold float64) {
+			if rejected != nil {
+				*rejected = append(*rejected, RejectedFusion{
+					Groups:    [2][]int{groups[g1], groups[g2]},
+					Reason:    reason,
+					Value:     value,
+					Threshold: threshold,
+				})
+			}
+		}
 
 		// Constraint: Don't fuse huge number of disjoint ops
-		if len(groups[g1])+len(groups[g2]) > 8 {
+		if limit := maxFusedOps(p, 8); len(groups[g1])+len(groups[g2]) > limit {
+			reject(RejectOpLimit, float64(len(groups[g1])+len(groups[g2])), float64(limit))
 			continue
 		}
 
 		// Constraint: STRICTLY avoid cross-fusing heavy compute operations.
 		// If operations have high base cost (like massive MatMuls), fusing them
 		// usually hurts because it constrains the tiling grid for both, reducing K-dimension efficiency.
-		isHeavy := false
-		for _, opIdx := range groups[g1] {
-			if p.Ops[opIdx].BaseCost > 2000 {
-				isHeavy = true
-				break
-			}
+		var heaviest float64
+		for _, opIdx := range append(append([]int{}, groups[g1]...), groups[g2]...) {
+			heaviest = MaxFloat(heaviest, computeToTraffic(p, opIdx))
 		}
-		if !isHeavy {
-			for _, opIdx := range groups[g2] {
-				if p.Ops[opIdx].BaseCost > 2000 {
-					isHeavy = true
-					break
-				}
-			}
-		}
-		if isHeavy {
+		if heaviest > Config.HeavyOpRatio {
+			reject(RejectHeavyOp, heaviest, Config.HeavyOpRatio)
 			continue
 		}
 
 		combined := append(append([]int{}, groups[g1]...), groups[g2]...)
 
-		if !isTopologicallyValid(p, gi, combined) {
+		if !fc.Allows(combined) || !isTopologicallyValid(p, gi, combined) {
+			reject(RejectConstraint, 0, 0)
 			continue
 		}
 
@@ -261,15 +454,21 @@ func tryCrossChainFusion(p *Problem, gi *GraphInfo, groups [][]int) [][]int {
 
 		feasible, fusedGran, fusedLat := TryFuseOps(p, combined, make(map[int]bool))
 		if !feasible {
+			// Ops TryFuseOps refuses outright come back with a unit
+			// granularity, which fits, so only sized candidates overflow
+			ws := ComputeWorkingSet(p, combined, fusedGran, make(map[int]bool))
+			if ws > p.FastMemoryCapacity {
+				reject(RejectCapacity, float64(ws), float64(p.FastMemoryCapacity))
+			} else {
+				reject(RejectConstraint, 0, 0)
+			}
 			continue
 		}
 
 		// Constraint: PADDING CHECK
-		outT := p.Tensors[GetOutputTensor(p, combined)]
-		if float64(fusedGran[0]) > float64(outT.Width)*1.05 {
-			continue
-		}
-		if float64(fusedGran[1]) > float64(outT.Height)*1.05 {
+		outT := GetOutputShape(p, combined)
+		if overhang := math.Max(float64(fusedGran[0])/float64(outT.Width), float64(fusedGran[1])/float64(outT.Height)); overhang > 1.05 {
+			reject(RejectPadding, overhang, 1.05)
 			continue
 		}
 
@@ -286,31 +485,35 @@ func tryCrossChainFusion(p *Problem, gi *GraphInfo, groups [][]int) [][]int {
 			}
 		}
 		if targetK > 1 {
-			if float64(fusedGran[2]) < float64(targetK)*0.5 {
+			if kRatio := float64(fusedGran[2]) / float64(targetK); kRatio < 0.5 {
+				reject(RejectKPreservation, kRatio, 0.5)
 				continue
 			}
 		}
 
 		separateLat := base1.lat + base2.lat
-		bw := float64(p.SlowMemoryBandwidth)
 		transferCost := 0.0
 
 		b1 := GetSubgraphBoundary(p, groups[g1])
 		b2 := GetSubgraphBoundary(p, groups[g2])
 		for tIdx := range b1.BoundaryOutputs {
 			if b2.BoundaryInputs[tIdx] {
-				transferCost += 2.0 * float64(FullTensorSize(p, tIdx)) / bw
+				transferCost += SpillTime(p, FullTensorSize(p, tIdx))
 			}
 		}
 		for tIdx := range b2.BoundaryOutputs {
 			if b1.BoundaryInputs[tIdx] {
-				transferCost += 2.0 * float64(FullTensorSize(p, tIdx)) / bw
+				transferCost += SpillTime(p, FullTensorSize(p, tIdx))
 			}
 		}
 
 		separateLat += transferCost
 
-		if fusedLat < separateLat*0.90 { // Strict requirement for improvement
+		// Two subgraphs pay the per-subgraph cost twice, the fused one once
+		fusedCost := fusedLat + perSubgraphCost()
+		separateLat += 2 * perSubgraphCost()
+
+		if fusedCost < separateLat*0.90 { // Strict requirement for improvement
 			groups[g1] = combined
 			merged[g2] = true
 
@@ -318,6 +521,8 @@ func tryCrossChainFusion(p *Problem, gi *GraphInfo, groups [][]int) [][]int {
 				lat  float64
 				gran [3]int
 			}{fusedLat, fusedGran}
+		} else {
+			reject(RejectImprovement, fusedCost/separateLat, 0.90)
 		}
 	}
 
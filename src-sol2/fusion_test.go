@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestFuseChainDPSegmentCosts checks FuseChainDP splits a chain by the
+// latency of its segments, which already store and reload every tensor
+// crossing a split. On mlsys-2026-5 an extra spill charge per split once
+// made it keep ops 0-2 together at a higher total.
+func TestFuseChainDPSegmentCosts(t *testing.T) {
+	p, err := ReadProblem(filepath.Join("..", "benchmarks", "mlsys-2026-5.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gi := AnalyzeGraph(p)
+	defer cacheFusions(p)()
+
+	cost := func(segments [][]int) float64 {
+		total := 0.0
+		for _, segment := range segments {
+			feasible, _, lat := TryFuseOps(p, segment, make(map[int]bool))
+			if !feasible {
+				t.Fatalf("segment %v does not fit", segment)
+			}
+			total += lat + perSubgraphCost()
+		}
+		return total
+	}
+
+	chain := []int{0, 1, 2, 4, 15, 16, 17, 18}
+	got := FuseChainDP(p, gi, chain, make(map[int]bool), nil)
+	split := [][]int{{0}, {1, 2}, {4, 15, 16, 17, 18}}
+	if latencyLess(cost(split), cost(got)) {
+		t.Errorf("FuseChainDP split %v at %.1f, %v costs %.1f", got, cost(got), split, cost(split))
+	}
+}
+
+// TestTryFuseOpsGrid checks ops whose outputs cannot share one tile grid,
+// such as a 512x512 MatMul and a 256x256 pointwise op, are refused fusion,
+// while equal and broadcast shapes fuse
+func TestTryFuseOpsGrid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		second Tensor // shape of the pointwise op's input and output
+		fuses  bool
+	}{
+		{"same shape", Tensor{Width: 512, Height: 512}, true},
+		{"broadcast row", Tensor{Width: 512, Height: 1}, true},
+		{"mismatched", Tensor{Width: 256, Height: 256}, false},
+	} {
+		square := Tensor{Width: 512, Height: 512}
+		p := &Problem{
+			Tensors: []Tensor{square, square, square, tc.second, tc.second},
+			Ops: []Op{
+				{OpType: "MatMul", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 1000},
+				{OpType: "Pointwise", Inputs: []int{3}, Outputs: []int{4}, BaseCost: 1000},
+			},
+			FastMemoryCapacity:  1 << 22,
+			SlowMemoryBandwidth: 10,
+			NativeGranularity:   [2]int{128, 128},
+		}
+		if got := gridCompatible(p, []int{0, 1}); got != tc.fuses {
+			t.Errorf("%s: gridCompatible %v, want %v", tc.name, got, tc.fuses)
+		}
+		if feasible, _, _ := TryFuseOps(p, []int{0, 1}, nil); feasible != tc.fuses {
+			t.Errorf("%s: TryFuseOps feasible %v, want %v", tc.name, feasible, tc.fuses)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// fusionResult is what TryFuseOps returns for one op set
+type fusionResult struct {
+	feasible bool
+	gran     [3]int
+	lat      float64
+}
+
+// problemFusionCache holds the TryFuseOps results of one problem, computed
+// under Config as printed in config. scopes counts the open cacheFusions
+// calls for the problem.
+type problemFusionCache struct {
+	config  string
+	scopes  int
+	entries map[fusionKey]fusionResult
+}
+
+// fusionCache memoizes TryFuseOps across chain DP, greedy and cross-chain
+// fusion, which price many of the same op sets. Benchmarks are solved
+// concurrently, so it is locked and split by problem.
+var fusionCache = struct {
+	sync.Mutex
+	problems     map[*Problem]*problemFusionCache
+	hits, misses int64
+}{problems: make(map[*Problem]*problemFusionCache)}
+
+// fusionKey identifies a TryFuseOps call on p: the ops in the order given,
+// which decides tie-breaks such as the primary output, and the resident
+// tensors. Both are hashed to 64 bits, so building a key allocates nothing.
+type fusionKey struct {
+	ops      uint64
+	resident uint64
+	nOps     int
+	nRes     int
+}
+
+// mix64 is the splitmix64 finalizer, spreading x over all 64 bits
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// newFusionKey hashes ops in order and residentTensors as a set; the set
+// hash sums per-tensor hashes so map iteration order does not matter
+func newFusionKey(ops []int, residentTensors map[int]bool) fusionKey {
+	key := fusionKey{nOps: len(ops)}
+	for _, opIdx := range ops {
+		key.ops = mix64(key.ops ^ uint64(opIdx))
+	}
+	for tIdx, ok := range residentTensors {
+		if ok {
+			key.resident += mix64(uint64(tIdx) + 0x9e3779b97f4a7c15)
+			key.nRes++
+		}
+	}
+	return key
+}
+
+// cacheFusions caches TryFuseOps results for p until the returned function
+// is called. Every entry point that fuses should open a scope, so results
+// never outlive the solve; outside any scope TryFuseOps is not cached.
+// Scopes nest. Config is printed once per scope rather than per call, and a
+// scope opened under a different Config starts from an empty cache, since
+// Config changes how subgraphs are evaluated.
+func cacheFusions(p *Problem) (release func()) {
+	config := fmt.Sprintf("%#v", Config)
+
+	fusionCache.Lock()
+	defer fusionCache.Unlock()
+	pc := fusionCache.problems[p]
+	if pc == nil {
+		pc = &problemFusionCache{}
+		fusionCache.problems[p] = pc
+	}
+	if pc.entries == nil || pc.config != config {
+		pc.config, pc.entries = config, make(map[fusionKey]fusionResult)
+	}
+	pc.scopes++
+
+	return func() {
+		fusionCache.Lock()
+		defer fusionCache.Unlock()
+		if pc.scopes--; pc.scopes == 0 {
+			delete(fusionCache.problems, p)
+		}
+	}
+}
+
+// lookupFusion returns the cached TryFuseOps result for key on p
+func lookupFusion(p *Problem, key fusionKey) (fusionResult, bool) {
+	fusionCache.Lock()
+	defer fusionCache.Unlock()
+	pc := fusionCache.problems[p]
+	if pc == nil {
+		return fusionResult{}, false
+	}
+	r, ok := pc.entries[key]
+	if ok {
+		fusionCache.hits++
+	} else {
+		fusionCache.misses++
+	}
+	return r, ok
+}
+
+// storeFusion caches r as the TryFuseOps result for key on p, if a
+// cacheFusions scope is open for p
+func storeFusion(p *Problem, key fusionKey, r fusionResult) {
+	fusionCache.Lock()
+	defer fusionCache.Unlock()
+	if pc := fusionCache.problems[p]; pc != nil {
+		pc.entries[key] = r
+	}
+}
+
+// FusionCacheStats returns the number of TryFuseOps calls answered from the
+// cache and computed afresh since the program started
+func FusionCacheStats() (hits, misses int64) {
+	fusionCache.Lock()
+	defer fusionCache.Unlock()
+	return fusionCache.hits, fusionCache.misses
+}
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+// cachedFusions returns how many TryFuseOps results are cached for p
+func cachedFusions(p *Problem) int {
+	fusionCache.Lock()
+	defer fusionCache.Unlock()
+	if pc := fusionCache.problems[p]; pc != nil {
+		return len(pc.entries)
+	}
+	return 0
+}
+
+func TestCacheFusionsScope(t *testing.T) {
+	p := &Problem{
+		Tensors:             []Tensor{{Width: 128, Height: 128}, {Width: 128, Height: 128}, {Width: 128, Height: 128}},
+		Ops:                 []Op{{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 100}, {OpType: "Pointwise", Inputs: []int{1}, Outputs: []int{2}, BaseCost: 100}},
+		FastMemoryCapacity:  1 << 20,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{128, 128},
+	}
+
+	// checkStats fails unless hits and misses grew by the given counts
+	// since the last call
+	lastHits, lastMisses := FusionCacheStats()
+	checkStats := func(when string, hits, misses int64) {
+		t.Helper()
+		h, m := FusionCacheStats()
+		if h-lastHits != hits || m-lastMisses != misses {
+			t.Errorf("%s: %d hits and %d misses, want %d and %d", when, h-lastHits, m-lastMisses, hits, misses)
+		}
+		lastHits, lastMisses = h, m
+	}
+
+	TryFuseOps(p, []int{0, 1}, nil)
+	if n := cachedFusions(p); n != 0 {
+		t.Fatalf("outside a scope: %d results cached, want 0", n)
+	}
+	checkStats("outside a scope", 0, 0)
+
+	release := cacheFusions(p)
+	inner := cacheFusions(p)
+	feasible, gran, lat := TryFuseOps(p, []int{0, 1}, nil)
+	if n := cachedFusions(p); n != 1 {
+		t.Fatalf("in a scope: %d results cached, want 1", n)
+	}
+	checkStats("first call in a scope", 0, 1)
+	if f, g, l := TryFuseOps(p, []int{0, 1}, nil); f != feasible || g != gran || l != lat {
+		t.Errorf("cached result %v %v %v, want %v %v %v", f, g, l, feasible, gran, lat)
+	}
+	checkStats("repeated call", 1, 0)
+
+	// Residency is part of the key; a tensor mapped to false is not resident
+	TryFuseOps(p, []int{0, 1}, map[int]bool{0: true})
+	checkStats("new residency", 0, 1)
+	TryFuseOps(p, []int{0, 1}, map[int]bool{0: true, 2: false})
+	checkStats("same residency", 1, 0)
+	TryFuseOps(p, []int{1, 0}, nil)
+	checkStats("ops reordered", 0, 1)
+
+	inner()
+	if n := cachedFusions(p); n != 3 {
+		t.Errorf("after the inner scope: %d results cached, want 3", n)
+	}
+	release()
+	if n := cachedFusions(p); n != 0 {
+		t.Errorf("after the outer scope: %d results cached, want 0", n)
+	}
+}
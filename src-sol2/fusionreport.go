@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FusionRejectReason is why cross-chain fusion turned a pair of groups down
+type FusionRejectReason int
+
+const (
+	// RejectOpLimit: the fused group would have too many ops
+	RejectOpLimit FusionRejectReason = iota
+	// RejectHeavyOp: a group holds an op whose base cost is too high to
+	// share a tiling
+	RejectHeavyOp
+	// RejectConstraint: fusion constraints, unfusable ops, grid
+	// compatibility or op order rule the pair out
+	RejectConstraint
+	// RejectCapacity: no granularity fits the fused group in fast memory
+	RejectCapacity
+	// RejectPadding: the fused granularity overhangs the output
+	RejectPadding
+	// RejectKPreservation: fusing shrinks a MatMul's K step too far
+	RejectKPreservation
+	// RejectImprovement: the fused latency is not enough below the separate
+	RejectImprovement
+)
+
+// String returns a short name for the reason
+func (r FusionRejectReason) String() string {
+	switch r {
+	case RejectOpLimit:
+		return "op-limit"
+	case RejectHeavyOp:
+		return "heavy-op"
+	case RejectConstraint:
+		return "constraint"
+	case RejectCapacity:
+		return "capacity"
+	case RejectPadding:
+		return "padding"
+	case RejectKPreservation:
+		return "k-preservation"
+	case RejectImprovement:
+		return "improvement"
+	}
+	return fmt.Sprintf("FusionRejectReason(%d)", int(r))
+}
+
+// MarshalText writes the reason by name in JSON reports
+func (r FusionRejectReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// RejectedFusion is a pair of groups cross-chain fusion considered and did
+// not fuse. Value is the measure the rule tested and Threshold its limit:
+// op count, base cost, working set, output overhang, fused over unfused K
+// step, or fused over separate latency. Both are zero for RejectConstraint.
+type RejectedFusion struct {
+	Groups    [2][]int           `json:"groups"`
+	Reason    FusionRejectReason `json:"reason"`
+	Value     float64            `json:"value"`
+	Threshold float64            `json:"threshold"`
+}
+
+// Margin is how far Value is past Threshold, as a fraction of Threshold
+func (r RejectedFusion) Margin() float64 {
+	if r.Threshold == 0 {
+		return 0
+	}
+	return (r.Value - r.Threshold) / r.Threshold
+}
+
+// ReportRejectedFusions forms groups as the solver does and returns the
+// pairs cross-chain fusion rejected, by reason then first op
+func ReportRejectedFusions(p *Problem, gi *GraphInfo) []RejectedFusion {
+	defer cacheFusions(p)()
+
+	var rejected []RejectedFusion
+	crossChainFusion(p, gi, chainFusionGroups(p, gi, nil), nil, &rejected)
+	sort.SliceStable(rejected, func(i, j int) bool {
+		if rejected[i].Reason != rejected[j].Reason {
+			return rejected[i].Reason < rejected[j].Reason
+		}
+		return rejected[i].Groups[0][0] < rejected[j].Groups[0][0]
+	})
+	return rejected
+}
+
+// printRejectedFusions prints one line per rejected pair
+func printRejectedFusions(rejected []RejectedFusion) {
+	if len(rejected) == 0 {
+		fmt.Println("No cross-chain fusions rejected")
+		return
+	}
+	for _, r := range rejected {
+		if r.Reason == RejectConstraint {
+			fmt.Printf("  %-15s %v + %v\n", r.Reason, r.Groups[0], r.Groups[1])
+			continue
+		}
+		fmt.Printf("  %-15s %v + %v: %.4g vs %.4g (%+.1f%%)\n",
+			r.Reason, r.Groups[0], r.Groups[1], r.Value, r.Threshold, 100*r.Margin())
+	}
+}
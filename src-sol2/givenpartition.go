@@ -0,0 +1,96 @@
+package main
+
+import "fmt"
+
+// OptimizeGivenPartition keeps groups, a complete partition of p's ops made
+// elsewhere, as the subgraphs of the solution. It only orders the groups and
+// chooses their granularity, traversal and retention (phases 4-7). It
+// returns an error if groups do not cover every op exactly once, cannot be
+// scheduled in dependency order, or a group cannot run as one subgraph.
+func OptimizeGivenPartition(p *Problem, gi *GraphInfo, groups [][]int) (*Solution, error) {
+	if err := validatePartition(p, gi, groups); err != nil {
+		return nil, err
+	}
+
+	sorted := make([][]int, len(groups))
+	for i, group := range groups {
+		sorted[i] = sortOpsTopologically(gi, group)
+	}
+	schedule := BuildSchedule(p, gi, sorted)
+	sol := scheduleSolution(planEntries(p, schedule))
+
+	if _, err := EvaluateSolution(p, sol); err != nil {
+		return nil, fmt.Errorf("partition cannot be scheduled: %w", err)
+	}
+	return sol, nil
+}
+
+// validatePartition checks that groups cover every op of p exactly once,
+// that each group may be one subgraph, and that no dependency cycle runs
+// between groups
+func validatePartition(p *Problem, gi *GraphInfo, groups [][]int) error {
+	groupOf := make([]int, len(p.Ops))
+	for i := range groupOf {
+		groupOf[i] = -1
+	}
+	for gIdx, group := range groups {
+		if len(group) == 0 {
+			return fmt.Errorf("group %d is empty", gIdx)
+		}
+		for _, opIdx := range group {
+			if opIdx < 0 || opIdx >= len(p.Ops) {
+				return fmt.Errorf("group %d: op %d out of range", gIdx, opIdx)
+			}
+			if prev := groupOf[opIdx]; prev >= 0 {
+				return fmt.Errorf("op %d is in groups %d and %d", opIdx, prev, gIdx)
+			}
+			groupOf[opIdx] = gIdx
+		}
+		if len(group) > maxFusedOps(p, len(group)) || !fusible(p, group) || !gridCompatible(p, group) {
+			return fmt.Errorf("group %d: ops %v cannot share a subgraph", gIdx, group)
+		}
+	}
+	for opIdx, gIdx := range groupOf {
+		if gIdx < 0 {
+			return fmt.Errorf("op %d is in no group", opIdx)
+		}
+	}
+
+	// Kahn's algorithm over the group dependency graph
+	deps := make([]map[int]bool, len(groups))
+	dependents := make([][]int, len(groups))
+	for gIdx := range groups {
+		deps[gIdx] = make(map[int]bool)
+	}
+	for opIdx, gIdx := range groupOf {
+		for _, depOp := range gi.Dependencies[opIdx] {
+			if d := groupOf[depOp]; d != gIdx && !deps[gIdx][d] {
+				deps[gIdx][d] = true
+				dependents[d] = append(dependents[d], gIdx)
+			}
+		}
+	}
+	inDegree := make([]int, len(groups))
+	var ready []int
+	for gIdx := range groups {
+		inDegree[gIdx] = len(deps[gIdx])
+		if inDegree[gIdx] == 0 {
+			ready = append(ready, gIdx)
+		}
+	}
+	ordered := 0
+	for len(ready) > 0 {
+		gIdx := ready[0]
+		ready = ready[1:]
+		ordered++
+		for _, next := range dependents[gIdx] {
+			if inDegree[next]--; inDegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	if ordered < len(groups) {
+		return fmt.Errorf("groups cannot be ordered: %d of them are on or behind a dependency cycle", len(groups)-ordered)
+	}
+	return nil
+}
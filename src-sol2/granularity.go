@@ -1,68 +1,204 @@
 package main
 
 import (
+	"fmt"
 	"math"
 	"sort"
 )
 
 type CandidateGranularity struct {
-	W, H, K  int
+	W, H, K int
+	// Latency is the candidate's estimated latency plus its padding
+	// penalty (see paddedLatency); it is a ranking score
 	Latency  float64
 	WorkSet  int64
 	Feasible bool
+	// Estimate is QuickEstimate's latency and Detailed the step
+	// evaluator's, without padding penalty; Detailed is only computed for
+	// the candidates the search refines. Both are +Inf when infeasible.
+	Estimate float64
+	Detailed float64
+	// Dataflow is the cheaper dataflow for this candidate when the search
+	// considers input-stationary, otherwise OutputStationary
+	Dataflow Dataflow
 }
 
-func FindBestGranularity(p *Problem, ops []int, residentTensors map[int]bool) [3]int {
-	candidates := generateCandidates(p, ops, residentTensors)
+// latencyTieTolerance and latencyRelTolerance bound the latency difference
+// below which two candidates or schedules are considered equally fast: the
+// absolute bound covers rounding in small sums, the relative one in large
+const (
+	latencyTieTolerance = 1.0
+	latencyRelTolerance = 1e-9
+)
 
-	bestLat := math.Inf(1)
-	bestGran := [3]int{1, 1, 1}
+// latencyTie reports whether latencies a and b are equal within tolerance
+func latencyTie(a, b float64) bool {
+	return FloatEqual(a, b, latencyRelTolerance, latencyTieTolerance)
+}
 
-	for _, c := range candidates {
-		if c.Feasible && c.Latency < bestLat {
-			bestLat = c.Latency
-			bestGran = [3]int{c.W, c.H, c.K}
-		}
+// latencyLess reports whether a is lower than b by more than the tolerance,
+// so that improvements within rounding noise are not taken
+func latencyLess(a, b float64) bool {
+	return a < b && !latencyTie(a, b)
+}
+
+func FindBestGranularity(p *Problem, ops []int, residentTensors map[int]bool) [3]int {
+	if gran, ok := pointwiseGranularity(p, ops, residentTensors); ok {
+		return gran
 	}
+	candidates := generateCandidates(p, ops, residentTensors, false)
 
-	if math.IsInf(bestLat, 1) {
-		bestGran = findSmallestFeasible(p, ops, residentTensors)
+	best, ok := pickBestCandidate(candidates, func(c CandidateGranularity) bool {
+		return c.Feasible
+	})
+	bestGran := [3]int{best.W, best.H, best.K}
+	if !ok {
+		// An infeasible fallback is caught by CheckMinimumFootprint and by
+		// EvaluateSolution; the search itself always returns a granularity
+		bestGran, _ = findSmallestFeasible(p, ops, residentTensors)
 	}
 
 	return bestGran
 }
 
 func FindBestGranularityWithRetain(p *Problem, ops []int, residentTensors map[int]bool, retainAfter []int) [3]int {
-	candidates := generateCandidates(p, ops, residentTensors)
+	gran, _ := findBestWithRetain(p, ops, residentTensors, retainAfter, false)
+	return gran
+}
 
-	bestLat := math.Inf(1)
-	bestGran := [3]int{1, 1, 1}
+// FindBestDataflowGranularity is FindBestGranularityWithRetain with every
+// refined candidate also scored input-stationary. It returns the cheapest
+// granularity together with the dataflow that achieves it.
+func FindBestDataflowGranularity(p *Problem, ops []int, residentTensors map[int]bool, retainAfter []int) ([3]int, Dataflow) {
+	return findBestWithRetain(p, ops, residentTensors, retainAfter, true)
+}
 
-	for _, c := range candidates {
+func findBestWithRetain(p *Problem, ops []int, residentTensors map[int]bool, retainAfter []int, inputStationary bool) ([3]int, Dataflow) {
+	candidates := generateCandidates(p, ops, residentTensors, inputStationary)
+
+	best, ok := pickBestCandidate(candidates, func(c CandidateGranularity) bool {
 		if !c.Feasible {
-			continue
+			return false
 		}
 		wsRetain := ComputeWorkingSetWithRetained(p, ops, [3]int{c.W, c.H, c.K}, residentTensors, retainAfter)
-		if wsRetain > p.FastMemoryCapacity {
-			continue
+		return wsRetain <= p.FastMemoryCapacity
+	})
+	if !ok {
+		// An infeasible fallback is caught by CheckMinimumFootprint and by
+		// EvaluateSolution; the search itself always returns a granularity
+		gran, _ := findSmallestFeasible(p, ops, residentTensors)
+		return gran, OutputStationary
+	}
+
+	return [3]int{best.W, best.H, best.K}, best.Dataflow
+}
+
+// pointwiseGranularity is FindBestGranularity's fast path for subgraphs
+// without a MatMul. K is irrelevant there, and under the base-cost model a
+// step costs the same compute whatever its tile, so fewer, larger tiles are
+// never slower unless they pad the output more. It scales the native tile,
+// clamped to the output, and returns the fitting scale that pads least,
+// then has the fewest tiles. ok is false when the fast path
+// does not apply and the full search must run: under other cost models or
+// padding options, or if even the native tile overflows.
+func pointwiseGranularity(p *Problem, ops []int, residentTensors map[int]bool) (gran [3]int, ok bool) {
+	if HasMatMul(p, ops) || Config.CostModel != nil || Config.ComputeModel != ComputeBaseCost ||
+		Config.StrictNoPadding || Config.PaddingPenalty != 0 {
+		return gran, false
+	}
+	outT := GetOutputShape(p, ops)
+	nw, nh := p.NativeGranularity[0], p.NativeGranularity[1]
+	if outT.Width <= 0 || outT.Height <= 0 || nw <= 0 || nh <= 0 {
+		return gran, false
+	}
+
+	// The working set grows with the scale m of the native tile, so the
+	// largest fitting scale is found by bisection
+	tile := func(m int) [3]int {
+		return [3]int{MinInt(nw*m, outT.Width), MinInt(nh*m, outT.Height), 1}
+	}
+	fits := func(m int) bool {
+		return ComputeWorkingSet(p, ops, tile(m), residentTensors) <= p.FastMemoryCapacity
+	}
+	lo, hi := 1, MaxInt(CeilDiv(outT.Width, nw), CeilDiv(outT.Height, nh))
+	if !fits(lo) {
+		return gran, false
+	}
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
 		}
-		if c.Latency < bestLat {
-			bestLat = c.Latency
-			bestGran = [3]int{c.W, c.H, c.K}
+	}
+
+	// Every smaller scale fits too; a tile that divides the output
+	// evenly can beat a larger one that leaves a mostly empty last row
+	var bestTiles, bestArea int64
+	for m := lo; m >= 1; m-- {
+		t := tile(m)
+		tiles := int64(CeilDiv(outT.Width, t[0])) * int64(CeilDiv(outT.Height, t[1]))
+		area := tiles * int64(t[0]) * int64(t[1])
+		if m == lo || area < bestArea || (area == bestArea && tiles < bestTiles) {
+			gran, bestTiles, bestArea = t, tiles, area
 		}
 	}
+	return gran, true
+}
 
+// pickBestCandidate returns the first accepted candidate, in the order
+// generateCandidates sorted them, whose latency ties with the lowest accepted
+// latency. Near-ties are thus settled by the sort's
+// tie-breaks rather than by floating-point noise.
+func pickBestCandidate(candidates []CandidateGranularity, accept func(CandidateGranularity) bool) (CandidateGranularity, bool) {
+	bestLat := math.Inf(1)
+	for _, c := range candidates {
+		if accept(c) && c.Latency < bestLat {
+			bestLat = c.Latency
+		}
+	}
+	fallback := CandidateGranularity{W: 1, H: 1, K: 1}
 	if math.IsInf(bestLat, 1) {
-		bestGran = findSmallestFeasible(p, ops, residentTensors)
+		return fallback, false
 	}
 
-	return bestGran
+	for _, c := range candidates {
+		if accept(c) && latencyTie(c.Latency, bestLat) {
+			return c, true
+		}
+	}
+	return fallback, false
 }
 
-func generateCandidates(p *Problem, ops []int, residentTensors map[int]bool) []CandidateGranularity {
+// refineCount is how many of the ranked candidates generateCandidates
+// evaluates in detail, as set by Config.RefineCandidates and RefineSpread
+func refineCount(candidates []CandidateGranularity) int {
+	n := Config.RefineCandidates
+	if Config.RefineSpread > 0 && len(candidates) > 0 {
+		lead := math.Inf(1)
+		for _, c := range candidates {
+			if c.Feasible {
+				lead = math.Min(lead, c.Latency)
+			}
+		}
+		near := 0
+		for _, c := range candidates {
+			if c.Feasible && c.Latency <= lead*(1+Config.RefineSpread) {
+				near++
+			}
+		}
+		n = MaxInt(MinInt(near, 4*n), MaxInt(n/4, 1))
+	}
+	return MinInt(n, len(candidates))
+}
+
+// generateCandidates ranks granularities for ops. With inputStationary, the
+// detailed refinement also scores each candidate input-stationary and keeps
+// the cheaper dataflow.
+func generateCandidates(p *Problem, ops []int, residentTensors map[int]bool, inputStationary bool) []CandidateGranularity {
 	nw, nh := p.NativeGranularity[0], p.NativeGranularity[1]
-	primaryOutput := GetOutputTensor(p, ops)
-	outT := p.Tensors[primaryOutput]
+	outT := GetOutputShape(p, ops)
 	maxK := GetMaxK(p, ops)
 	hasMatmul := HasMatMul(p, ops)
 
@@ -83,15 +219,20 @@ func generateCandidates(p *Problem, ops []int, residentTensors map[int]bool) []C
 		kCands = []int{1}
 	}
 
+	if Config.StrictNoPadding {
+		wCands = uniqueInts(append(wCands, divisorsOf(outT.Width, 1)...))
+		hCands = uniqueInts(append(hCands, divisorsOf(outT.Height, 1)...))
+		if hasMatmul {
+			kCands = uniqueInts(append(kCands, divisorsOf(maxK, 1)...))
+		}
+	}
+
 	capCands := capacityDrivenCandidates(p, ops, residentTensors, outT.Width, outT.Height, maxK, hasMatmul)
 
 	var candidates []CandidateGranularity
 	evaluated := make(map[[3]int]bool)
 
 	addCandidate := func(w, h, k int) {
-		if w <= 0 || h <= 0 || k <= 0 {
-			return
-		}
 		if w > outT.Width {
 			w = outT.Width
 		}
@@ -101,6 +242,12 @@ func generateCandidates(p *Problem, ops []int, residentTensors map[int]bool) []C
 		if hasMatmul && k > maxK {
 			k = maxK
 		}
+		if w <= 0 || h <= 0 || k <= 0 {
+			return
+		}
+		if Config.StrictNoPadding && !tilesExactly([3]int{w, h, k}, outT.Width, outT.Height, maxK, hasMatmul) {
+			return
+		}
 
 		key := [3]int{w, h, k}
 		if evaluated[key] {
@@ -111,12 +258,14 @@ func generateCandidates(p *Problem, ops []int, residentTensors map[int]bool) []C
 		gran := [3]int{w, h, k}
 		ws := ComputeWorkingSet(p, ops, gran, residentTensors)
 		feasible := ws <= p.FastMemoryCapacity
-		lat := math.Inf(1)
+		lat, est := math.Inf(1), math.Inf(1)
 		if feasible {
-			lat = QuickEstimate(p, ops, gran, residentTensors)
+			est = QuickEstimate(p, ops, gran, residentTensors)
+			lat = paddedLatency(p, ops, gran, est)
 		}
 		candidates = append(candidates, CandidateGranularity{
 			W: w, H: h, K: k, Latency: lat, WorkSet: ws, Feasible: feasible,
+			Estimate: est, Detailed: math.Inf(1),
 		})
 	}
 
@@ -135,53 +284,193 @@ func generateCandidates(p *Problem, ops []int, residentTensors map[int]bool) []C
 	addCandidate(nw, nh, maxK)
 	addCandidate(nw, nh, 1)
 
-	sort.Slice(candidates, func(i, j int) bool {
-		if candidates[i].Feasible != candidates[j].Feasible {
-			return candidates[i].Feasible
+	computeBound := hasMatmul && IsComputeBound(p, ops)
+
+	// byLatency ranks feasible candidates by latency, breaking near-ties by
+	// deeper K, then fewer spatial tiles, which store and evict the output
+	// fewer times, and then larger area. With kFirst, deeper K wins outright.
+	byLatency := func(kFirst bool) func(i, j int) bool {
+		return func(i, j int) bool {
+			if candidates[i].Feasible != candidates[j].Feasible {
+				return candidates[i].Feasible
+			}
+
+			if kFirst && candidates[i].K != candidates[j].K {
+				return candidates[i].K > candidates[j].K
+			}
+
+			if !latencyTie(candidates[i].Latency, candidates[j].Latency) {
+				return candidates[i].Latency < candidates[j].Latency
+			}
+
+			if candidates[i].K != candidates[j].K {
+				return candidates[i].K > candidates[j].K
+			}
+
+			tilesI := CeilDiv(outT.Width, candidates[i].W) * CeilDiv(outT.Height, candidates[i].H)
+			tilesJ := CeilDiv(outT.Width, candidates[j].W) * CeilDiv(outT.Height, candidates[j].H)
+			if tilesI != tilesJ {
+				return tilesI < tilesJ
+			}
+
+			// Break ties with area
+			areaI := int64(candidates[i].W) * int64(candidates[i].H)
+			areaJ := int64(candidates[j].W) * int64(candidates[j].H)
+			return areaI > areaJ
 		}
+	}
 
-		// Optimization: Check K first (Desc) for MatMul
-		// Maximizing K (reduction depth) minimizes output stationarity overhead
-		if candidates[i].K != candidates[j].K {
-			return candidates[i].K > candidates[j].K
+	// Refine top N with detailed evaluation
+	outT = GetOutputShape(p, ops)
+	refined := make(map[[3]int]bool)
+	refineTop := func() bool {
+		changed := false
+		topN := refineCount(candidates)
+		for i := 0; i < topN; i++ {
+			c := &candidates[i]
+			gran := [3]int{c.W, c.H, c.K}
+			if !c.Feasible || refined[gran] {
+				continue
+			}
+			refined[gran] = true
+			changed = true
+
+			trav := candidateTraversal(outT, c.W, c.H, hasMatmul)
+			lat, err := EvaluateSubgraphDetailed(p, ops, gran, nil, trav, residentTensors, ReuseSnake)
+			if err == nil {
+				c.Detailed = lat
+				c.Latency = paddedLatency(p, ops, gran, lat)
+			}
+			// A single k-step runs the same steps either way
+			if inputStationary && CeilDiv(maxK, c.K) > 1 {
+				isLat, err := EvaluateSubgraphDataflow(p, ops, gran, nil, trav, residentTensors, InputStationary)
+				if isLat = paddedLatency(p, ops, gran, isLat); err == nil && isLat < c.Latency {
+					c.Latency = isLat
+					c.Dataflow = InputStationary
+				}
+			}
 		}
+		return changed
+	}
 
-		// Tolerance for floating point equality
-		diff := candidates[i].Latency - candidates[j].Latency
-		if math.Abs(diff) > 1.0 {
-			return diff < 0
+	// Maximizing K (reduction depth) minimizes output stationarity overhead,
+	// so the deepest-K candidates are always refined. Compute-bound MatMuls
+	// keep that order. Memory-bound subgraphs trade K against reload traffic
+	// and are ranked by detailed latency instead; since the quick estimate can
+	// be optimistic, refinement repeats until the leaders are all detailed.
+	sort.Slice(candidates, byLatency(hasMatmul))
+	refineTop()
+	if !computeBound {
+		for iter := 0; iter < 5; iter++ {
+			sort.Slice(candidates, byLatency(false))
+			if !refineTop() {
+				break
+			}
 		}
+	}
 
-		// Break ties with area
-		areaI := candidates[i].W * candidates[i].H
-		areaJ := candidates[j].W * candidates[j].H
-		return areaI > areaJ
-	})
+	return candidates
+}
 
-	// Refine top N with detailed evaluation
-	topN := MinInt(20, len(candidates))
-	for i := 0; i < topN; i++ {
+// candidateTraversal is the order the search refines a w x h candidate in:
+// a snake for multi-tile MatMuls, whose operand tiles it reuses, and the
+// evaluator's default row-major otherwise
+func candidateTraversal(outT Tensor, w, h int, hasMatmul bool) []int {
+	nCols := CeilDiv(outT.Width, w)
+	nRows := CeilDiv(outT.Height, h)
+	if hasMatmul && nCols*nRows > 1 {
+		return SnakeTraversal(nCols, nRows)
+	}
+	return nil
+}
+
+// EnumerateFeasibleGranularities returns every candidate the granularity
+// search considers for ops, in the order it ranks them, each flagged
+// feasible or not with its working set. Feasible candidates carry both
+// QuickEstimate's and the detailed latency, including those the search
+// itself never refines.
+func EnumerateFeasibleGranularities(p *Problem, ops []int, residentTensors map[int]bool) []CandidateGranularity {
+	candidates := generateCandidates(p, ops, residentTensors, false)
+	outT := GetOutputShape(p, ops)
+	hasMatmul := HasMatMul(p, ops)
+	for i := range candidates {
 		c := &candidates[i]
-		if !c.Feasible {
+		if !c.Feasible || !math.IsInf(c.Detailed, 1) {
 			continue
 		}
-		gran := [3]int{c.W, c.H, c.K}
-		outT := p.Tensors[GetOutputTensor(p, ops)]
-		nCols := CeilDiv(outT.Width, c.W)
-		nRows := CeilDiv(outT.Height, c.H)
-		var trav []int
-		if HasMatMul(p, ops) && nCols*nRows > 1 {
-			trav = SnakeTraversal(nCols, nRows)
-		}
-		lat, err := EvaluateSubgraphDetailed(p, ops, gran, nil, trav, residentTensors)
-		if err == nil {
-			c.Latency = lat
+		trav := candidateTraversal(outT, c.W, c.H, hasMatmul)
+		if lat, err := EvaluateSubgraphDetailed(p, ops, [3]int{c.W, c.H, c.K}, nil, trav, residentTensors, ReuseSnake); err == nil {
+			c.Detailed = lat
 		}
 	}
-
 	return candidates
 }
 
+// paddingFactor is the native tile area over the area of a w x h tile,
+// rounded up: how many steps' worth of compute a sub-native tile pays per
+// step of useful work. Tiles at least native in area have factor 1.
+func paddingFactor(p *Problem, w, h int) int64 {
+	native := int64(p.NativeGranularity[0]) * int64(p.NativeGranularity[1])
+	area := int64(w) * int64(h)
+	if area <= 0 || area >= native {
+		return 1
+	}
+	return (native + area - 1) / area
+}
+
+// paddedLatency adds Config.PaddingPenalty times the compute a sub-native
+// tile wastes to lat, scaling the subgraph's effective compute by its
+// padding factor. Ranking candidates by it steers the search toward
+// native-aligned tiles in proportion to the padding instead of by a cutoff.
+func paddedLatency(p *Problem, ops []int, gran [3]int, lat float64) float64 {
+	factor := paddingFactor(p, gran[0], gran[1])
+	if factor == 1 || Config.PaddingPenalty == 0 || math.IsInf(lat, 1) {
+		return lat
+	}
+
+	outT := GetOutputShape(p, ops)
+	nSpatial := CeilDiv(outT.Width, gran[0]) * CeilDiv(outT.Height, gran[1])
+	nK := CeilDiv(GetMaxK(p, ops), gran[2])
+	var computeSteps int64
+	for _, opIdx := range ops {
+		computeSteps += ComputeCost(p.Ops[opIdx]) * int64(opKSteps(p, p.Ops[opIdx], gran[2], nK))
+	}
+	wasted := float64(computeSteps) * float64(nSpatial) * float64(factor-1)
+	return lat + Config.PaddingPenalty*wasted
+}
+
+// IsComputeBound is a roofline check for a subgraph: it compares the compute
+// time at native granularity with a single K step against the time to move
+// every boundary tensor through slow memory exactly once. When compute
+// dominates even that lower bound on traffic, no tiling makes the subgraph
+// memory-bound.
+func IsComputeBound(p *Problem, ops []int) bool {
+	outT := GetOutputShape(p, ops)
+	nw, nh := p.NativeGranularity[0], p.NativeGranularity[1]
+	if isZeroSized(outT) || nw <= 0 || nh <= 0 {
+		return false
+	}
+
+	var costPerStep int64
+	for _, opIdx := range ops {
+		costPerStep += ComputeCost(p.Ops[opIdx])
+	}
+	nSpatial := CeilDiv(outT.Width, nw) * CeilDiv(outT.Height, nh)
+	computeTime := float64(costPerStep) * float64(nSpatial)
+
+	boundary := GetSubgraphBoundary(p, ops)
+	var loadSize, storeSize int64
+	for tIdx := range boundary.BoundaryInputs {
+		loadSize += FullTensorSize(p, tIdx)
+	}
+	for tIdx := range boundary.BoundaryOutputs {
+		storeSize += FullTensorSize(p, tIdx)
+	}
+	memoryTime := float64(loadSize)/float64(p.SlowMemoryBandwidth) + float64(storeSize)/StoreBandwidth(p)
+
+	return computeTime >= memoryTime
+}
+
 func generateDimCandidates(native, tensorSize int) []int {
 	cands := make(map[int]bool)
 	cands[native] = true
@@ -242,15 +531,18 @@ func capacityDrivenCandidates(p *Problem, ops []int, residentTensors map[int]boo
 
 	boundary := GetSubgraphBoundary(p, ops)
 	nw, nh := p.NativeGranularity[0], p.NativeGranularity[1]
+	residentTensors = withPinned(p, residentTensors)
 
 	var residentOverhead int64
 	for tIdx := range residentTensors {
 		if !boundary.BoundaryInputs[tIdx] && !boundary.AllProduced[tIdx] {
-			residentOverhead += FullTensorSize(p, tIdx)
+			residentOverhead += ResidentSize(p, tIdx)
 		}
 	}
 	for tIdx := range boundary.BoundaryInputs {
 		if residentTensors[tIdx] {
+			residentOverhead += ResidentSize(p, tIdx)
+		} else if InputTileRole(p, ops, tIdx) == "BROADCAST" {
 			residentOverhead += FullTensorSize(p, tIdx)
 		}
 	}
@@ -260,7 +552,7 @@ func capacityDrivenCandidates(p *Problem, ops []int, residentTensors map[int]boo
 
 	if hasMatmul {
 		numLHS, numRHS, numPW := 0, 0, 0
-		numOut := len(boundary.BoundaryOutputs)
+		numOut := len(boundary.BoundaryOutputs) - len(boundary.InPlace)
 
 		for tIdx := range boundary.BoundaryInputs {
 			if residentTensors[tIdx] {
@@ -310,9 +602,9 @@ func capacityDrivenCandidates(p *Problem, ops []int, residentTensors map[int]boo
 			}
 		}
 	} else {
-		numIO := len(boundary.BoundaryInputs) + len(boundary.BoundaryOutputs)
+		numIO := len(boundary.BoundaryInputs) + len(boundary.BoundaryOutputs) - len(boundary.InPlace)
 		for tIdx := range boundary.BoundaryInputs {
-			if residentTensors[tIdx] {
+			if residentTensors[tIdx] || InputTileRole(p, ops, tIdx) == "BROADCAST" {
 				numIO--
 			}
 		}
@@ -324,6 +616,9 @@ func capacityDrivenCandidates(p *Problem, ops []int, residentTensors map[int]boo
 				if s > 0 {
 					results = append(results, [3]int{MinInt(s, outW), MinInt(s, outH), 1})
 				}
+				for _, wh := range aspectTileCandidates(maxTileSize, outW, outH) {
+					results = append(results, [3]int{wh[0], wh[1], 1})
+				}
 			}
 		}
 	}
@@ -331,25 +626,216 @@ func capacityDrivenCandidates(p *Problem, ops []int, residentTensors map[int]boo
 	return results
 }
 
-func findSmallestFeasible(p *Problem, ops []int, residentTensors map[int]bool) [3]int {
+// aspectTileCandidates proposes tiles of at most maxTileSize elements shaped
+// after the output instead of a square: one matching outW:outH, plus full-width
+// and full-height strips. Each tile is then shrunk to the smallest size that
+// keeps the same tile count, so tall or wide outputs need fewer, less padded
+// tiles.
+func aspectTileCandidates(maxTileSize int64, outW, outH int) [][2]int {
+	if outW <= 0 || outH <= 0 || maxTileSize <= 0 {
+		return nil
+	}
+
+	var results [][2]int
+	add := func(w int) {
+		w = MaxInt(1, MinInt(w, outW))
+		h := int(MinInt64(maxTileSize/int64(w), int64(outH)))
+		if h <= 0 {
+			return
+		}
+		// Even out the tiles: same count, least padding
+		w = CeilDiv(outW, CeilDiv(outW, w))
+		h = CeilDiv(outH, CeilDiv(outH, h))
+		results = append(results, [2]int{w, h})
+	}
+
+	aspect := float64(outW) / float64(outH)
+	add(int(math.Sqrt(float64(maxTileSize) * aspect)))
+	add(outW)
+	add(int(maxTileSize / int64(outH)))
+
+	return results
+}
+
+// findSmallestFeasible shrinks the tile from native size, and K from its
+// full depth, until the working set fits. If even [1,1,1] overflows it
+// returns [1,1,1] with an error naming the largest contributor. Tiles below
+// Config.MinTileArea are not tried; if none above it fits, it returns an
+// error saying so.
+func findSmallestFeasible(p *Problem, ops []int, residentTensors map[int]bool) ([3]int, error) {
+	if Config.StrictNoPadding {
+		gran := findLargestExactFeasible(p, ops, residentTensors)
+		if ComputeWorkingSet(p, ops, gran, residentTensors) > p.FastMemoryCapacity {
+			return gran, footprintError(p, ops, residentTensors)
+		}
+		return gran, checkTileArea(p, ops, gran)
+	}
+
 	nw, nh := p.NativeGranularity[0], p.NativeGranularity[1]
 	maxK := GetMaxK(p, ops)
+	if !HasMatMul(p, ops) {
+		maxK = 1
+	}
 
+	floor := minTileArea(p, ops)
 	for w := nw; w >= 1; w /= 2 {
 		for h := nh; h >= 1; h /= 2 {
 			for k := maxK; k >= 1; k /= 2 {
 				gran := [3]int{w, h, k}
+				if tileArea(p, ops, gran) < floor {
+					continue
+				}
 				ws := ComputeWorkingSet(p, ops, gran, residentTensors)
 				if ws <= p.FastMemoryCapacity {
-					return gran
+					return gran, nil
 				}
-				if !HasMatMul(p, ops) {
-					break
+			}
+		}
+	}
+
+	gran := [3]int{1, 1, 1}
+	if ComputeWorkingSet(p, ops, gran, residentTensors) > p.FastMemoryCapacity {
+		return gran, footprintError(p, ops, residentTensors)
+	}
+	if floor > 1 {
+		return gran, fmt.Errorf("ops %v fit capacity %d only with tiles below the minimum tile area %d",
+			ops, p.FastMemoryCapacity, floor)
+	}
+	return gran, nil
+}
+
+// minTileArea is the smallest tile area the fallback search may choose for
+// ops: Config.MinTileArea, capped at the output's own area
+func minTileArea(p *Problem, ops []int) int64 {
+	if Config.MinTileArea <= 1 {
+		return 1
+	}
+	outT := GetOutputShape(p, ops)
+	return MinInt64(int64(Config.MinTileArea), int64(outT.Width)*int64(outT.Height))
+}
+
+// tileArea is the output elements one tile of gran covers, clamped to the
+// output of ops
+func tileArea(p *Problem, ops []int, gran [3]int) int64 {
+	outT := GetOutputShape(p, ops)
+	return int64(MinInt(gran[0], outT.Width)) * int64(MinInt(gran[1], outT.Height))
+}
+
+// checkTileArea returns an error if gran tiles ops more finely than
+// Config.MinTileArea allows
+func checkTileArea(p *Problem, ops []int, gran [3]int) error {
+	if floor := minTileArea(p, ops); tileArea(p, ops, gran) < floor {
+		return fmt.Errorf("ops %v fit capacity %d only at granularity %v, below the minimum tile area %d",
+			ops, p.FastMemoryCapacity, gran, floor)
+	}
+	return nil
+}
+
+// footprintError explains why ops do not fit at granularity [1,1,1]. Such
+// tiles are a single element, so the culprit is a tensor held whole: a
+// broadcast input or a tensor resident from the previous subgraph.
+func footprintError(p *Problem, ops []int, residentTensors map[int]bool) error {
+	gran := [3]int{1, 1, 1}
+	boundary := GetSubgraphBoundary(p, ops)
+
+	worst, worstSize := -1, int64(0)
+	consider := func(tIdx int, size int64) {
+		if size > worstSize || (size == worstSize && tIdx < worst) {
+			worst, worstSize = tIdx, size
+		}
+	}
+	for tIdx := range boundary.BoundaryInputs {
+		if residentTensors[tIdx] {
+			consider(tIdx, FullTensorSize(p, tIdx))
+		} else {
+			consider(tIdx, InputTileSize(p, ops, tIdx, 1, 1, 1))
+		}
+	}
+	for tIdx := range residentTensors {
+		if !boundary.BoundaryInputs[tIdx] && !boundary.AllProduced[tIdx] {
+			consider(tIdx, FullTensorSize(p, tIdx))
+		}
+	}
+
+	required := ComputeWorkingSet(p, ops, gran, residentTensors)
+	if worst < 0 {
+		return fmt.Errorf("ops %v need %d even at granularity [1,1,1], capacity is %d",
+			ops, required, p.FastMemoryCapacity)
+	}
+	t := p.Tensors[worst]
+	return fmt.Errorf("ops %v need %d even at granularity [1,1,1], capacity is %d; largest is tensor %d (%dx%d) holding %d",
+		ops, required, p.FastMemoryCapacity, worst, t.Width, t.Height, worstSize)
+}
+
+// CheckMinimumFootprint reports the first op that cannot run even alone at
+// granularity [1,1,1] with nothing resident, so no schedule exists
+func CheckMinimumFootprint(p *Problem) error {
+	if pinned := PinnedFootprint(p); pinned > p.FastMemoryCapacity {
+		return fmt.Errorf("pinned tensors %v need %d, capacity is %d",
+			p.PinnedTensors, pinned, p.FastMemoryCapacity)
+	}
+	for opIdx := range p.Ops {
+		if _, err := findSmallestFeasible(p, []int{opIdx}, nil); err != nil {
+			return fmt.Errorf("op %d cannot be scheduled: %w", opIdx, err)
+		}
+	}
+	return nil
+}
+
+// findLargestExactFeasible returns the largest-area exact-tiling granularity
+// that fits in fast memory, preferring deeper K among equal areas. It returns
+// [1,1,1] when nothing fits.
+func findLargestExactFeasible(p *Problem, ops []int, residentTensors map[int]bool) [3]int {
+	outT := GetOutputShape(p, ops)
+	kCands := []int{1}
+	if HasMatMul(p, ops) {
+		kCands = divisorsOf(GetMaxK(p, ops), 1)
+	}
+
+	best := [3]int{1, 1, 1}
+	var bestArea int64
+	bestK := 0
+	for _, w := range divisorsOf(outT.Width, 1) {
+		for _, h := range divisorsOf(outT.Height, 1) {
+			for _, k := range kCands {
+				area := int64(w) * int64(h)
+				if area < bestArea || (area == bestArea && k <= bestK) {
+					continue
+				}
+				gran := [3]int{w, h, k}
+				if ComputeWorkingSet(p, ops, gran, residentTensors) <= p.FastMemoryCapacity {
+					best, bestArea, bestK = gran, area, k
 				}
 			}
 		}
 	}
-	return [3]int{1, 1, 1}
+	return best
+}
+
+// tilesExactly reports whether gran divides the output and, for MatMul
+// subgraphs, the reduction depth without padding
+func tilesExactly(gran [3]int, outW, outH, maxK int, hasMatmul bool) bool {
+	if outW%gran[0] != 0 || outH%gran[1] != 0 {
+		return false
+	}
+	return !hasMatmul || maxK%gran[2] == 0
+}
+
+// CheckNoPadding returns an error naming the first subgraph whose granularity
+// pads its output or reduction depth
+func CheckNoPadding(p *Problem, sol *Solution) error {
+	for i, sg := range sol.Subgraphs {
+		outT := GetOutputShape(p, sg.Ops)
+		if isZeroSized(outT) {
+			continue
+		}
+		maxK := GetMaxK(p, sg.Ops)
+		if !tilesExactly(sg.Granularity, outT.Width, outT.Height, maxK, HasMatMul(p, sg.Ops)) {
+			return fmt.Errorf("subgraph %d: no exact tiling fits capacity, granularity %v pads output %dx%d (K=%d)",
+				i, sg.Granularity, outT.Width, outT.Height, maxK)
+		}
+	}
+	return nil
 }
 
 func SnakeTraversal(nCols, nRows int) []int {
@@ -386,8 +872,7 @@ func ColumnSnakeTraversal(nCols, nRows int) []int {
 
 func BestTraversal(p *Problem, ops []int, gran [3]int) []int {
 	w, h, k := gran[0], gran[1], gran[2]
-	primaryOutput := GetOutputTensor(p, ops)
-	outT := p.Tensors[primaryOutput]
+	outT := GetOutputShape(p, ops)
 	nCols := CeilDiv(outT.Width, w)
 	nRows := CeilDiv(outT.Height, h)
 
@@ -424,3 +909,95 @@ func BestTraversal(p *Problem, ops []int, gran [3]int) []int {
 	}
 	return SnakeTraversal(nCols, nRows)
 }
+
+// OrientedSnakeTraversal is SnakeTraversal (or ColumnSnakeTraversal when
+// columnMajor) mirrored so it starts at the given corner of the tile grid:
+// bit 0 of corner starts from the right edge, bit 1 from the bottom edge.
+// Mirroring keeps every step between adjacent tiles, so reuse is unchanged.
+func OrientedSnakeTraversal(nCols, nRows, corner int, columnMajor bool) []int {
+	var order []int
+	if columnMajor {
+		order = ColumnSnakeTraversal(nCols, nRows)
+	} else {
+		order = SnakeTraversal(nCols, nRows)
+	}
+	for i, tileIdx := range order {
+		row, col := tileIdx/nCols, tileIdx%nCols
+		if corner&1 != 0 {
+			col = nCols - 1 - col
+		}
+		if corner&2 != 0 {
+			row = nRows - 1 - row
+		}
+		order[i] = row*nCols + col
+	}
+	return order
+}
+
+// hotCorner returns the grid corner, in OrientedSnakeTraversal's encoding,
+// whose tile overlaps the most resident input data. Tensors are laid out from
+// the origin, so a resident input narrower or shorter than the output grid
+// only covers the tiles near the top-left corner.
+func hotCorner(p *Problem, ops []int, gran [3]int, residentTensors map[int]bool) int {
+	outT := GetOutputShape(p, ops)
+	nCols := CeilDiv(outT.Width, gran[0])
+	nRows := CeilDiv(outT.Height, gran[1])
+	boundary := GetSubgraphBoundary(p, ops)
+
+	var coverage [4]int64
+	for tIdx := range boundary.BoundaryInputs {
+		if !residentTensors[tIdx] {
+			continue
+		}
+		t := p.Tensors[tIdx]
+		cols, rows := nCols, nRows
+		switch InputTileRole(p, ops, tIdx) {
+		case "LHS":
+			rows = CeilDiv(t.Height, gran[1])
+		case "RHS":
+			cols = CeilDiv(t.Width, gran[0])
+		case "PW":
+			cols = CeilDiv(t.Width, gran[0])
+			rows = CeilDiv(t.Height, gran[1])
+		}
+		size := FullTensorSize(p, tIdx)
+		for corner := 0; corner < 4; corner++ {
+			reachesCol := corner&1 == 0 || cols >= nCols
+			reachesRow := corner&2 == 0 || rows >= nRows
+			if reachesCol && reachesRow {
+				coverage[corner] += size
+			}
+		}
+	}
+
+	best := 0
+	for corner := 1; corner < 4; corner++ {
+		if coverage[corner] > coverage[best] {
+			best = corner
+		}
+	}
+	return best
+}
+
+// BestTraversalWithResident is BestTraversal for a subgraph that starts with
+// residentTensors in fast memory: the snake is oriented to begin at the
+// corner nearest the resident data so reuse starts on the first tile
+func BestTraversalWithResident(p *Problem, ops []int, gran [3]int, residentTensors map[int]bool) []int {
+	trav := BestTraversal(p, ops, gran)
+	if len(trav) == 0 || len(residentTensors) == 0 {
+		return trav
+	}
+
+	corner := hotCorner(p, ops, gran, residentTensors)
+	if corner == 0 {
+		return trav
+	}
+
+	outT := GetOutputShape(p, ops)
+	nCols := CeilDiv(outT.Width, gran[0])
+	nRows := CeilDiv(outT.Height, gran[1])
+	// BestTraversal only returns row or column snakes; a column snake moves
+	// down first when the grid has more than one row
+	columnMajor := nRows > 1 && trav[1] == nCols
+	return OrientedSnakeTraversal(nCols, nRows, corner, columnMajor)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestFindBestGranularityAspect checks a tall or wide pointwise output that
+// does not fit whole gets full-width or full-height strips, which need fewer
+// tiles than a square of the same area, rather than a square tile
+func TestFindBestGranularityAspect(t *testing.T) {
+	for _, tc := range []struct {
+		width, height int
+		capacity      int64
+		want          [3]int
+	}{
+		{8, 4096, 16384, [3]int{8, 1024, 1}},
+		{8, 4096, 8192, [3]int{8, 512, 1}},
+		{4096, 8, 16384, [3]int{1024, 8, 1}},
+	} {
+		shape := Tensor{Width: tc.width, Height: tc.height}
+		p := &Problem{
+			Tensors:             []Tensor{shape, shape},
+			Ops:                 []Op{{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 1000}},
+			FastMemoryCapacity:  tc.capacity,
+			SlowMemoryBandwidth: 10,
+			NativeGranularity:   [2]int{128, 128},
+		}
+		if got := FindBestGranularity(p, []int{0}, nil); got != tc.want {
+			t.Errorf("%dx%d output, capacity %d: granularity %v, want %v", tc.width, tc.height, tc.capacity, got, tc.want)
+		}
+	}
+}
+
+// TestAspectTileCandidates checks the proposed tiles fit maxTileSize and the
+// output, and include the full-width and full-height strips
+func TestAspectTileCandidates(t *testing.T) {
+	for _, tc := range []struct {
+		maxTileSize int64
+		outW, outH  int
+		want        [][2]int
+	}{
+		{8192, 8, 4096, [][2]int{{4, 2048}, {8, 1024}, {2, 4096}}},
+		{8192, 4096, 8, [][2]int{{2048, 4}, {4096, 2}, {1024, 8}}},
+		{4096, 256, 256, [][2]int{{64, 64}, {256, 16}, {16, 256}}},
+		{0, 8, 4096, nil},
+	} {
+		got := aspectTileCandidates(tc.maxTileSize, tc.outW, tc.outH)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%d elements of %dx%d: tiles %v, want %v", tc.maxTileSize, tc.outW, tc.outH, got, tc.want)
+		}
+		for _, wh := range got {
+			if int64(wh[0])*int64(wh[1]) > tc.maxTileSize || wh[0] > tc.outW || wh[1] > tc.outH {
+				t.Errorf("%d elements of %dx%d: tile %v does not fit", tc.maxTileSize, tc.outW, tc.outH, wh)
+			}
+		}
+	}
+}
+
+// TestStrictNoPadding checks strict no-padding mode picks exact divisors of
+// a 300x300 output where the default search pads, and CheckNoPadding names
+// a subgraph whose granularity pads
+func TestStrictNoPadding(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+
+	shape := Tensor{Width: 300, Height: 300}
+	p := &Problem{
+		Tensors:             []Tensor{shape, shape},
+		Ops:                 []Op{{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 1000}},
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{128, 128},
+	}
+	for _, tc := range []struct {
+		capacity int64
+		strict   bool
+		want     [3]int
+	}{
+		{1 << 20, true, [3]int{300, 300, 1}},
+		{100000, false, [3]int{128, 128, 1}},
+		{100000, true, [3]int{150, 300, 1}},
+		{50000, true, [3]int{150, 150, 1}},
+		{20000, true, [3]int{100, 100, 1}},
+	} {
+		Config.StrictNoPadding = tc.strict
+		p.FastMemoryCapacity = tc.capacity
+		gran := FindBestGranularity(p, []int{0}, nil)
+		if gran != tc.want {
+			t.Errorf("capacity %d, strict %v: granularity %v, want %v", tc.capacity, tc.strict, gran, tc.want)
+		}
+		sol := &Solution{Subgraphs: []Subgraph{{Ops: []int{0}, Granularity: gran}}}
+		if err := CheckNoPadding(p, sol); (err != nil) == tc.strict {
+			t.Errorf("capacity %d, strict %v: CheckNoPadding returned %v", tc.capacity, tc.strict, err)
+		}
+	}
+
+	sol := &Solution{Subgraphs: []Subgraph{{Ops: []int{0}, Granularity: [3]int{128, 128, 1}}}}
+	if err := CheckNoPadding(p, sol); err == nil || !strings.Contains(err.Error(), "subgraph 0") {
+		t.Errorf("padded granularity: error %v, want one naming subgraph 0", err)
+	}
+}
+
+// TestFindSmallestFeasibleDeepMatMul checks a MatMul with K=4096 shrinks K
+// as well as the tile to fit, and that a capacity too small for any tiling
+// is an error naming the tensor and the required and available capacity
+func TestFindSmallestFeasibleDeepMatMul(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+	Config.StrictNoPadding = false
+
+	p := &Problem{
+		Tensors:             []Tensor{{Width: 4096, Height: 64}, {Width: 64, Height: 4096}, {Width: 64, Height: 64}},
+		Ops:                 []Op{{OpType: "MatMul", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 1000}},
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{64, 64},
+	}
+	for _, tc := range []struct {
+		name     string
+		capacity int64
+		resident map[int]bool
+		want     [3]int
+		wantErr  string
+	}{
+		// A 32x2 output tile with K=1: 2 + 32 + 64
+		{"shrinks K", 100, nil, [3]int{32, 2, 1}, ""},
+		{"single element", 3, nil, [3]int{1, 1, 1}, ""},
+		{"too small", 2, nil, [3]int{1, 1, 1},
+			"ops [0] need 3 even at granularity [1,1,1], capacity is 2; largest is tensor 0 (4096x64) holding 1"},
+		{"resident RHS", 100000, map[int]bool{1: true}, [3]int{1, 1, 1},
+			"capacity is 100000; largest is tensor 1 (64x4096) holding 262144"},
+	} {
+		p.FastMemoryCapacity = tc.capacity
+		got, err := findSmallestFeasible(p, []int{0}, tc.resident)
+		if got != tc.want {
+			t.Errorf("%s: granularity %v, want %v", tc.name, got, tc.want)
+		}
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: error %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+
+	p.FastMemoryCapacity = 2
+	if err := CheckMinimumFootprint(p); err == nil || !strings.Contains(err.Error(), "op 0 cannot be scheduled") {
+		t.Errorf("CheckMinimumFootprint: error %v, want op 0 named", err)
+	}
+}
+
+// TestInputStationarySelected checks a 128-row MatMul with K=4096 and a
+// 4096-wide output runs input-stationary at small capacities, scores below
+// the best output-stationary granularity, and keeps its dataflow through a
+// solution file
+func TestInputStationarySelected(t *testing.T) {
+	for _, capacity := range []int64{40000, 80000} {
+		p := &Problem{
+			Tensors:             []Tensor{{Width: 4096, Height: 128}, {Width: 4096, Height: 4096}, {Width: 4096, Height: 128}},
+			Ops:                 []Op{{OpType: "MatMul", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 100}},
+			FastMemoryCapacity:  capacity,
+			SlowMemoryBandwidth: 10,
+			NativeGranularity:   [2]int{128, 128},
+		}
+		gran, dataflow := FindBestDataflowGranularity(p, []int{0}, nil, nil)
+		if dataflow != InputStationary {
+			t.Fatalf("capacity %d: chose %v at %v, want input_stationary", capacity, dataflow, gran)
+		}
+
+		isSol := &Solution{Subgraphs: []Subgraph{{Ops: []int{0}, Granularity: gran, Dataflow: InputStationary}}}
+		osSol := &Solution{Subgraphs: []Subgraph{{Ops: []int{0}, Granularity: FindBestGranularityWithRetain(p, []int{0}, nil, nil)}}}
+		isLat, err := EvaluateSolution(p, isSol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		osLat, err := EvaluateSolution(p, osSol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isLat >= osLat {
+			t.Errorf("capacity %d: input-stationary %.1f, not below output-stationary %.1f", capacity, isLat, osLat)
+		}
+
+		file := filepath.Join(t.TempDir(), "solution.json")
+		if err := WriteSolution(file, p, isSol); err != nil {
+			t.Fatal(err)
+		}
+		back, err := ReadSolution(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := back.Subgraphs[0].Dataflow; got != InputStationary {
+			t.Errorf("capacity %d: read back %v, want input_stationary", capacity, got)
+		}
+	}
+}
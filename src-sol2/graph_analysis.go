@@ -44,7 +44,8 @@ func AnalyzeGraph(p *Problem) *GraphInfo {
 	for i, op := range p.Ops {
 		seen := make(map[int]bool)
 		for _, t := range op.Inputs {
-			if producer, exists := gi.ProducerOf[t]; exists {
+			// An in-place op reads the tensor it writes; it does not depend on itself
+			if producer, exists := gi.ProducerOf[t]; exists && producer != i {
 				if !seen[producer] {
 					gi.Dependencies[i] = append(gi.Dependencies[i], producer)
 					gi.Dependents[producer] = append(gi.Dependents[producer], i)
@@ -58,6 +59,43 @@ func AnalyzeGraph(p *Problem) *GraphInfo {
 	return gi
 }
 
+// ComputeCriticalPath returns the dependency path with the largest total
+// compute cost, in the per-step units of ComputeCost, and that total. Ops
+// on different paths can overlap at best, so no schedule finishes faster
+// than the path's ops run back to back. Ties keep the first dependency
+// listed and the path ending earliest in topological order.
+func ComputeCriticalPath(p *Problem, gi *GraphInfo) ([]int, int64) {
+	dist := make(map[int]int64, len(gi.TopoOrder))
+	prev := make(map[int]int, len(gi.TopoOrder))
+	end := -1
+
+	for _, opIdx := range gi.TopoOrder {
+		best, from := int64(0), -1
+		for _, dep := range gi.Dependencies[opIdx] {
+			if d := dist[dep]; from < 0 || d > best {
+				best, from = d, dep
+			}
+		}
+		dist[opIdx] = best + ComputeCost(p.Ops[opIdx])
+		prev[opIdx] = from
+		if end < 0 || dist[opIdx] > dist[end] {
+			end = opIdx
+		}
+	}
+	if end < 0 {
+		return nil, 0
+	}
+
+	var path []int
+	for opIdx := end; opIdx >= 0; opIdx = prev[opIdx] {
+		path = append(path, opIdx)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, dist[end]
+}
+
 func topologicalSort(p *Problem, gi *GraphInfo) []int {
 	numOps := len(p.Ops)
 	inDegree := make([]int, numOps)
@@ -94,6 +132,21 @@ type SubgraphBoundary struct {
 	Ephemeral       map[int]bool
 	AllConsumed     map[int]bool
 	AllProduced     map[int]bool
+	// InPlace tensors are read and written by the same op. They are both a
+	// boundary input and a boundary output, but one tile in fast memory:
+	// each tile is loaded, updated and stored back.
+	InPlace map[int]bool
+}
+
+// inPlaceTensors returns the tensors op both reads and writes
+func inPlaceTensors(op Op) []int {
+	var inPlace []int
+	for _, out := range op.Outputs {
+		if containsInt(op.Inputs, out) {
+			inPlace = append(inPlace, out)
+		}
+	}
+	return inPlace
 }
 
 func GetSubgraphBoundary(p *Problem, ops []int) *SubgraphBoundary {
@@ -103,6 +156,7 @@ func GetSubgraphBoundary(p *Problem, ops []int) *SubgraphBoundary {
 		Ephemeral:       make(map[int]bool),
 		AllConsumed:     make(map[int]bool),
 		AllProduced:     make(map[int]bool),
+		InPlace:         make(map[int]bool),
 	}
 
 	for _, opIdx := range ops {
@@ -113,16 +167,19 @@ func GetSubgraphBoundary(p *Problem, ops []int) *SubgraphBoundary {
 		for _, t := range op.Inputs {
 			sb.AllConsumed[t] = true
 		}
+		for _, t := range inPlaceTensors(op) {
+			sb.InPlace[t] = true
+		}
 	}
 
 	for t := range sb.AllProduced {
-		if sb.AllConsumed[t] {
+		if sb.AllConsumed[t] && !sb.InPlace[t] {
 			sb.Ephemeral[t] = true
 		}
 	}
 
 	for t := range sb.AllConsumed {
-		if !sb.AllProduced[t] {
+		if !sb.AllProduced[t] || sb.InPlace[t] {
 			sb.BoundaryInputs[t] = true
 		}
 	}
@@ -136,6 +193,46 @@ func GetSubgraphBoundary(p *Problem, ops []int) *SubgraphBoundary {
 	return sb
 }
 
+// AddOp updates sb in place as if opIdx had been part of the op set passed
+// to GetSubgraphBoundary. It touches only the op's own tensors, so growing a
+// group one op at a time costs O(op degree) per step.
+func (sb *SubgraphBoundary) AddOp(p *Problem, opIdx int) {
+	op := p.Ops[opIdx]
+	for _, t := range inPlaceTensors(op) {
+		sb.InPlace[t] = true
+		sb.AllProduced[t] = true
+		sb.AllConsumed[t] = true
+		sb.BoundaryInputs[t] = true
+		sb.BoundaryOutputs[t] = true
+		delete(sb.Ephemeral, t)
+	}
+	for _, t := range op.Outputs {
+		if sb.InPlace[t] {
+			continue
+		}
+		sb.AllProduced[t] = true
+		if sb.AllConsumed[t] {
+			sb.Ephemeral[t] = true
+			delete(sb.BoundaryInputs, t)
+			delete(sb.BoundaryOutputs, t)
+		} else {
+			sb.BoundaryOutputs[t] = true
+		}
+	}
+	for _, t := range op.Inputs {
+		if sb.InPlace[t] {
+			continue
+		}
+		sb.AllConsumed[t] = true
+		if sb.AllProduced[t] {
+			sb.Ephemeral[t] = true
+			delete(sb.BoundaryOutputs, t)
+		} else {
+			sb.BoundaryInputs[t] = true
+		}
+	}
+}
+
 // FindLinearChains finds maximal chains
 func FindLinearChains(p *Problem, gi *GraphInfo) [][]int {
 	visited := make(map[int]bool)
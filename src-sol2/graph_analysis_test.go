@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// TestSubgraphBoundaryAddOp checks growing a boundary one op at a time with
+// AddOp gives GetSubgraphBoundary's result for every prefix, over each
+// benchmark's linear chains and its whole topological order, both forward
+// and reversed
+func TestSubgraphBoundaryAddOp(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+	defer func(w io.Writer) { progress = w }(progress)
+	progress = io.Discard
+	Config.AllowShapeMismatch = true
+
+	for _, name := range []string{"mlsys-2026-1", "mlsys-2026-5", "mlsys-2026-9", "mlsys-2026-13", "mlsys-2026-17"} {
+		p, err := ReadProblem(filepath.Join("..", "benchmarks", name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gi := AnalyzeGraph(p)
+		orders := append(FindLinearChains(p, gi), gi.TopoOrder)
+		for _, order := range orders {
+			reversed := slices.Clone(order)
+			slices.Reverse(reversed)
+			for _, ops := range [][]int{order, reversed} {
+				sb := GetSubgraphBoundary(p, ops[:1])
+				for n := 2; n <= len(ops); n++ {
+					sb.AddOp(p, ops[n-1])
+					if want := GetSubgraphBoundary(p, ops[:n]); !reflect.DeepEqual(sb, want) {
+						t.Fatalf("%s: boundary of %v grown by AddOp = %+v, want %+v", name, ops[:n], sb, want)
+					}
+				}
+			}
+		}
+	}
+}
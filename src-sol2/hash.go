@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HashSolution returns a stable hex digest of a solution's structure:
+// subgraph order, ops, granularity, traversal, retention and drops.
+// Retention and drops are hashed as sets, so the order tensors are listed
+// in does not matter.
+// Latencies are derived values and are not hashed.
+func HashSolution(sol *Solution) string {
+	var sb strings.Builder
+	for i, sg := range sol.Subgraphs {
+		retain := append([]int{}, sg.TensorsToRetain...)
+		sort.Ints(retain)
+		retain = uniqueInts(retain)
+
+		fmt.Fprintf(&sb, "sg%d|ops=%v|gran=%v|retain=%v|trav=%v\n",
+			i, sg.Ops, sg.Granularity, retain, sg.TraversalOrder)
+		// Output-stationary subgraphs hash as before dataflows existed
+		if sg.Dataflow != OutputStationary {
+			fmt.Fprintf(&sb, "sg%d|dataflow=%s\n", i, sg.Dataflow)
+		}
+		// So do subgraphs that drop nothing
+		if len(sg.TensorsToDrop) > 0 {
+			drop := uniqueInts(append([]int{}, sg.TensorsToDrop...))
+			sort.Ints(drop)
+			fmt.Fprintf(&sb, "sg%d|drop=%v\n", i, drop)
+		}
+	}
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashProblem returns a stable hex digest of a problem, for keying solution
+// caches together with HashSolution
+func HashProblem(p *Problem) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "cap=%d|bw=%d|native=%v\n",
+		p.FastMemoryCapacity, p.SlowMemoryBandwidth, p.NativeGranularity)
+	// Symmetric bandwidth hashes as before store bandwidth existed
+	if p.StoreBandwidth > 0 && p.StoreBandwidth != p.SlowMemoryBandwidth {
+		fmt.Fprintf(&sb, "store_bw=%d\n", p.StoreBandwidth)
+	}
+	if len(p.PinnedTensors) > 0 {
+		fmt.Fprintf(&sb, "pinned=%v\n", p.PinnedTensors)
+	}
+	if p.MaxSubgraphOps > 0 {
+		fmt.Fprintf(&sb, "max_ops=%d\n", p.MaxSubgraphOps)
+	}
+	if len(p.Unfusable) > 0 {
+		fmt.Fprintf(&sb, "unfusable=%v\n", p.Unfusable)
+	}
+	if len(p.OutputTensors) > 0 {
+		fmt.Fprintf(&sb, "outputs=%v\n", p.OutputTensors)
+	}
+	if p.Alignment > 1 {
+		fmt.Fprintf(&sb, "align=%d\n", p.Alignment)
+	}
+	if len(p.CapacitySchedule) > 0 {
+		fmt.Fprintf(&sb, "cap_schedule=%v\n", p.CapacitySchedule)
+	}
+	for i, t := range p.Tensors {
+		if t.CompressionRatio != 0 || t.DecompressCost != 0 {
+			fmt.Fprintf(&sb, "t%d|%dx%d|ratio=%g|decompress=%g\n", i, t.Width, t.Height, t.CompressionRatio, t.DecompressCost)
+			continue
+		}
+		fmt.Fprintf(&sb, "t%d|%dx%d\n", i, t.Width, t.Height)
+	}
+	for i, op := range p.Ops {
+		fmt.Fprintf(&sb, "op%d|%s|in=%v|out=%v|cost=%d\n",
+			i, op.OpType, op.Inputs, op.Outputs, op.BaseCost)
+	}
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
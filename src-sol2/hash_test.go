@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+// TestHashSolution checks retention is hashed as a set and latencies not at
+// all, while granularity, traversal and op order change the hash
+func TestHashSolution(t *testing.T) {
+	base := func() *Solution {
+		return &Solution{Subgraphs: []Subgraph{
+			{Ops: []int{0, 1}, Granularity: [3]int{128, 128, 1}, TensorsToRetain: []int{2, 1}, TraversalOrder: []int{0, 1, 3, 2}, SubgraphLatency: 100},
+			{Ops: []int{2}, Granularity: [3]int{256, 256, 1}},
+		}}
+	}
+	want := HashSolution(base())
+
+	for _, tc := range []struct {
+		name  string
+		edit  func(sol *Solution)
+		equal bool
+	}{
+		{"retention reordered", func(sol *Solution) { sol.Subgraphs[0].TensorsToRetain = []int{1, 2} }, true},
+		{"retention repeated", func(sol *Solution) { sol.Subgraphs[0].TensorsToRetain = []int{1, 2, 1} }, true},
+		{"latency changed", func(sol *Solution) { sol.Subgraphs[0].SubgraphLatency = 200 }, true},
+		{"granularity changed", func(sol *Solution) { sol.Subgraphs[1].Granularity = [3]int{128, 256, 1} }, false},
+		{"traversal changed", func(sol *Solution) { sol.Subgraphs[0].TraversalOrder = []int{0, 1, 2, 3} }, false},
+		{"ops reordered", func(sol *Solution) { sol.Subgraphs[0].Ops = []int{1, 0} }, false},
+		{"retention changed", func(sol *Solution) { sol.Subgraphs[0].TensorsToRetain = []int{2} }, false},
+		{"dataflow changed", func(sol *Solution) { sol.Subgraphs[1].Dataflow = InputStationary }, false},
+	} {
+		sol := base()
+		tc.edit(sol)
+		if got := HashSolution(sol); (got == want) != tc.equal {
+			t.Errorf("%s: hash equal %v, want %v", tc.name, got == want, tc.equal)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// HintKind selects what a SubgraphHint asks of the solver
+type HintKind int
+
+const (
+	// HintPin keeps all of Ops together in one subgraph
+	HintPin HintKind = iota
+	// HintForbid keeps the ops in Ops out of each other's subgraph
+	HintForbid
+	// HintGranularity pins Ops like HintPin and also fixes their
+	// subgraph's granularity to Granularity
+	HintGranularity
+)
+
+// SubgraphHint is a user-provided grouping constraint for SolveWithHints
+type SubgraphHint struct {
+	Kind HintKind
+	Ops  []int
+	// Granularity is the [w,h,k] a HintGranularity fixes
+	Granularity [3]int
+}
+
+// FusionConstraints is the compiled form of a hint list consulted by the
+// fusion passes. A nil *FusionConstraints allows every fusion.
+type FusionConstraints struct {
+	PinnedGroups [][]int
+	pinOf        map[int]int
+	forbidden    map[[2]int]bool
+	// granOf maps a pinned group's index to its fixed granularity
+	granOf map[int][3]int
+}
+
+// NewFusionConstraints validates hints against the graph and compiles them.
+// Pins that overlap an earlier pin or cannot form a valid subgraph are dropped
+// with a warning.
+func NewFusionConstraints(p *Problem, gi *GraphInfo, hints []SubgraphHint) *FusionConstraints {
+	fc := &FusionConstraints{
+		pinOf:     make(map[int]int),
+		forbidden: make(map[[2]int]bool),
+		granOf:    make(map[int][3]int),
+	}
+
+	for _, hint := range hints {
+		if hint.Kind != HintForbid {
+			continue
+		}
+		ops := uniqueInts(hint.Ops)
+		for i := 0; i < len(ops); i++ {
+			for j := i + 1; j < len(ops); j++ {
+				fc.forbidden[opPair(ops[i], ops[j])] = true
+			}
+		}
+	}
+
+	for hIdx, hint := range hints {
+		if hint.Kind != HintPin && hint.Kind != HintGranularity {
+			continue
+		}
+		ops := uniqueInts(hint.Ops)
+		if len(ops) == 0 {
+			continue
+		}
+
+		valid := true
+		for _, opIdx := range ops {
+			if opIdx < 0 || opIdx >= len(p.Ops) {
+				fmt.Fprintf(progress, "  WARNING: hint %d: op %d out of range, ignoring pin\n", hIdx, opIdx)
+				valid = false
+				break
+			}
+			if _, taken := fc.pinOf[opIdx]; taken {
+				fmt.Fprintf(progress, "  WARNING: hint %d: op %d already pinned, ignoring pin\n", hIdx, opIdx)
+				valid = false
+				break
+			}
+		}
+		if valid && !isTopologicallyValid(p, gi, ops) {
+			fmt.Fprintf(progress, "  WARNING: hint %d: ops %v cannot form one subgraph, ignoring pin\n", hIdx, ops)
+			valid = false
+		}
+		if valid && p.MaxSubgraphOps > 0 && len(ops) > p.MaxSubgraphOps {
+			fmt.Fprintf(progress, "  WARNING: hint %d: %d ops exceed max_subgraph_ops %d, ignoring pin\n", hIdx, len(ops), p.MaxSubgraphOps)
+			valid = false
+		}
+		if valid && !fusible(p, ops) {
+			fmt.Fprintf(progress, "  WARNING: hint %d: ops %v include an unfusable op, ignoring pin\n", hIdx, ops)
+			valid = false
+		}
+		if valid && !fc.Allows(ops) {
+			fmt.Fprintf(progress, "  WARNING: hint %d: ops %v contain a forbidden pair, ignoring pin\n", hIdx, ops)
+			valid = false
+		}
+		if !valid {
+			continue
+		}
+
+		ops = sortOpsTopologically(gi, ops)
+		for _, opIdx := range ops {
+			fc.pinOf[opIdx] = len(fc.PinnedGroups)
+		}
+		if hint.Kind == HintGranularity {
+			fc.granOf[len(fc.PinnedGroups)] = hint.Granularity
+		}
+		fc.PinnedGroups = append(fc.PinnedGroups, ops)
+	}
+
+	return fc
+}
+
+func opPair(a, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int{a, b}
+}
+
+// IsPinned reports whether opIdx belongs to a pinned group
+func (fc *FusionConstraints) IsPinned(opIdx int) bool {
+	if fc == nil {
+		return false
+	}
+	_, ok := fc.pinOf[opIdx]
+	return ok
+}
+
+// Allows reports whether ops may share a subgraph: no two of them are
+// forbidden together, and if one is pinned, ops are exactly its group, as
+// a pinned group is atomic
+func (fc *FusionConstraints) Allows(ops []int) bool {
+	if fc == nil {
+		return true
+	}
+	for _, opIdx := range ops {
+		if fc.IsPinned(opIdx) {
+			_, exact := fc.groupOf(ops)
+			return exact
+		}
+	}
+	if len(fc.forbidden) == 0 {
+		return true
+	}
+	for i := 0; i < len(ops); i++ {
+		for j := i + 1; j < len(ops); j++ {
+			if fc.forbidden[opPair(ops[i], ops[j])] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// splitChainAtPins removes pinned ops from a chain, returning the unpinned
+// runs that chain fusion may still work on.
+func (fc *FusionConstraints) splitChainAtPins(chain []int) [][]int {
+	if fc == nil || len(fc.pinOf) == 0 {
+		return [][]int{chain}
+	}
+	var runs [][]int
+	var current []int
+	for _, opIdx := range chain {
+		if fc.IsPinned(opIdx) {
+			if len(current) > 0 {
+				runs = append(runs, current)
+				current = nil
+			}
+			continue
+		}
+		current = append(current, opIdx)
+	}
+	if len(current) > 0 {
+		runs = append(runs, current)
+	}
+	return runs
+}
+
+// SolveWithHints runs the optimized pipeline while honoring user hints:
+// pinned groups are scheduled as atomic subgraphs and forbidden pairs are
+// never fused. Granularity, traversal and retention are still optimized,
+// except the granularity of groups a HintGranularity fixes. It returns an
+// error if such a group cannot be pinned or its granularity does not fit in
+// fast memory, or if the solution does not run every pinned group as one
+// subgraph, as when no granularity fits the group and recovery splits it.
+func SolveWithHints(p *Problem, gi *GraphInfo, hints []SubgraphHint) (*Solution, error) {
+	fmt.Fprintln(progress, "  Running sol-2 optimized solver with hints...")
+
+	fc := NewFusionConstraints(p, gi, hints)
+	fmt.Fprintf(progress, "  Hints: %d pinned groups, %d forbidden pairs, %d fixed granularities\n",
+		len(fc.PinnedGroups), len(fc.forbidden), len(fc.granOf))
+
+	for hIdx, hint := range hints {
+		if hint.Kind != HintGranularity {
+			continue
+		}
+		g, ok := fc.groupOf(hint.Ops)
+		if !ok {
+			return nil, fmt.Errorf("hint %d: ops %v cannot be pinned as one subgraph", hIdx, hint.Ops)
+		}
+		group, gran := fc.PinnedGroups[g], fc.granOf[g]
+		if gran[0] <= 0 || gran[1] <= 0 || gran[2] <= 0 {
+			return nil, fmt.Errorf("hint %d: ops %v: %w", hIdx, group, &GranularityError{Granularity: gran})
+		}
+		if ws := ComputeWorkingSet(p, group, gran, nil); ws > p.FastMemoryCapacity {
+			return nil, fmt.Errorf("hint %d: granularity %v for ops %v needs %d, capacity is %d",
+				hIdx, gran, group, ws, p.FastMemoryCapacity)
+		}
+	}
+
+	defer cacheFusions(p)()
+	sol := optimizeScheduleConstrained(p, gi, fc)
+	sol, err := verifyOrRecover(p, gi, sol)
+	if err != nil {
+		return nil, err
+	}
+
+	for g, group := range fc.PinnedGroups {
+		sg, ok := subgraphRunning(sol, group)
+		if !ok {
+			return nil, fmt.Errorf("pinned ops %v do not run as one subgraph", group)
+		}
+		if gran, fixed := fc.granOf[g]; fixed && sg.Granularity != gran {
+			return nil, fmt.Errorf("pinned ops %v run at granularity %v, not %v", group, sg.Granularity, gran)
+		}
+	}
+	return sol, nil
+}
+
+// groupOf returns the index of the pinned group made of exactly ops
+func (fc *FusionConstraints) groupOf(ops []int) (int, bool) {
+	ops = uniqueInts(ops)
+	if fc == nil || len(ops) == 0 {
+		return 0, false
+	}
+	g, ok := fc.pinOf[ops[0]]
+	if !ok || len(fc.PinnedGroups[g]) != len(ops) {
+		return 0, false
+	}
+	for _, opIdx := range ops {
+		if pin, ok := fc.pinOf[opIdx]; !ok || pin != g {
+			return 0, false
+		}
+	}
+	return g, true
+}
+
+// fixGranularities sets the fixed granularity of every schedule entry that
+// is a pinned group with one
+func (fc *FusionConstraints) fixGranularities(schedule []ScheduleEntry) {
+	if fc == nil || len(fc.granOf) == 0 {
+		return
+	}
+	for i := range schedule {
+		if g, ok := fc.groupOf(schedule[i].Ops); ok {
+			if gran, fixed := fc.granOf[g]; fixed {
+				schedule[i].Granularity = gran
+				schedule[i].FixedGranularity = true
+			}
+		}
+	}
+}
+
+// subgraphRunning returns the subgraph of sol that runs exactly ops
+func subgraphRunning(sol *Solution, ops []int) (Subgraph, bool) {
+	want := make(map[int]bool, len(ops))
+	for _, opIdx := range ops {
+		want[opIdx] = true
+	}
+	for _, sg := range sol.Subgraphs {
+		got := uniqueInts(sg.Ops)
+		if len(got) != len(want) {
+			continue
+		}
+		same := true
+		for _, opIdx := range got {
+			same = same && want[opIdx]
+		}
+		if same {
+			return sg, true
+		}
+	}
+	return Subgraph{}, false
+}
+
+// pinnedGroupsCopy returns the pinned groups sorted by their first op so the
+// group list handed to the scheduler is stable.
+func (fc *FusionConstraints) pinnedGroupsCopy() [][]int {
+	if fc == nil {
+		return nil
+	}
+	groups := make([][]int, len(fc.PinnedGroups))
+	for i, g := range fc.PinnedGroups {
+		groups[i] = append([]int{}, g...)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0] < groups[j][0]
+	})
+	return groups
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// runsAlone reports whether some subgraph of sol runs exactly ops
+func runsAlone(sol *Solution, ops []int) bool {
+	_, ok := subgraphRunning(sol, ops)
+	return ok
+}
+
+// TestSolveWithHintsPin checks a pin changes the grouping: the unhinted
+// solve fuses ops 3 and 4 with the final pointwise ops, and cross-chain
+// fusion must not merge the pinned pair with anything else.
+func TestSolveWithHintsPin(t *testing.T) {
+	p, err := ReadProblem("../benchmarks/mlsys-2026-5.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gi := AnalyzeGraph(p)
+	pin := []int{3, 4}
+
+	base, err := SolveOptimized(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runsAlone(base, pin) {
+		t.Fatalf("unhinted solve already runs %v alone", pin)
+	}
+
+	sol, err := SolveWithHints(p, gi, []SubgraphHint{{Kind: HintPin, Ops: pin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !runsAlone(sol, pin) {
+		t.Errorf("hinted solve does not run %v as one subgraph", pin)
+	}
+	if _, err := EvaluateSolution(p, sol); err != nil {
+		t.Errorf("hinted solution: %v", err)
+	}
+}
+
+// TestSolveWithHintsPinTooLarge pins two independent ops whose subgraph
+// cannot fit while each fits alone. Recovery would split them, so the
+// solve must fail instead of returning them apart.
+func TestSolveWithHintsPinTooLarge(t *testing.T) {
+	p := &Problem{
+		Tensors: []Tensor{{Width: 1, Height: 1}, {Width: 1, Height: 1}, {Width: 1, Height: 1}, {Width: 1, Height: 1}},
+		Ops: []Op{
+			{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 10},
+			{OpType: "Pointwise", Inputs: []int{2}, Outputs: []int{3}, BaseCost: 10},
+		},
+		FastMemoryCapacity:  3,
+		SlowMemoryBandwidth: 1,
+		NativeGranularity:   [2]int{1, 1},
+	}
+	gi := AnalyzeGraph(p)
+
+	sol, err := SolveWithHints(p, gi, []SubgraphHint{{Kind: HintPin, Ops: []int{0, 1}}})
+	if err == nil {
+		var groups [][]int
+		for _, sg := range sol.Subgraphs {
+			groups = append(groups, slices.Clone(sg.Ops))
+		}
+		t.Errorf("SolveWithHints = %v, want an error", groups)
+	}
+}
+
+// TestSolveWithHintsGranularity fixes the granularity of ops 1 and 2 of
+// mlsys-2026-5, which the unhinted solve runs at [16 512 512], and checks
+// the output keeps it unchanged, or that an unusable one is an error
+// naming the hint and its ops
+func TestSolveWithHintsGranularity(t *testing.T) {
+	p, err := ReadProblem("../benchmarks/mlsys-2026-5.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gi := AnalyzeGraph(p)
+	ops := []int{1, 2}
+
+	for _, tc := range []struct {
+		gran [3]int
+		want string
+	}{
+		{[3]int{16, 512, 512}, ""},
+		{[3]int{8, 512, 512}, ""},
+		{[3]int{16, 256, 512}, ""},
+		{[3]int{0, 512, 512}, "hint 0: ops [1 2]: invalid granularity [0,512,512]"},
+		{[3]int{2048, 2048, 2048}, "hint 0: granularity [2048 2048 2048] for ops [1 2] needs"},
+	} {
+		sol, err := SolveWithHints(p, gi, []SubgraphHint{{Kind: HintGranularity, Ops: ops, Granularity: tc.gran}})
+		if tc.want != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("%v: error %v, want %q", tc.gran, err, tc.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tc.gran, err)
+			continue
+		}
+		sg, ok := subgraphRunning(sol, ops)
+		if !ok {
+			t.Errorf("%v: no subgraph runs %v", tc.gran, ops)
+		} else if sg.Granularity != tc.gran {
+			t.Errorf("%v: ops %v run at %v", tc.gran, ops, sg.Granularity)
+		}
+		if _, err := EvaluateSolution(p, sol); err != nil {
+			t.Errorf("%v: %v", tc.gran, err)
+		}
+	}
+}
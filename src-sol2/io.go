@@ -1,11 +1,32 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 )
 
+// stdin and stdout are where problems read from "-" and solutions written
+// to "-" go. progress receives solver progress and warnings; it is moved to
+// stderr whenever stdout carries JSON.
+var (
+	stdin    io.Reader = os.Stdin
+	stdout   io.Writer = os.Stdout
+	progress io.Writer = os.Stdout
+)
+
+// readInput reads filename, or standard input if filename is "-"
+func readInput(filename string) ([]byte, error) {
+	if filename == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(filename)
+}
+
+// ProblemJSON is the benchmark file format. Optional lists are pointers so
+// an absent list and an empty one read back as they were written.
 type ProblemJSON struct {
 	Widths              []int    `json:"widths"`
 	Heights             []int    `json:"heights"`
@@ -16,6 +37,16 @@ type ProblemJSON struct {
 	FastMemoryCapacity  int64    `json:"fast_memory_capacity"`
 	SlowMemoryBandwidth int64    `json:"slow_memory_bandwidth"`
 	NativeGranularity   [2]int   `json:"native_granularity"`
+	StoreBandwidth      int64    `json:"store_bandwidth,omitempty"`
+	PinnedTensors       *[]int   `json:"pinned_tensors,omitempty"`
+	MaxSubgraphOps      int      `json:"max_subgraph_ops,omitempty"`
+	Unfusable           *[]int   `json:"unfusable,omitempty"`
+	OutputTensors       *[]int   `json:"output_tensors,omitempty"`
+	Alignment           int64    `json:"alignment,omitempty"`
+	CapacitySchedule    *[]int64 `json:"capacity_schedule,omitempty"`
+
+	CompressionRatios []float64 `json:"compression_ratios,omitempty"`
+	DecompressCosts   []float64 `json:"decompress_costs,omitempty"`
 }
 
 type SolutionJSON struct {
@@ -24,10 +55,17 @@ type SolutionJSON struct {
 	TensorsToRetain   [][]int   `json:"tensors_to_retain"`
 	TraversalOrders   []*[]int  `json:"traversal_orders"`
 	SubgraphLatencies []float64 `json:"subgraph_latencies"`
+	// Dataflows is written only when some subgraph is not output-stationary
+	Dataflows []string `json:"dataflows,omitempty"`
+	// PrimaryOutputs is written only when some subgraph sets one; null
+	// entries use the default primary output
+	PrimaryOutputs []*int `json:"primary_outputs,omitempty"`
 }
 
+// ReadProblem reads one problem from filename, or from standard input if
+// filename is "-"
 func ReadProblem(filename string) (*Problem, error) {
-	data, err := os.ReadFile(filename)
+	data, err := readInput(filename)
 	if err != nil {
 		return nil, fmt.Errorf("reading problem file: %w", err)
 	}
@@ -36,14 +74,111 @@ func ReadProblem(filename string) (*Problem, error) {
 	if err := json.Unmarshal(data, &pj); err != nil {
 		return nil, fmt.Errorf("parsing problem JSON: %w", err)
 	}
+	return problemFromJSON(pj)
+}
+
+// ReadProblems reads a file holding either one problem object or a JSON
+// array of them, as used to bundle a suite of related graphs. A filename of
+// "-" reads standard input.
+func ReadProblems(filename string) ([]*Problem, error) {
+	data, err := readInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading problem file: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '[' {
+		var pj ProblemJSON
+		if err := json.Unmarshal(data, &pj); err != nil {
+			return nil, fmt.Errorf("parsing problem JSON: %w", err)
+		}
+		p, err := problemFromJSON(pj)
+		if err != nil {
+			return nil, err
+		}
+		return []*Problem{p}, nil
+	}
 
+	var bundle []ProblemJSON
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("parsing problem bundle JSON: %w", err)
+	}
+	if len(bundle) == 0 {
+		return nil, fmt.Errorf("problem bundle is empty")
+	}
+	problems := make([]*Problem, len(bundle))
+	for i, pj := range bundle {
+		p, err := problemFromJSON(pj)
+		if err != nil {
+			return nil, fmt.Errorf("problem %d: %w", i, err)
+		}
+		problems[i] = p
+	}
+	return problems, nil
+}
+
+// maxTensorElements bounds the size of one tensor. Sizes are summed in
+// int64 across working sets and whole graphs, which stays exact far below
+// overflow at this bound, and no real accelerator holds a larger tensor.
+const maxTensorElements int64 = 1 << 40
+
+// checkTensorSize rejects negative dimensions and tensors above
+// maxTensorElements. The product is taken in int64, so it cannot overflow
+// for any pair of int dimensions.
+func checkTensorSize(t Tensor) error {
+	if t.Width < 0 || t.Height < 0 {
+		return fmt.Errorf("negative dimensions %dx%d", t.Width, t.Height)
+	}
+	if size := int64(t.Width) * int64(t.Height); size > maxTensorElements {
+		return fmt.Errorf("%dx%d has %d elements, more than the supported %d", t.Width, t.Height, size, maxTensorElements)
+	}
+	return nil
+}
+
+// problemFromJSON validates pj and builds the Problem it describes
+func problemFromJSON(pj ProblemJSON) (*Problem, error) {
 	numTensors := len(pj.Widths)
+	if len(pj.Heights) != numTensors {
+		return nil, fmt.Errorf("%d widths but %d heights", numTensors, len(pj.Heights))
+	}
 	tensors := make([]Tensor, numTensors)
 	for i := 0; i < numTensors; i++ {
 		tensors[i] = Tensor{Width: pj.Widths[i], Height: pj.Heights[i]}
 	}
 
+	for i, t := range tensors {
+		if err := checkTensorSize(t); err != nil {
+			return nil, fmt.Errorf("tensor %d: %w", i, err)
+		}
+	}
+
+	if len(pj.CompressionRatios) > 0 {
+		if len(pj.CompressionRatios) != numTensors {
+			return nil, fmt.Errorf("%d compression ratios for %d tensors", len(pj.CompressionRatios), numTensors)
+		}
+		for i, ratio := range pj.CompressionRatios {
+			if ratio != 0 && ratio < 1 {
+				return nil, fmt.Errorf("tensor %d: compression ratio must be at least 1, got %g", i, ratio)
+			}
+			tensors[i].CompressionRatio = ratio
+		}
+	}
+	if len(pj.DecompressCosts) > 0 {
+		if len(pj.DecompressCosts) != numTensors {
+			return nil, fmt.Errorf("%d decompress costs for %d tensors", len(pj.DecompressCosts), numTensors)
+		}
+		for i, cost := range pj.DecompressCosts {
+			if cost < 0 {
+				return nil, fmt.Errorf("tensor %d: decompress cost must not be negative, got %g", i, cost)
+			}
+			tensors[i].DecompressCost = cost
+		}
+	}
+
 	numOps := len(pj.Inputs)
+	if len(pj.Outputs) != numOps || len(pj.BaseCosts) != numOps || len(pj.OpTypes) != numOps {
+		return nil, fmt.Errorf("%d input lists but %d output lists, %d base costs and %d op types",
+			numOps, len(pj.Outputs), len(pj.BaseCosts), len(pj.OpTypes))
+	}
 	ops := make([]Op, numOps)
 	for i := 0; i < numOps; i++ {
 		ops[i] = Op{
@@ -54,16 +189,196 @@ func ReadProblem(filename string) (*Problem, error) {
 		}
 	}
 
-	return &Problem{
+	for i, op := range ops {
+		if len(op.Outputs) == 0 {
+			return nil, fmt.Errorf("op %d has no outputs", i)
+		}
+		for _, tIdx := range op.Inputs {
+			if tIdx < 0 || tIdx >= numTensors {
+				return nil, fmt.Errorf("op %d: input tensor %d out of range", i, tIdx)
+			}
+		}
+		for _, tIdx := range op.Outputs {
+			if tIdx < 0 || tIdx >= numTensors {
+				return nil, fmt.Errorf("op %d: output tensor %d out of range", i, tIdx)
+			}
+		}
+	}
+
+	for i, op := range ops {
+		if op.OpType != "Transpose" {
+			continue
+		}
+		if len(op.Inputs) != 1 || len(op.Outputs) != 1 {
+			return nil, fmt.Errorf("op %d: Transpose needs one input and one output", i)
+		}
+		in, out := tensors[op.Inputs[0]], tensors[op.Outputs[0]]
+		if in.Width != out.Height || in.Height != out.Width {
+			return nil, fmt.Errorf("op %d: Transpose of %dx%d cannot produce %dx%d",
+				i, in.Width, in.Height, out.Width, out.Height)
+		}
+	}
+
+	var pinned, unfusable, outputs []int
+	var schedule []int64
+	if pj.PinnedTensors != nil {
+		pinned = *pj.PinnedTensors
+	}
+	if pj.Unfusable != nil {
+		unfusable = *pj.Unfusable
+	}
+	if pj.OutputTensors != nil {
+		outputs = *pj.OutputTensors
+	}
+	if pj.CapacitySchedule != nil {
+		schedule = *pj.CapacitySchedule
+	}
+
+	for _, tIdx := range pinned {
+		if tIdx < 0 || tIdx >= numTensors {
+			return nil, fmt.Errorf("pinned tensor %d out of range", tIdx)
+		}
+	}
+
+	for _, tIdx := range outputs {
+		if tIdx < 0 || tIdx >= numTensors {
+			return nil, fmt.Errorf("output tensor %d out of range", tIdx)
+		}
+	}
+
+	for _, opIdx := range unfusable {
+		if opIdx < 0 || opIdx >= numOps {
+			return nil, fmt.Errorf("unfusable op %d out of range", opIdx)
+		}
+	}
+
+	if pj.MaxSubgraphOps < 0 {
+		return nil, fmt.Errorf("max_subgraph_ops must not be negative, got %d", pj.MaxSubgraphOps)
+	}
+
+	if pj.Alignment < 0 {
+		return nil, fmt.Errorf("alignment must not be negative, got %d", pj.Alignment)
+	}
+
+	for i, c := range schedule {
+		if c < 0 {
+			return nil, fmt.Errorf("capacity_schedule[%d] must not be negative, got %d", i, c)
+		}
+	}
+
+	p := &Problem{
 		Tensors:             tensors,
 		Ops:                 ops,
 		FastMemoryCapacity:  pj.FastMemoryCapacity,
 		SlowMemoryBandwidth: pj.SlowMemoryBandwidth,
 		NativeGranularity:   pj.NativeGranularity,
-	}, nil
+		StoreBandwidth:      pj.StoreBandwidth,
+		PinnedTensors:       pinned,
+		MaxSubgraphOps:      pj.MaxSubgraphOps,
+		Unfusable:           unfusable,
+		OutputTensors:       outputs,
+		Alignment:           pj.Alignment,
+		CapacitySchedule:    schedule,
+	}
+	p.indexGraphOutputs()
+	if err := ValidateMatMulShapes(p); err != nil {
+		if !Config.AllowShapeMismatch {
+			return nil, err
+		}
+		fmt.Fprintf(progress, "  WARNING: %v\n", err)
+	}
+	return p, nil
 }
 
-func WriteSolution(filename string, sol *Solution) error {
+// WriteProblem writes p in the benchmark format ReadProblem reads, so a
+// problem built or transformed in code, such as by DeadOpElimination or
+// CommonSubexpressionElimination, can be saved. Reading the file back gives
+// a problem equal to p.
+func WriteProblem(filename string, p *Problem) error {
+	pj := ProblemJSON{
+		Widths:              make([]int, len(p.Tensors)),
+		Heights:             make([]int, len(p.Tensors)),
+		Inputs:              make([][]int, len(p.Ops)),
+		Outputs:             make([][]int, len(p.Ops)),
+		BaseCosts:           make([]int64, len(p.Ops)),
+		OpTypes:             make([]string, len(p.Ops)),
+		FastMemoryCapacity:  p.FastMemoryCapacity,
+		SlowMemoryBandwidth: p.SlowMemoryBandwidth,
+		NativeGranularity:   p.NativeGranularity,
+		StoreBandwidth:      p.StoreBandwidth,
+		MaxSubgraphOps:      p.MaxSubgraphOps,
+		Alignment:           p.Alignment,
+	}
+	if p.PinnedTensors != nil {
+		pj.PinnedTensors = &p.PinnedTensors
+	}
+	if p.Unfusable != nil {
+		pj.Unfusable = &p.Unfusable
+	}
+	if p.OutputTensors != nil {
+		pj.OutputTensors = &p.OutputTensors
+	}
+	if p.CapacitySchedule != nil {
+		pj.CapacitySchedule = &p.CapacitySchedule
+	}
+	for i, t := range p.Tensors {
+		pj.Widths[i] = t.Width
+		pj.Heights[i] = t.Height
+		if t.CompressionRatio != 0 || t.DecompressCost != 0 {
+			pj.CompressionRatios = make([]float64, len(p.Tensors))
+			pj.DecompressCosts = make([]float64, len(p.Tensors))
+		}
+	}
+	if pj.CompressionRatios != nil {
+		for i, t := range p.Tensors {
+			pj.CompressionRatios[i] = t.CompressionRatio
+			pj.DecompressCosts[i] = t.DecompressCost
+		}
+	}
+	for i, op := range p.Ops {
+		pj.Inputs[i] = op.Inputs
+		pj.Outputs[i] = op.Outputs
+		pj.BaseCosts[i] = op.BaseCost
+		pj.OpTypes[i] = op.OpType
+	}
+	data, err := json.MarshalIndent(pj, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling problem: %w", err)
+	}
+
+	return os.WriteFile(filename, data, 0644)
+}
+
+// ValidateMatMulShapes checks every MatMul against the layout PROBLEM.md
+// gives, in width x height: LHS [K x M], RHS [N x K], output [N x M]. The
+// solver and evaluator take K from the LHS width, so a problem that fails
+// this check is costed with a reduction depth it does not have.
+func ValidateMatMulShapes(p *Problem) error {
+	for i, op := range p.Ops {
+		if op.OpType != "MatMul" {
+			continue
+		}
+		if len(op.Inputs) != 2 || len(op.Outputs) != 1 {
+			return fmt.Errorf("op %d: MatMul needs two inputs and one output", i)
+		}
+		lhs, rhs, out := p.Tensors[op.Inputs[0]], p.Tensors[op.Inputs[1]], p.Tensors[op.Outputs[0]]
+		if lhs.Width != rhs.Height {
+			return fmt.Errorf("op %d: MatMul reduction mismatch: LHS %dx%d has K=%d but RHS %dx%d has K=%d",
+				i, lhs.Width, lhs.Height, lhs.Width, rhs.Width, rhs.Height, rhs.Height)
+		}
+		if out.Width != rhs.Width || out.Height != lhs.Height {
+			return fmt.Errorf("op %d: MatMul of LHS %dx%d and RHS %dx%d must produce %dx%d, not %dx%d",
+				i, lhs.Width, lhs.Height, rhs.Width, rhs.Height, rhs.Width, lhs.Height, out.Width, out.Height)
+		}
+	}
+	return nil
+}
+
+// WriteSolution writes sol, a solution to p, as JSON to filename, or to
+// standard output if filename is "-". The format has no drops: each
+// retention list names everything resident after its subgraph, so a tensor
+// kept through subgraphs that do not read it is listed by each of them.
+func WriteSolution(filename string, p *Problem, sol *Solution) error {
 	sj := SolutionJSON{
 		Subgraphs:         make([][]int, len(sol.Subgraphs)),
 		Granularities:     make([][3]int, len(sol.Subgraphs)),
@@ -72,14 +387,18 @@ func WriteSolution(filename string, sol *Solution) error {
 		SubgraphLatencies: make([]float64, len(sol.Subgraphs)),
 	}
 
+	resident := make(map[int]bool)
 	for i, sg := range sol.Subgraphs {
 		sj.Subgraphs[i] = sg.Ops
 		sj.Granularities[i] = sg.Granularity
-		if sg.TensorsToRetain == nil {
-			sj.TensorsToRetain[i] = []int{}
-		} else {
-			sj.TensorsToRetain[i] = sg.TensorsToRetain
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+		retain := append([]int{}, sg.TensorsToRetain...)
+		for _, tIdx := range sortedKeys(resident) {
+			if !containsInt(retain, tIdx) {
+				retain = append(retain, tIdx)
+			}
 		}
+		sj.TensorsToRetain[i] = retain
 		if len(sg.TraversalOrder) > 0 {
 			order := make([]int, len(sg.TraversalOrder))
 			copy(order, sg.TraversalOrder)
@@ -87,7 +406,27 @@ func WriteSolution(filename string, sol *Solution) error {
 		} else {
 			sj.TraversalOrders[i] = nil
 		}
-		sj.SubgraphLatencies[i] = sg.SubgraphLatency
+		sj.SubgraphLatencies[i] = roundLatency(sg.SubgraphLatency)
+	}
+
+	for _, sg := range sol.Subgraphs {
+		if sg.Dataflow != OutputStationary {
+			sj.Dataflows = make([]string, len(sol.Subgraphs))
+			for i := range sol.Subgraphs {
+				sj.Dataflows[i] = sol.Subgraphs[i].Dataflow.String()
+			}
+			break
+		}
+	}
+
+	for _, sg := range sol.Subgraphs {
+		if sg.PrimaryOutput != nil {
+			sj.PrimaryOutputs = make([]*int, len(sol.Subgraphs))
+			for i := range sol.Subgraphs {
+				sj.PrimaryOutputs[i] = sol.Subgraphs[i].PrimaryOutput
+			}
+			break
+		}
 	}
 
 	data, err := json.MarshalIndent(sj, "", "  ")
@@ -95,5 +434,60 @@ func WriteSolution(filename string, sol *Solution) error {
 		return fmt.Errorf("marshaling solution: %w", err)
 	}
 
+	if filename == "-" {
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	}
 	return os.WriteFile(filename, data, 0644)
 }
+
+// ReadSolution reads a solution from filename. Each retention list names
+// everything resident after its subgraph, so a subgraph drops whatever the
+// previous one listed and it does not.
+func ReadSolution(filename string) (*Solution, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading solution file: %w", err)
+	}
+
+	var sj SolutionJSON
+	if err := json.Unmarshal(data, &sj); err != nil {
+		return nil, fmt.Errorf("parsing solution JSON: %w", err)
+	}
+
+	n := len(sj.Subgraphs)
+	if len(sj.Granularities) != n || len(sj.TensorsToRetain) != n {
+		return nil, fmt.Errorf("solution has %d subgraphs but %d granularities and %d retention lists",
+			n, len(sj.Granularities), len(sj.TensorsToRetain))
+	}
+
+	subgraphs := make([]Subgraph, n)
+	for i := 0; i < n; i++ {
+		subgraphs[i] = Subgraph{
+			Ops:             sj.Subgraphs[i],
+			Granularity:     sj.Granularities[i],
+			TensorsToRetain: sj.TensorsToRetain[i],
+		}
+		if i > 0 {
+			subgraphs[i].TensorsToDrop = setDifference(sj.TensorsToRetain[i-1], sj.TensorsToRetain[i])
+		}
+		if i < len(sj.TraversalOrders) && sj.TraversalOrders[i] != nil {
+			subgraphs[i].TraversalOrder = *sj.TraversalOrders[i]
+		}
+		if i < len(sj.SubgraphLatencies) {
+			subgraphs[i].SubgraphLatency = sj.SubgraphLatencies[i]
+		}
+		if i < len(sj.Dataflows) {
+			df, err := ParseDataflow(sj.Dataflows[i])
+			if err != nil {
+				return nil, fmt.Errorf("subgraph %d: %w", i, err)
+			}
+			subgraphs[i].Dataflow = df
+		}
+		if i < len(sj.PrimaryOutputs) {
+			subgraphs[i].PrimaryOutput = sj.PrimaryOutputs[i]
+		}
+	}
+
+	return &Solution{Subgraphs: subgraphs}, nil
+}
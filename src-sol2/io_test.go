@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validProblemJSON is a MatMul of two 64x64 tensors, small enough to edit
+// into each malformed case below
+func validProblemJSON() ProblemJSON {
+	return ProblemJSON{
+		Widths:              []int{64, 64, 64},
+		Heights:             []int{64, 64, 64},
+		Inputs:              [][]int{{0, 1}},
+		Outputs:             [][]int{{2}},
+		BaseCosts:           []int64{1000},
+		OpTypes:             []string{"MatMul"},
+		FastMemoryCapacity:  50000,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{64, 64},
+	}
+}
+
+func TestProblemFromJSONValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(pj *ProblemJSON)
+		want string
+	}{
+		{"valid", func(pj *ProblemJSON) {}, ""},
+		{"short heights", func(pj *ProblemJSON) { pj.Heights = pj.Heights[:2] }, "3 widths but 2 heights"},
+		{"short op types", func(pj *ProblemJSON) { pj.OpTypes = nil }, "0 op types"},
+		{"short outputs", func(pj *ProblemJSON) { pj.Outputs = nil }, "but 0 output lists"},
+		{"short base costs", func(pj *ProblemJSON) { pj.BaseCosts = nil }, "0 base costs"},
+		{"input out of range", func(pj *ProblemJSON) { pj.Inputs[0][1] = 3 }, "op 0: input tensor 3 out of range"},
+		{"negative input", func(pj *ProblemJSON) { pj.Inputs[0][0] = -1 }, "op 0: input tensor -1 out of range"},
+		{"output out of range", func(pj *ProblemJSON) { pj.Outputs[0][0] = 7 }, "op 0: output tensor 7 out of range"},
+		{"no outputs", func(pj *ProblemJSON) { pj.Outputs[0] = []int{} }, "op 0 has no outputs"},
+		{"K mismatch", func(pj *ProblemJSON) { pj.Widths[0] = 32 }, "op 0: MatMul reduction mismatch: LHS 32x64 has K=32 but RHS 64x64 has K=64"},
+		{"output mismatch", func(pj *ProblemJSON) { pj.Heights[2] = 32 }, "must produce 64x64, not 64x32"},
+		{"negative max ops", func(pj *ProblemJSON) { pj.MaxSubgraphOps = -1 }, "max_subgraph_ops must not be negative, got -1"},
+		{"max ops", func(pj *ProblemJSON) { pj.MaxSubgraphOps = 3 }, ""},
+		{"transpose out of range", func(pj *ProblemJSON) {
+			pj.OpTypes[0] = "Transpose"
+			pj.Inputs[0] = []int{9}
+		}, "op 0: input tensor 9 out of range"},
+	}
+
+	for _, tc := range tests {
+		pj := validProblemJSON()
+		tc.edit(&pj)
+		_, err := problemFromJSON(pj)
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.want != "" && err == nil:
+			t.Errorf("%s: no error, want %q", tc.name, tc.want)
+		case tc.want != "" && !strings.Contains(err.Error(), tc.want):
+			t.Errorf("%s: error %q, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+// TestAllowShapeMismatch checks a K-mismatched problem loads only when
+// Config.AllowShapeMismatch is set, with its shapes as written
+func TestAllowShapeMismatch(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+	defer func(w io.Writer) { progress = w }(progress)
+	progress = io.Discard
+
+	pj := validProblemJSON()
+	pj.Widths[0] = 32
+	for _, allow := range []bool{false, true} {
+		Config.AllowShapeMismatch = allow
+		p, err := problemFromJSON(pj)
+		if (err == nil) != allow {
+			t.Errorf("allow %v: error %v", allow, err)
+		}
+		if allow && err == nil && p.Tensors[0].Width != 32 {
+			t.Errorf("allow %v: LHS width %d, want 32", allow, p.Tensors[0].Width)
+		}
+	}
+}
+
+// TestWriteProblemRoundTrip checks reading back what WriteProblem wrote
+// gives an equal problem, optional fields and all
+func TestWriteProblemRoundTrip(t *testing.T) {
+	bench, err := ReadProblem(filepath.Join("..", "benchmarks", "mlsys-2026-5.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := problemFromJSON(validProblemJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	full.StoreBandwidth = 4
+	full.PinnedTensors = []int{1}
+	full.MaxSubgraphOps = 3
+	full.Unfusable = []int{0}
+	full.OutputTensors = []int{2}
+	full.Alignment = 16
+	full.CapacitySchedule = []int64{0, 40000}
+	full.Tensors[0].CompressionRatio = 2
+	full.Tensors[0].DecompressCost = 0.5
+
+	empty, err := problemFromJSON(validProblemJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty.StoreBandwidth = empty.SlowMemoryBandwidth
+	empty.PinnedTensors = []int{}
+	empty.Unfusable = []int{}
+	empty.OutputTensors = []int{}
+	empty.CapacitySchedule = []int64{}
+
+	for _, tc := range []struct {
+		name string
+		p    *Problem
+	}{
+		{"benchmark", bench},
+		{"every optional field", full},
+		{"empty optional lists", empty},
+	} {
+		file := filepath.Join(t.TempDir(), "problem.json")
+		if err := WriteProblem(file, tc.p); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadProblem(file)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.p) {
+			t.Errorf("%s: read back %+v, want %+v", tc.name, got, tc.p)
+		}
+	}
+}
+
+// TestReadProblems checks a top-level object reads as one problem and an
+// array as a bundle, each entry through the single-problem parse
+func TestReadProblems(t *testing.T) {
+	small := validProblemJSON()
+	large := validProblemJSON()
+	large.FastMemoryCapacity = 80000
+	bad := validProblemJSON()
+	bad.Heights = bad.Heights[:2]
+
+	for _, tc := range []struct {
+		name       string
+		doc        interface{}
+		capacities []int64
+		want       string
+	}{
+		{"object", small, []int64{50000}, ""},
+		{"two-problem bundle", []ProblemJSON{small, large}, []int64{50000, 80000}, ""},
+		{"one-problem bundle", []ProblemJSON{large}, []int64{80000}, ""},
+		{"empty bundle", []ProblemJSON{}, nil, "problem bundle is empty"},
+		{"bad entry", []ProblemJSON{small, bad}, nil, "problem 1: 3 widths but 2 heights"},
+	} {
+		data, err := json.Marshal(tc.doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(t.TempDir(), "problems.json")
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		problems, err := ReadProblems(file)
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		case tc.want != "":
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("%s: error %v, want %q", tc.name, err, tc.want)
+			}
+			continue
+		}
+		var capacities []int64
+		for _, p := range problems {
+			capacities = append(capacities, p.FastMemoryCapacity)
+		}
+		if !reflect.DeepEqual(capacities, tc.capacities) {
+			t.Errorf("%s: read capacities %v, want %v", tc.name, capacities, tc.capacities)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MemoryBlock is one tensor or tile placed in fast memory
+type MemoryBlock struct {
+	Tensor int   `json:"tensor"`
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	// Full is true when the whole tensor is resident rather than one tile
+	Full bool `json:"full"`
+}
+
+// SubgraphLayout is the fast-memory address assignment for one subgraph
+type SubgraphLayout struct {
+	Subgraph int           `json:"subgraph"`
+	Blocks   []MemoryBlock `json:"blocks"`
+	// Used is the sum of block sizes, Peak the highest end address
+	Used int64 `json:"used"`
+	Peak int64 `json:"peak"`
+}
+
+// AssignMemoryLayout places every live tensor and tile of each subgraph at an
+// address below its capacity, CapacityAt, with a first-fit allocator. Tensors
+// that stay resident into the next subgraph keep their address, so the holes they pin
+// carry across the schedule. The sum-of-sizes working set can fit while the
+// layout fails; the error then names the subgraph and tensor that did not fit.
+// Pinned tensors sit at the bottom of the address space for the whole schedule.
+func AssignMemoryLayout(p *Problem, sol *Solution) ([]SubgraphLayout, error) {
+	layouts := make([]SubgraphLayout, 0, len(sol.Subgraphs))
+	var pinned []MemoryBlock
+	isPinned := make(map[int]bool)
+	var pinnedEnd int64
+	for _, tIdx := range uniqueInts(p.PinnedTensors) {
+		size := AlignedSize(p, FullTensorSize(p, tIdx))
+		pinned = append(pinned, MemoryBlock{Tensor: tIdx, Offset: pinnedEnd, Size: size, Full: true})
+		isPinned[tIdx] = true
+		pinnedEnd += size
+	}
+
+	carried := pinned
+	isCarried := isPinned
+	resident := make(map[int]bool)
+
+	for i, sg := range sol.Subgraphs {
+		capacity := p.CapacityAt(i)
+		if pinnedEnd > capacity {
+			return layouts, fmt.Errorf("subgraph %d: pinned tensors need %d, capacity is %d", i, pinnedEnd, capacity)
+		}
+		w, h, k := sg.Granularity[0], sg.Granularity[1], sg.Granularity[2]
+		boundary := GetSubgraphBoundary(p, sg.Ops)
+		retainSet := make(map[int]bool)
+		for _, tIdx := range sg.TensorsToRetain {
+			retainSet[tIdx] = true
+		}
+
+		blocks := append([]MemoryBlock{}, carried...)
+
+		place := func(tIdx int, size int64, full bool) error {
+			if size == 0 {
+				return nil
+			}
+			size = AlignedSize(p, size)
+			offset, ok := firstFit(blocks, size, capacity)
+			if !ok {
+				var used int64
+				for _, b := range blocks {
+					used += b.Size
+				}
+				return fmt.Errorf("subgraph %d: no free range of %d for tensor %d (%d of %d in use across %d blocks)",
+					i, size, tIdx, used, capacity, len(blocks))
+			}
+			blocks = append(blocks, MemoryBlock{Tensor: tIdx, Offset: offset, Size: size, Full: full})
+			return nil
+		}
+
+		// Whole tensors first: they outlive this subgraph, so placing them
+		// before the tiles keeps them low in the address space
+		for _, tIdx := range sortedKeys(retainSet) {
+			if isCarried[tIdx] {
+				continue
+			}
+			if err := place(tIdx, ResidentSize(p, tIdx), true); err != nil {
+				return layouts, err
+			}
+		}
+		// A tensor held compressed still needs a tile to work in
+		for _, tIdx := range sortedKeys(boundary.BoundaryInputs) {
+			if (isCarried[tIdx] || retainSet[tIdx]) && !retainedCompressed(p, tIdx) {
+				continue
+			}
+			if err := place(tIdx, InputTileSize(p, sg.Ops, tIdx, w, h, k), false); err != nil {
+				return layouts, err
+			}
+		}
+		for _, tIdx := range sortedKeys(boundary.BoundaryOutputs) {
+			if (retainSet[tIdx] || isCarried[tIdx]) && !retainedCompressed(p, tIdx) {
+				continue
+			}
+			if err := place(tIdx, OutputTileSize(p, tIdx, w, h), false); err != nil {
+				return layouts, err
+			}
+		}
+
+		sort.Slice(blocks, func(a, b int) bool {
+			return blocks[a].Offset < blocks[b].Offset
+		})
+		layout := SubgraphLayout{Subgraph: i, Blocks: blocks}
+		for _, b := range blocks {
+			layout.Used += b.Size
+			layout.Peak = MaxInt64(layout.Peak, b.Offset+b.Size)
+		}
+		layouts = append(layouts, layout)
+
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+		carried = append([]MemoryBlock{}, pinned...)
+		isCarried = make(map[int]bool)
+		for tIdx := range isPinned {
+			isCarried[tIdx] = true
+		}
+		for _, b := range blocks {
+			if resident[b.Tensor] && b.Full && !isPinned[b.Tensor] {
+				carried = append(carried, b)
+				isCarried[b.Tensor] = true
+			}
+		}
+	}
+
+	return layouts, nil
+}
+
+// firstFit returns the lowest offset where size elements fit between blocks
+func firstFit(blocks []MemoryBlock, size, capacity int64) (int64, bool) {
+	sorted := append([]MemoryBlock{}, blocks...)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Offset < sorted[b].Offset
+	})
+
+	var cursor int64
+	for _, b := range sorted {
+		if b.Offset-cursor >= size {
+			return cursor, true
+		}
+		cursor = MaxInt64(cursor, b.Offset+b.Size)
+	}
+	if capacity-cursor >= size {
+		return cursor, true
+	}
+	return 0, false
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys(m map[int]bool) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestAssignMemoryLayoutCapacitySchedule checks each subgraph is laid out
+// in its own capacity: tiles that fit the global capacity overflow a
+// subgraph whose scheduled capacity is smaller.
+func TestAssignMemoryLayoutCapacitySchedule(t *testing.T) {
+	p := &Problem{
+		Tensors: []Tensor{{Width: 64, Height: 64}, {Width: 64, Height: 64}, {Width: 64, Height: 64}},
+		Ops: []Op{
+			{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 100},
+			{OpType: "Pointwise", Inputs: []int{1}, Outputs: []int{2}, BaseCost: 100},
+		},
+		FastMemoryCapacity:  2 * 64 * 64,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{64, 64},
+	}
+	sol := &Solution{Subgraphs: []Subgraph{
+		{Ops: []int{0}, Granularity: [3]int{64, 64, 1}},
+		{Ops: []int{1}, Granularity: [3]int{64, 64, 1}},
+	}}
+	if _, err := AssignMemoryLayout(p, sol); err != nil {
+		t.Fatalf("global capacity: %v", err)
+	}
+
+	p.CapacitySchedule = []int64{0, 64 * 64}
+	_, err := AssignMemoryLayout(p, sol)
+	if err == nil || !strings.HasPrefix(err.Error(), "subgraph 1:") {
+		t.Errorf("scheduled capacity: err = %v, want subgraph 1 not to fit", err)
+	}
+}
+
+// TestAssignMemoryLayoutFragmentation retains two tensors, then releases
+// the lower one. The last subgraph's working set fits by sum of sizes, but
+// the tensor still held splits the free space into two holes too small for
+// its output tile.
+func TestAssignMemoryLayoutFragmentation(t *testing.T) {
+	p := &Problem{
+		Tensors: []Tensor{
+			{Width: 1, Height: 10}, {Width: 1, Height: 30}, {Width: 1, Height: 30},
+			{Width: 1, Height: 10}, {Width: 1, Height: 50},
+		},
+		Ops: []Op{
+			{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1, 2}, BaseCost: 1},
+			{OpType: "Pointwise", Inputs: []int{1}, Outputs: []int{3}, BaseCost: 1},
+			{OpType: "Pointwise", Inputs: []int{2}, Outputs: []int{4}, BaseCost: 1},
+		},
+		FastMemoryCapacity:  100,
+		SlowMemoryBandwidth: 1,
+		NativeGranularity:   [2]int{1, 1},
+	}
+	sol := &Solution{Subgraphs: []Subgraph{
+		{Ops: []int{0}, Granularity: [3]int{1, 30, 1}, TensorsToRetain: []int{1, 2}},
+		{Ops: []int{1}, Granularity: [3]int{1, 10, 1}, TensorsToRetain: []int{2}},
+		{Ops: []int{2}, Granularity: [3]int{1, 50, 1}, TensorsToRetain: []int{}},
+	}}
+	if _, err := EvaluateSolution(p, sol); err != nil {
+		t.Fatalf("sum of sizes: %v", err)
+	}
+
+	layouts, err := AssignMemoryLayout(p, sol)
+	if err == nil || !strings.HasPrefix(err.Error(), "subgraph 2:") {
+		t.Fatalf("err = %v, want subgraph 2 not to fit", err)
+	}
+	if len(layouts) != 2 {
+		t.Errorf("laid out %d subgraphs before failing, want 2", len(layouts))
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,6 +19,92 @@ type BenchmarkResult struct {
 }
 
 func main() {
+	workers := flag.Int("workers", runtime.NumCPU(), "number of benchmarks to solve concurrently")
+	strictNoPadding := flag.Bool("strict-no-padding", false, "only use granularities that tile every subgraph exactly")
+	overhead := flag.Float64("subgraph-overhead", 0, "fixed latency charged per subgraph, favoring fewer, larger subgraphs")
+	switchCost := flag.Float64("context-switch-cost", 0, "fixed latency charged between consecutive subgraphs, favoring fewer, larger subgraphs")
+	checkCosts := flag.Bool("check-costs", false, "report ops whose base cost is inconsistent with their shape")
+	fixCosts := flag.Bool("fix-costs", false, "like -check-costs, and replace the inconsistent costs")
+	seed := flag.Int64("seed", Config.Seed, "seed for randomized heuristics; equal seeds give identical solutions")
+	checkEstimates := flag.Bool("check-estimates", false, "report how far QuickEstimate is from the detailed latency of each final subgraph")
+	checkInvariants := flag.Bool("check-invariants", false, "verify solver invariants, such as op order within subgraphs, on every evaluation (slower)")
+	paddingPenalty := flag.Float64("padding-penalty", Config.PaddingPenalty, "weight of the compute sub-native tiles waste when ranking granularities (0 disables)")
+	allowShapeMismatch := flag.Bool("allow-shape-mismatch", false, "load problems whose MatMul operand and output shapes do not match, with a warning, instead of rejecting them")
+	spatialParts := flag.Int("spatial-parts", 1, "split each subgraph into this many independent subgraphs over its spatial tiles")
+	fast := flag.Bool("fast", false, "use the quick approximate solver, trading latency for solve time")
+	computeModel := flag.String("compute-model", Config.ComputeModel.String(), "how compute is priced: basecost (each op's base cost per step) or flops (tile arithmetic)")
+	opEfficiency := flag.String("op-efficiency", "", "FLOPs per latency unit by op type under -compute-model flops, e.g. MatMul=8192,Pointwise=64")
+	retainCompressed := flag.Bool("retain-compressed", false, "retain tensors with a compression ratio compressed, trading decompression compute for fast memory")
+	latencyDecimals := flag.Int("latency-decimals", Config.LatencyDecimals, "round stored subgraph latencies to this many decimals (negative keeps full precision)")
+	reusedInputs := flag.Int("retain-reused-inputs", Config.ReusedInputMinUses, "keep graph inputs read by at least this many subgraphs resident from first to last read (0 disables)")
+	heavyOpRatio := flag.Float64("heavy-op-ratio", Config.HeavyOpRatio, "base cost over native-step memory time above which cross-chain fusion treats an op as heavy")
+	refineCandidates := flag.Int("refine-candidates", Config.RefineCandidates, "best-ranked granularities the search evaluates in detail")
+	refineSpread := flag.Float64("refine-spread", Config.RefineSpread, "adapt -refine-candidates to how many candidates lie within this fraction of the best (0 keeps it fixed)")
+	inputStationary := flag.Bool("input-stationary", false, "run MatMul subgraphs input-stationary where cheaper; the choice is written under \"dataflows\", which other evaluators may ignore")
+	minTileArea := flag.Int("min-tile-area", Config.MinTileArea, "fewest output elements a fallback tile may cover before the problem is reported infeasible (0 disables)")
+	skipExisting := flag.Bool("skip-existing", false, "re-evaluate solutions newer than their problem instead of solving again")
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile, with samples labeled by solver phase, to this file")
+	flag.Parse()
+
+	Config.StrictNoPadding = *strictNoPadding
+	Config.PerSubgraphOverhead = *overhead
+	Config.ContextSwitchCost = *switchCost
+	Config.CheckCosts = *checkCosts || *fixCosts
+	Config.FixCosts = *fixCosts
+	Config.CheckEstimates = *checkEstimates
+	Config.Seed = *seed
+	Config.SkipExisting = *skipExisting
+	Config.Fast = *fast
+	Config.CheckInvariants = *checkInvariants
+	Config.SpatialParts = *spatialParts
+	Config.AllowShapeMismatch = *allowShapeMismatch
+	Config.PaddingPenalty = *paddingPenalty
+	Config.RetainCompressed = *retainCompressed
+	Config.LatencyDecimals = *latencyDecimals
+	Config.MinTileArea = *minTileArea
+	Config.ReusedInputMinUses = *reusedInputs
+	Config.HeavyOpRatio = *heavyOpRatio
+	Config.RefineCandidates = *refineCandidates
+	Config.RefineSpread = *refineSpread
+	Config.InputStationary = *inputStationary
+
+	if Config.RefineCandidates < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -refine-candidates must be at least 1, got %d\n", Config.RefineCandidates)
+		os.Exit(1)
+	}
+
+	var err error
+	if Config.ComputeModel, err = ParseComputeModel(*computeModel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if Config.OpEfficiency, err = ParseOpEfficiency(*opEfficiency); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *cpuProfile != "" {
+		stop, err := startCPUProfile(*cpuProfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer stop()
+	}
+
+	// Solver flags come before the mode, so they apply to every mode
+	if runCommand(flag.Args()) {
+		return
+	}
+
+	if args := flag.Args(); len(args) > 0 {
+		if err := solveOne(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	benchmarkDir := "../benchmarks"
 	outputDir := "./solutions"
 
@@ -38,75 +127,247 @@ func main() {
 	fmt.Println(strings.Repeat("=", 80))
 	fmt.Println("  MLSys 2026 DAG Optimization - Sol-2 Optimized Solver")
 	fmt.Println(strings.Repeat("=", 80))
-	fmt.Printf("Found %d benchmark files\n\n", len(files))
+	fmt.Printf("Found %d benchmark files, using %d workers\n\n", len(files), *workers)
+
+	results := runBenchmarks(files, outputDir, *workers)
+
+	// Print summary
+	fmt.Println(strings.Repeat("=", 80))
+	fmt.Println("  SUMMARY")
+	fmt.Println(strings.Repeat("=", 80))
+	fmt.Printf("%-30s %15s %12s %12s\n", "Benchmark", "Latency", "Subgraphs", "Time")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, result := range results {
+		fmt.Printf("%-30s %15.1f %12d %12v\n",
+			result.Name, result.Latency, result.Subgraphs, result.Time)
+	}
+
+	fmt.Println(strings.Repeat("=", 80))
+	fmt.Printf("Total benchmarks completed: %d\n", len(results))
+	fmt.Println(strings.Repeat("=", 80))
+}
+
+// runBenchmarks solves files on up to workers goroutines. Each problem writes
+// its own solution; the returned results keep the order of files, and of
+// problems within a bundle, so the summary is deterministic regardless of
+// completion order.
+func runBenchmarks(files []string, outputDir string, workers int) []BenchmarkResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type indexedResult struct {
+		idx     int
+		results []BenchmarkResult
+	}
+
+	jobs := make(chan int)
+	done := make(chan indexedResult, len(files))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				done <- indexedResult{i, processBenchmark(files[i], outputDir, i, len(files))}
+			}
+		}()
+	}
+
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	close(done)
+
+	ordered := make([][]BenchmarkResult, len(files))
+	for r := range done {
+		ordered[r.idx] = r.results
+	}
 
 	results := make([]BenchmarkResult, 0, len(files))
+	for _, r := range ordered {
+		results = append(results, r...)
+	}
+	return results
+}
 
-	for i, inputFile := range files {
-		baseName := filepath.Base(inputFile)
-		benchmarkName := strings.TrimSuffix(baseName, ".json")
-		outputFile := filepath.Join(outputDir, benchmarkName+"-solution.json")
+// processBenchmark solves every problem in one benchmark file and writes a
+// solution for each. A bundle of n problems is solved as benchmarks named
+// <file>.0 to <file>.<n-1>.
+func processBenchmark(inputFile, outputDir string, i, total int) []BenchmarkResult {
+	baseName := filepath.Base(inputFile)
+	benchmarkName := strings.TrimSuffix(baseName, ".json")
 
-		fmt.Printf("[%d/%d] Processing: %s\n", i+1, len(files), baseName)
-		fmt.Println(strings.Repeat("-", 80))
+	fmt.Fprintf(progress, "[%d/%d] Processing: %s\n", i+1, total, baseName)
 
-		startTime := time.Now()
+	problems, err := ReadProblems(inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  ✗ %s: error reading problem: %v\n\n", baseName, err)
+		return nil
+	}
 
-		problem, err := ReadProblem(inputFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Error reading problem: %v\n\n", err)
-			continue
+	var results []BenchmarkResult
+	for j, problem := range problems {
+		name, label := benchmarkName, baseName
+		if len(problems) > 1 {
+			name = fmt.Sprintf("%s.%d", benchmarkName, j)
+			label = name
 		}
+		outputFile := filepath.Join(outputDir, name+"-solution.json")
+		if result, ok := processProblem(problem, inputFile, outputFile, name, label); ok {
+			results = append(results, result)
+		}
+	}
+	return results
+}
 
-		fmt.Printf("  Problem: %d tensors, %d ops, capacity=%d, bandwidth=%d, native=[%d,%d]\n",
-			len(problem.Tensors), len(problem.Ops),
-			problem.FastMemoryCapacity, problem.SlowMemoryBandwidth,
-			problem.NativeGranularity[0], problem.NativeGranularity[1])
+// processProblem solves one problem read from inputFile and writes its
+// solution to outputFile; baseName identifies the problem in errors
+func processProblem(problem *Problem, inputFile, outputFile, benchmarkName, baseName string) (BenchmarkResult, bool) {
+	startTime := time.Now()
 
-		solution := SolveOptimized(problem)
+	fmt.Fprintf(progress, "  %s: %d tensors, %d ops, capacity=%d, bandwidth=%d, native=[%d,%d]\n",
+		benchmarkName, len(problem.Tensors), len(problem.Ops),
+		problem.FastMemoryCapacity, problem.SlowMemoryBandwidth,
+		problem.NativeGranularity[0], problem.NativeGranularity[1])
 
-		totalLat, err := EvaluateSolution(problem, solution)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Final validation error: %v\n", err)
-			totalLat = 0
-			for _, sg := range solution.Subgraphs {
-				totalLat += sg.SubgraphLatency
-			}
+	if Config.CheckCosts {
+		anomalies := NormalizeCosts(problem, Config.CostTolerance, Config.FixCosts)
+		reportCostAnomalies(anomalies, Config.FixCosts)
+	}
+
+	if Config.SkipExisting && isUpToDate(inputFile, outputFile) {
+		if result, ok := reuseSolution(problem, benchmarkName, outputFile, startTime); ok {
+			return result, true
 		}
+	}
 
-		elapsed := time.Since(startTime)
+	if err := CheckMinimumFootprint(problem); err != nil {
+		fmt.Fprintf(os.Stderr, "  ✗ %s: %v\n\n", baseName, err)
+		return BenchmarkResult{}, false
+	}
+
+	// Dead ops are dropped before solving and are absent from the solution
+	dce := DeadOpElimination(problem, AnalyzeGraph(problem))
+	var solution *Solution
+	var err error
+	if Config.Fast {
+		solution, err = SolveFast(dce.Problem, AnalyzeGraph(dce.Problem))
+	} else {
+		solution, err = SolveOptimized(dce.Problem)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  ✗ %s: %v\n\n", baseName, err)
+		return BenchmarkResult{}, false
+	}
+	NormalizeSolution(dce.Problem, solution)
+	if Config.SpatialParts > 1 {
+		splitSolutionSpatial(dce.Problem, solution, Config.SpatialParts)
+	}
+	solution = dce.MapSolution(solution)
+	CanonicalizeOpOrder(problem, AnalyzeGraph(problem), solution)
 
-		if err := WriteSolution(outputFile, solution); err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ Error writing solution: %v\n\n", err)
-			continue
+	if Config.StrictNoPadding {
+		if err := CheckNoPadding(problem, solution); err != nil {
+			fmt.Fprintf(os.Stderr, "  ✗ %s: %v\n\n", baseName, err)
+			return BenchmarkResult{}, false
 		}
+	}
 
-		fmt.Printf("  ✓ Total Latency: %.1f\n", totalLat)
-		fmt.Printf("  ✓ Subgraphs: %d\n", len(solution.Subgraphs))
-		fmt.Printf("  ✓ Time: %v\n", elapsed)
-		fmt.Printf("  ✓ Output: %s\n\n", outputFile)
+	totalLat, err := EvaluateSolution(problem, solution)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  ✗ %s: final validation error: %v\n", baseName, err)
+		totalLat = 0
+		for _, sg := range solution.Subgraphs {
+			totalLat += roundLatency(sg.SubgraphLatency)
+		}
+	}
 
-		results = append(results, BenchmarkResult{
-			Name:      benchmarkName,
-			Latency:   totalLat,
-			Subgraphs: len(solution.Subgraphs),
-			Time:      elapsed,
-		})
+	if Config.CheckEstimates {
+		reportEstimateAccuracy(EstimateAccuracyReport(problem, solution), Config.EstimateTolerance)
 	}
 
-	// Print summary
-	fmt.Println(strings.Repeat("=", 80))
-	fmt.Println("  SUMMARY")
-	fmt.Println(strings.Repeat("=", 80))
-	fmt.Printf("%-30s %15s %12s %12s\n", "Benchmark", "Latency", "Subgraphs", "Time")
-	fmt.Println(strings.Repeat("-", 80))
+	elapsed := time.Since(startTime)
 
-	for _, result := range results {
-		fmt.Printf("%-30s %15.1f %12d %12v\n",
-			result.Name, result.Latency, result.Subgraphs, result.Time)
+	if err := WriteSolution(outputFile, problem, solution); err != nil {
+		fmt.Fprintf(os.Stderr, "  ✗ %s: error writing solution: %v\n\n", baseName, err)
+		return BenchmarkResult{}, false
 	}
 
-	fmt.Println(strings.Repeat("=", 80))
-	fmt.Printf("Total benchmarks completed: %d/%d\n", len(results), len(files))
-	fmt.Println(strings.Repeat("=", 80))
+	fmt.Fprintf(progress, "  ✓ %s: latency %.1f, %d subgraphs, %v -> %s\n\n",
+		benchmarkName, totalLat, len(solution.Subgraphs), elapsed, outputFile)
+
+	return BenchmarkResult{
+		Name:      benchmarkName,
+		Latency:   totalLat,
+		Subgraphs: len(solution.Subgraphs),
+		Time:      elapsed,
+	}, true
+}
+
+// solveOne solves the single problem named by args[0] and writes its
+// solution to args[1]. Either may be "-" for standard input or output; a
+// solution written to standard output moves progress output to stderr, so
+// stdout carries only the JSON.
+func solveOne(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: [flags] <problem.json|-> <solution.json|->")
+	}
+	if args[1] == "-" {
+		progress = os.Stderr
+	}
+
+	problem, err := ReadProblem(args[0])
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(args[0]), ".json")
+	if args[0] == "-" {
+		name = "stdin"
+	}
+	if _, ok := processProblem(problem, args[0], args[1], name, name); !ok {
+		return fmt.Errorf("%s: no solution written", name)
+	}
+	return nil
+}
+
+// isUpToDate reports whether outputFile exists and was modified after inputFile
+func isUpToDate(inputFile, outputFile string) bool {
+	in, err := os.Stat(inputFile)
+	if err != nil {
+		return false
+	}
+	out, err := os.Stat(outputFile)
+	if err != nil {
+		return false
+	}
+	return out.ModTime().After(in.ModTime())
+}
+
+// reuseSolution reads and re-evaluates a previously written solution. It
+// returns false, after printing why, if the file cannot be used and the
+// benchmark must be solved again.
+func reuseSolution(problem *Problem, benchmarkName, outputFile string, startTime time.Time) (BenchmarkResult, bool) {
+	solution, err := ReadSolution(outputFile)
+	if err == nil {
+		var totalLat float64
+		totalLat, err = EvaluateSolution(problem, solution)
+		if err == nil {
+			elapsed := time.Since(startTime)
+			fmt.Fprintf(progress, "  ✓ %s: up to date, latency %.1f, %d subgraphs <- %s\n\n",
+				benchmarkName, totalLat, len(solution.Subgraphs), outputFile)
+			return BenchmarkResult{
+				Name:      benchmarkName,
+				Latency:   totalLat,
+				Subgraphs: len(solution.Subgraphs),
+				Time:      elapsed,
+			}, true
+		}
+	}
+	fmt.Fprintf(progress, "  WARNING: %s: cannot reuse %s, solving again: %v\n", benchmarkName, outputFile, err)
+	return BenchmarkResult{}, false
 }
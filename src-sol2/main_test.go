@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestSolveReproducible solves each problem twice at once, as concurrent
+// workers would, with the same seed, and checks both solution files are
+// byte-identical. Map iteration order once reordered groups and retentions
+// between runs.
+func TestSolveReproducible(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+	Config.Seed = 7
+
+	dir := t.TempDir()
+	for _, name := range []string{"mlsys-2026-5", "mlsys-2026-13"} {
+		input := filepath.Join("..", "benchmarks", name+".json")
+		outputs := []string{filepath.Join(dir, name+"-a.json"), filepath.Join(dir, name+"-b.json")}
+
+		var wg sync.WaitGroup
+		for _, output := range outputs {
+			p, err := ReadProblem(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, ok := processProblem(p, input, output, name, name); !ok {
+					t.Errorf("%s: no solution written", name)
+				}
+			}()
+		}
+		wg.Wait()
+
+		a, errA := os.ReadFile(outputs[0])
+		b, errB := os.ReadFile(outputs[1])
+		if errA != nil || errB != nil {
+			t.Fatalf("%s: %v, %v", name, errA, errB)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: two solves wrote different files", name)
+		}
+	}
+}
+
+// TestSolveOnePipe solves a problem piped through stdin into stdout and
+// checks stdout carries only the solution, with progress kept off it.
+func TestSolveOnePipe(t *testing.T) {
+	defer func(in io.Reader, out, prog io.Writer) { stdin, stdout, progress = in, out, prog }(stdin, stdout, progress)
+
+	input := filepath.Join("..", "benchmarks", "mlsys-2026-1.json")
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, prog bytes.Buffer
+	stdin, stdout, progress = bytes.NewReader(data), &out, &prog
+
+	if err := solveOne([]string{"-", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	if progress != os.Stderr {
+		t.Errorf("progress not moved to stderr")
+	}
+
+	file := filepath.Join(t.TempDir(), "solution.json")
+	if err := os.WriteFile(file, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sol, err := ReadSolution(file)
+	if err != nil {
+		t.Fatalf("stdout is not a solution: %v\n%s", err, out.String())
+	}
+	p, err := ReadProblem(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EvaluateSolution(p, sol); err != nil {
+		t.Errorf("piped solution invalid: %v", err)
+	}
+}
+
+// TestRunBenchmarksConcurrent solves two small problems on one worker and
+// on two, and checks the results keep the order of the files, each problem
+// writes its own solution and the latencies do not depend on the workers
+func TestRunBenchmarksConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, n := range []int{2, 3} {
+		file := filepath.Join(dir, fmt.Sprintf("chain-%d.json", n))
+		if err := WriteProblem(file, chainProblem(n)); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	var serial []BenchmarkResult
+	for _, workers := range []int{1, 2} {
+		outputDir := filepath.Join(dir, fmt.Sprintf("out-%d", workers))
+		if err := os.Mkdir(outputDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		results := runBenchmarks(files, outputDir, workers)
+		if len(results) != len(files) {
+			t.Fatalf("%d workers: %d results, want %d", workers, len(results), len(files))
+		}
+		for i, r := range results {
+			if want := strings.TrimSuffix(filepath.Base(files[i]), ".json"); r.Name != want {
+				t.Errorf("%d workers: result %d is %s, want %s", workers, i, r.Name, want)
+			}
+			if _, err := os.Stat(filepath.Join(outputDir, r.Name+"-solution.json")); err != nil {
+				t.Errorf("%d workers: %v", workers, err)
+			}
+			if serial != nil && r.Latency != serial[i].Latency {
+				t.Errorf("%d workers: %s latency %.1f, one worker gave %.1f", workers, r.Name, r.Latency, serial[i].Latency)
+			}
+		}
+		if serial == nil {
+			serial = results
+		}
+	}
+}
+
+// TestRunBenchmarksBundle checks a file holding a two-problem array is
+// solved as two benchmarks, <file>.0 and <file>.1, each with its own
+// solution and the latency the problem gets alone
+func TestRunBenchmarksBundle(t *testing.T) {
+	dir := t.TempDir()
+	var docs []string
+	var alone []BenchmarkResult
+	for _, n := range []int{2, 3} {
+		file := filepath.Join(dir, fmt.Sprintf("chain-%d.json", n))
+		if err := WriteProblem(file, chainProblem(n)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, string(data))
+		alone = append(alone, runBenchmarks([]string{file}, dir, 1)...)
+	}
+	bundle := filepath.Join(dir, "bundle.json")
+	if err := os.WriteFile(bundle, []byte("["+strings.Join(docs, ",")+"]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results := runBenchmarks([]string{bundle}, dir, 1)
+	if len(results) != 2 || len(alone) != 2 {
+		t.Fatalf("%d bundle results and %d alone, want 2 each", len(results), len(alone))
+	}
+	for i, r := range results {
+		if want := fmt.Sprintf("bundle.%d", i); r.Name != want {
+			t.Errorf("result %d is %s, want %s", i, r.Name, want)
+		}
+		if _, err := os.Stat(filepath.Join(dir, r.Name+"-solution.json")); err != nil {
+			t.Error(err)
+		}
+		if r.Latency != alone[i].Latency {
+			t.Errorf("%s: latency %.1f, alone %.1f", r.Name, r.Latency, alone[i].Latency)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+// MemOp is the direction of a MemEvent
+type MemOp int
+
+const (
+	// MemLoad brings a tile in from slow memory
+	MemLoad MemOp = iota
+	// MemStore evicts a tile to slow memory
+	MemStore
+)
+
+// String returns "load" or "store"
+func (m MemOp) String() string {
+	if m == MemStore {
+		return "store"
+	}
+	return "load"
+}
+
+// MarshalText writes the op by name in JSON traces
+func (m MemOp) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// MemEvent is one tile the step evaluator moves between slow and fast
+// memory. Step indexes the evaluator's steps in execution order; Tile and
+// KStep are the spatial tile and k-step it runs. X, Y, Width and Height
+// are the tile's region of Tensor, which may overhang a padded edge.
+type MemEvent struct {
+	Step   int   `json:"step"`
+	Tile   int   `json:"tile"`
+	KStep  int   `json:"k_step"`
+	Op     MemOp `json:"op"`
+	Tensor int   `json:"tensor"`
+	X      int   `json:"x"`
+	Y      int   `json:"y"`
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// GenerateMemoryTrace returns, in order, the loads and stores
+// EvaluateSubgraphDetailed charges for a subgraph under snake reuse. Loads
+// cost their bytes over the load bandwidth and stores theirs over the store
+// bandwidth, so the trace adds up to the evaluator's memory time. Tiles of
+// resident tensors are not moved and do not appear; compressed ones are
+// decompressed, which the evaluator counts as compute.
+func GenerateMemoryTrace(p *Problem, ops []int, gran [3]int, retain []int, trav []int, resident map[int]bool) ([]MemEvent, error) {
+	var trace []MemEvent
+	if _, err := walkSteps(p, ops, gran, retain, trav, resident, ReuseSnake, OutputStationary, &trace); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
+// inputTileRegion returns the origin and shape of the tile of input tIdx
+// that the step at tile (row, col) and kStep reads, mirroring
+// InputTileShape
+func inputTileRegion(p *Problem, ops []int, tIdx int, gran [3]int, row, col, kStep int) (x, y, w, h int) {
+	tw, th, tk := gran[0], gran[1], gran[2]
+	for _, opIdx := range ops {
+		op := p.Ops[opIdx]
+		for pos, inp := range op.Inputs {
+			if inp != tIdx {
+				continue
+			}
+			switch {
+			case op.OpType == "Transpose":
+				if consumedInOps(p, ops, op.Outputs[0]) {
+					x, y, w, h = inputTileRegion(p, ops, op.Outputs[0], gran, row, col, kStep)
+					return y, x, h, w
+				}
+				return row * th, col * tw, th, tw
+			case op.OpType == "MatMul" && pos == 0:
+				return kStep * tk, row * th, tk, th
+			case op.OpType == "MatMul":
+				return col * tw, kStep * tk, tw, tk
+			case isBroadcastInput(p, op, tIdx):
+				t := p.Tensors[tIdx]
+				return 0, 0, t.Width, t.Height
+			}
+			return col * tw, row * th, tw, th
+		}
+	}
+	return col * tw, row * th, tw, th
+}
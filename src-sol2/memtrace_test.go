@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestGenerateMemoryTrace checks a subgraph's trace moves the bytes the
+// evaluator charges and, at the load and store bandwidths, adds up to its
+// memory time. The subgraphs are memory-bound, so that is their latency.
+func TestGenerateMemoryTrace(t *testing.T) {
+	square := Tensor{Width: 512, Height: 512}
+	matmul := &Problem{
+		Tensors:             []Tensor{square, square, square},
+		Ops:                 []Op{{OpType: "MatMul", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 100}},
+		FastMemoryCapacity:  1 << 22,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{128, 128},
+	}
+	// Pointwise chains cheap enough that every step waits on memory
+	chain := func(n int) *Problem {
+		p := chainProblem(n)
+		for i := range p.Ops {
+			p.Ops[i].BaseCost = 10
+		}
+		return p
+	}
+	slowStore := chain(2)
+	slowStore.StoreBandwidth = 5
+
+	for _, tc := range []struct {
+		name     string
+		p        *Problem
+		ops      []int
+		gran     [3]int
+		retain   []int
+		trav     []int
+		resident map[int]bool
+	}{
+		{"matmul split K", matmul, []int{0}, [3]int{128, 128, 128}, nil, nil, nil},
+		{"matmul full K", matmul, []int{0}, [3]int{128, 256, 512}, nil, nil, nil},
+		{"matmul snake", matmul, []int{0}, [3]int{256, 256, 256}, nil, []int{0, 1, 3, 2}, nil},
+		{"pointwise retained", chain(3), []int{0, 1}, [3]int{64, 64, 1}, []int{2}, nil, nil},
+		{"resident input", chain(2), []int{1}, [3]int{128, 128, 1}, nil, nil, map[int]bool{1: true}},
+		{"slow store", slowStore, []int{0}, [3]int{128, 128, 1}, nil, nil, nil},
+	} {
+		trace, err := GenerateMemoryTrace(tc.p, tc.ops, tc.gran, tc.retain, tc.trav, tc.resident)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		bd, err := evaluateBreakdown(tc.p, tc.ops, tc.gran, tc.retain, tc.trav, tc.resident, ReuseSnake, OutputStationary)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		var loads, stores int64
+		for _, e := range trace {
+			if e.Op == MemStore {
+				stores += e.Bytes
+			} else {
+				loads += e.Bytes
+			}
+		}
+		if loads != bd.LoadBytes || stores != bd.StoreBytes {
+			t.Errorf("%s: trace loads %d and stores %d, evaluator %d and %d", tc.name, loads, stores, bd.LoadBytes, bd.StoreBytes)
+		}
+		memTime := float64(loads)/float64(tc.p.SlowMemoryBandwidth) + float64(stores)/StoreBandwidth(tc.p)
+		if math.Abs(memTime-bd.MemoryTime) > 1e-6*bd.MemoryTime {
+			t.Errorf("%s: trace memory time %.1f, evaluator %.1f", tc.name, memTime, bd.MemoryTime)
+		}
+
+		lat, err := EvaluateSubgraphDetailed(tc.p, tc.ops, tc.gran, tc.retain, tc.trav, tc.resident, ReuseSnake)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if math.Abs(memTime-lat) > 1e-6*lat {
+			t.Errorf("%s: trace memory time %.1f, latency %.1f", tc.name, memTime, lat)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// maxMergeSpan is the most subgraphs MergeLiveRanges fuses into one
+const maxMergeSpan = 4
+
+// liveRange is the span of subgraphs a tensor lives across: produced in
+// From and last read in To
+type liveRange struct {
+	Tensor   int
+	From, To int
+}
+
+// crossingLiveRanges returns the live ranges of tensors that one subgraph of
+// sol produces and a later one reads, ordered by producer then tensor
+func crossingLiveRanges(p *Problem, sol *Solution) []liveRange {
+	producedIn := make(map[int]int)
+	lastReadIn := make(map[int]int)
+	for i, sg := range sol.Subgraphs {
+		for _, opIdx := range sg.Ops {
+			for _, tIdx := range p.Ops[opIdx].Outputs {
+				producedIn[tIdx] = i
+			}
+		}
+	}
+	for i, sg := range sol.Subgraphs {
+		for _, opIdx := range sg.Ops {
+			for _, tIdx := range p.Ops[opIdx].Inputs {
+				if from, ok := producedIn[tIdx]; ok && i > from {
+					lastReadIn[tIdx] = MaxInt(lastReadIn[tIdx], i)
+				}
+			}
+		}
+	}
+
+	ranges := make([]liveRange, 0, len(lastReadIn))
+	for tIdx, to := range lastReadIn {
+		ranges = append(ranges, liveRange{Tensor: tIdx, From: producedIn[tIdx], To: to})
+	}
+	sort.Slice(ranges, func(a, b int) bool {
+		if ranges[a].From != ranges[b].From {
+			return ranges[a].From < ranges[b].From
+		}
+		return ranges[a].Tensor < ranges[b].Tensor
+	})
+	return ranges
+}
+
+// mergeSubgraphs fuses subgraphs from..to of sol into one subgraph, sized for
+// the residency sol gives it. It keeps the last subgraph's retained tensors
+// the merged one still has and returns false if the result is not a valid
+// subgraph or does not fit in fast memory.
+func mergeSubgraphs(p *Problem, gi *GraphInfo, sol *Solution, from, to int) (Subgraph, bool) {
+	var ops []int
+	for _, sg := range sol.Subgraphs[from : to+1] {
+		ops = append(ops, sg.Ops...)
+	}
+	ops = sortOpsTopologically(gi, ops)
+	if len(ops) > maxFusedOps(p, len(ops)) || !fusible(p, ops) || !gridCompatible(p, ops) {
+		return Subgraph{}, false
+	}
+
+	resident := residentBefore(p, sol.Subgraphs, from)
+	boundary := GetSubgraphBoundary(p, ops)
+	retain := []int{}
+	for _, tIdx := range sol.Subgraphs[to].TensorsToRetain {
+		if boundary.AllProduced[tIdx] || boundary.AllConsumed[tIdx] || resident[tIdx] {
+			retain = append(retain, tIdx)
+		}
+	}
+	var drop []int
+	for _, sg := range sol.Subgraphs[from : to+1] {
+		drop = append(drop, sg.TensorsToDrop...)
+	}
+
+	gran := FindBestGranularityWithRetain(p.atSubgraph(from), ops, resident, retain)
+	if ComputeWorkingSetWithRetained(p, ops, gran, resident, retain) > p.CapacityAt(from) {
+		return Subgraph{}, false
+	}
+	trav := BestTraversalWithResident(p, ops, gran, resident)
+	lat, err := EvaluateSubgraphDataflow(p, ops, gran, retain, trav, resident, OutputStationary)
+	if err != nil {
+		return Subgraph{}, false
+	}
+
+	return Subgraph{
+		Ops:             ops,
+		Granularity:     gran,
+		TensorsToRetain: retain,
+		TraversalOrder:  trav,
+		SubgraphLatency: lat,
+		TensorsToDrop:   drop,
+	}, true
+}
+
+// MergeLiveRanges greedily fuses the subgraphs a tensor's live range spans
+// into one, so the tensor never leaves fast memory and is neither stored by
+// its producer nor reloaded by its consumers. Each round applies the merge
+// that lowers total latency most, over live ranges of at most maxMergeSpan
+// subgraphs, until none helps.
+func MergeLiveRanges(p *Problem, gi *GraphInfo, sol *Solution) *Solution {
+	best, err := EvaluateSolution(p, sol)
+	if err != nil {
+		return sol
+	}
+
+	merges := 0
+	for {
+		var bestSol *Solution
+		tried := make(map[[2]int]bool)
+		for _, lr := range crossingLiveRanges(p, sol) {
+			span := [2]int{lr.From, lr.To}
+			if lr.To-lr.From+1 > maxMergeSpan || tried[span] {
+				continue
+			}
+			tried[span] = true
+
+			merged, ok := mergeSubgraphs(p, gi, sol, lr.From, lr.To)
+			if !ok {
+				continue
+			}
+			subgraphs := append([]Subgraph{}, sol.Subgraphs[:lr.From]...)
+			subgraphs = append(subgraphs, merged)
+			subgraphs = append(subgraphs, sol.Subgraphs[lr.To+1:]...)
+			cand := &Solution{Subgraphs: subgraphs}
+			refreshLatency(p, cand, lr.From+1)
+
+			if lat, err := EvaluateSolution(p, cand); err == nil && latencyLess(lat, best) {
+				best, bestSol = lat, cand
+			}
+		}
+		if bestSol == nil {
+			break
+		}
+		sol = bestSol
+		merges++
+	}
+
+	if merges > 0 {
+		fmt.Fprintf(progress, "  Merged %d live ranges, %d subgraphs, latency %.1f\n", merges, len(sol.Subgraphs), best)
+	}
+	return sol
+}
+
+// MergeAdjacentPointwise fuses consecutive subgraphs of sol that are both
+// free of MatMuls. Such subgraphs share a grid with no k-steps, so fusing
+// them is cheap even when they came from different chains and share no
+// live range. A merge is kept when it does not raise total latency, so
+// equal-latency merges still cut the subgraph count.
+func MergeAdjacentPointwise(p *Problem, gi *GraphInfo, sol *Solution) *Solution {
+	best, err := EvaluateSolution(p, sol)
+	if err != nil {
+		return sol
+	}
+
+	merges := 0
+	for i := 0; i+1 < len(sol.Subgraphs); {
+		if HasMatMul(p, sol.Subgraphs[i].Ops) || HasMatMul(p, sol.Subgraphs[i+1].Ops) {
+			i++
+			continue
+		}
+		merged, ok := mergeSubgraphs(p, gi, sol, i, i+1)
+		if !ok {
+			i++
+			continue
+		}
+		subgraphs := append([]Subgraph{}, sol.Subgraphs[:i]...)
+		subgraphs = append(subgraphs, merged)
+		subgraphs = append(subgraphs, sol.Subgraphs[i+2:]...)
+		cand := &Solution{Subgraphs: subgraphs}
+		refreshLatency(p, cand, i+1)
+
+		// The merged subgraph may fuse with the next one too
+		if lat, err := EvaluateSolution(p, cand); err == nil && !latencyLess(best, lat) {
+			best, sol = lat, cand
+			merges++
+			continue
+		}
+		i++
+	}
+
+	if merges > 0 {
+		fmt.Fprintf(progress, "  Merged %d adjacent pointwise subgraphs, %d subgraphs, latency %.1f\n", merges, len(sol.Subgraphs), best)
+	}
+	return sol
+}
+
+// refreshLatency re-evaluates SubgraphLatency of subgraph i of sol, whose
+// residency a change to subgraph i-1 may have altered
+func refreshLatency(p *Problem, sol *Solution, i int) {
+	if i <= 0 || i >= len(sol.Subgraphs) {
+		return
+	}
+	sg := &sol.Subgraphs[i]
+	resident := residentBefore(p, sol.Subgraphs, i)
+	lat, err := EvaluateSubgraphDataflow(p, sg.Ops, sg.Granularity, sg.TensorsToRetain, sg.TraversalOrder, resident, sg.Dataflow)
+	if err == nil {
+		sg.SubgraphLatency = lat
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ParetoConfig sets the capacity caps SolvePareto solves under
+type ParetoConfig struct {
+	// Caps is the number of capacity caps tried, spaced geometrically from
+	// the problem's capacity down to MinFraction of it
+	Caps        int
+	MinFraction float64
+}
+
+// DefaultParetoConfig returns eight caps from full capacity down to 1/16
+func DefaultParetoConfig() ParetoConfig {
+	return ParetoConfig{Caps: 8, MinFraction: 1.0 / 16}
+}
+
+// ParetoPoint is one solution on the latency / peak memory front
+type ParetoPoint struct {
+	Solution *Solution
+	// Capacity is the fast memory cap the solution was found under
+	Capacity int64
+	Latency  float64
+	// PeakWorkingSet is the most fast memory any subgraph of Solution uses
+	PeakWorkingSet int64
+}
+
+// PeakWorkingSet returns the largest working set, retained tensors
+// included, of any subgraph of sol under the residency it runs with
+func PeakWorkingSet(p *Problem, sol *Solution) int64 {
+	var peak int64
+	resident := make(map[int]bool)
+	for i, sg := range sol.Subgraphs {
+		if len(sg.Ops) > 0 && !isZeroSized(GetOutputShape(p, sg.Ops)) {
+			peak = MaxInt64(peak, ComputeWorkingSetWithRetained(p, sg.Ops, sg.Granularity, resident, sg.TensorsToRetain))
+		}
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+	}
+	return peak
+}
+
+// SolvePareto trades latency against fast memory use. It solves p again
+// under each capacity cap of cfg, skipping caps some op cannot fit in, and
+// returns the solutions no other one beats on both latency and peak working
+// set, by increasing latency and so decreasing peak. Every returned
+// solution is valid for p itself.
+func SolvePareto(p *Problem, gi *GraphInfo, cfg ParetoConfig) []ParetoPoint {
+	var points []ParetoPoint
+	for _, capacity := range paretoCaps(p.FastMemoryCapacity, cfg) {
+		capped := *p
+		capped.FastMemoryCapacity = capacity
+		capped.CapacitySchedule = clampCapacities(p.CapacitySchedule, capacity)
+		if err := CheckMinimumFootprint(&capped); err != nil {
+			fmt.Fprintf(progress, "  Capacity %d: skipped, %v\n", capacity, err)
+			continue
+		}
+
+		sol, err := solveAnalyzed(&capped, gi)
+		if err != nil {
+			fmt.Fprintf(progress, "  Capacity %d: skipped, %v\n", capacity, err)
+			continue
+		}
+		lat, err := EvaluateSolution(p, sol)
+		if err != nil {
+			fmt.Fprintf(progress, "  WARNING: capacity %d: %v\n", capacity, err)
+			continue
+		}
+		points = append(points, ParetoPoint{
+			Solution:       sol,
+			Capacity:       capacity,
+			Latency:        lat,
+			PeakWorkingSet: PeakWorkingSet(p, sol),
+		})
+	}
+	return paretoFront(points)
+}
+
+// clampCapacities returns schedule with each capacity lowered to at most
+// capacity. Zero entries already fall back to the capped FastMemoryCapacity.
+func clampCapacities(schedule []int64, capacity int64) []int64 {
+	if len(schedule) == 0 {
+		return nil
+	}
+	clamped := make([]int64, len(schedule))
+	for i, c := range schedule {
+		clamped[i] = MinInt64(c, capacity)
+	}
+	return clamped
+}
+
+// paretoCaps returns cfg.Caps distinct capacities, largest first, spaced
+// geometrically from capacity down to cfg.MinFraction of it
+func paretoCaps(capacity int64, cfg ParetoConfig) []int64 {
+	n := MaxInt(cfg.Caps, 1)
+	minCap := MaxFloat(1, float64(capacity)*cfg.MinFraction)
+	var caps []int64
+	for i := 0; i < n; i++ {
+		c := float64(capacity)
+		if n > 1 {
+			c *= math.Pow(minCap/float64(capacity), float64(i)/float64(n-1))
+		}
+		capped := MinInt64(capacity, int64(math.Round(c)))
+		if len(caps) == 0 || capped < caps[len(caps)-1] {
+			caps = append(caps, capped)
+		}
+	}
+	return caps
+}
+
+// paretoFront keeps the points no other point matches or beats on both axes,
+// sorted by latency and then peak working set
+func paretoFront(points []ParetoPoint) []ParetoPoint {
+	sort.SliceStable(points, func(a, b int) bool {
+		if points[a].Latency != points[b].Latency {
+			return points[a].Latency < points[b].Latency
+		}
+		return points[a].PeakWorkingSet < points[b].PeakWorkingSet
+	})
+
+	var front []ParetoPoint
+	for _, pt := range points {
+		if len(front) == 0 || pt.PeakWorkingSet < front[len(front)-1].PeakWorkingSet {
+			front = append(front, pt)
+		}
+	}
+	return front
+}
@@ -0,0 +1,196 @@
+package main
+
+import "fmt"
+
+const (
+	// partitionThresholdOps is the graph size above which the solver
+	// partitions the DAG instead of running the whole-graph fusion passes
+	partitionThresholdOps = 5000
+	// defaultPartitionOps is the target region size for partitioned solves
+	defaultPartitionOps = 1000
+)
+
+// PartitionGraph cuts the topological order into contiguous regions of at
+// most maxPartitionOps ops. Each cut is placed in the back half of the
+// window where the fewest tensors cross from earlier ops to later ones, so
+// regions meet at narrow points of the DAG.
+func PartitionGraph(gi *GraphInfo, maxPartitionOps int) [][]int {
+	order := gi.TopoOrder
+	n := len(order)
+	if maxPartitionOps <= 0 || n <= maxPartitionOps {
+		return [][]int{append([]int{}, order...)}
+	}
+
+	pos := make(map[int]int, n)
+	for i, opIdx := range order {
+		pos[opIdx] = i
+	}
+
+	// crossing[i] counts tensors live across the cut after order[i]: a tensor
+	// produced at position a whose last consumer is at b crosses cuts a..b-1
+	diff := make([]int, n+1)
+	for tIdx, producer := range gi.ProducerOf {
+		a := pos[producer]
+		b := a
+		for _, consumer := range gi.ConsumersOf[tIdx] {
+			b = MaxInt(b, pos[consumer])
+		}
+		if b > a {
+			diff[a]++
+			diff[b]--
+		}
+	}
+	crossing := make([]int, n)
+	running := 0
+	for i := 0; i < n; i++ {
+		running += diff[i]
+		crossing[i] = running
+	}
+
+	var regions [][]int
+	start := 0
+	for start < n {
+		end := start + maxPartitionOps
+		if end >= n {
+			regions = append(regions, append([]int{}, order[start:]...))
+			break
+		}
+
+		cut := end - 1
+		for i := end - 1; i >= start+maxPartitionOps/2; i-- {
+			if crossing[i] < crossing[cut] {
+				cut = i
+			}
+		}
+
+		regions = append(regions, append([]int{}, order[start:cut+1]...))
+		start = cut + 1
+	}
+
+	return regions
+}
+
+// regionGraphInfo restricts gi's op-level dependencies to one region. Since
+// regions are contiguous in topological order, any dependency path between
+// two ops of a region stays inside it, so the restricted graph gives the same
+// fusion validity answers at a fraction of the traversal cost.
+func regionGraphInfo(gi *GraphInfo, region []int) *GraphInfo {
+	inRegion := make(map[int]bool, len(region))
+	for _, opIdx := range region {
+		inRegion[opIdx] = true
+	}
+
+	rgi := &GraphInfo{
+		ProducerOf:   gi.ProducerOf,
+		ConsumersOf:  gi.ConsumersOf,
+		GraphInputs:  gi.GraphInputs,
+		GraphOutputs: gi.GraphOutputs,
+		TopoOrder:    region,
+		Dependencies: make(map[int][]int),
+		Dependents:   make(map[int][]int),
+	}
+	for _, opIdx := range region {
+		for _, dep := range gi.Dependencies[opIdx] {
+			if inRegion[dep] {
+				rgi.Dependencies[opIdx] = append(rgi.Dependencies[opIdx], dep)
+				rgi.Dependents[dep] = append(rgi.Dependents[dep], opIdx)
+			}
+		}
+	}
+	return rgi
+}
+
+// solvePartitioned forms and orders groups region by region, then stitches
+// the region schedules in order and optimizes granularity and retention over
+// the whole schedule. Tensors flowing between regions are ordinary boundary
+// inputs and outputs of the subgraphs that touch them.
+func solvePartitioned(p *Problem, gi *GraphInfo, fc *FusionConstraints, maxPartitionOps int) *Solution {
+	regions := mergeRegionsAtPins(PartitionGraph(gi, maxPartitionOps), fc)
+	fmt.Fprintf(progress, "  Partitioned %d ops into %d regions\n", len(p.Ops), len(regions))
+
+	regionOf := make(map[int]int, len(p.Ops))
+	for rIdx, region := range regions {
+		for _, opIdx := range region {
+			regionOf[opIdx] = rIdx
+		}
+	}
+
+	// Chains follow single-consumer edges, which only move forward in the
+	// topological order, so cutting a chain at region changes keeps each
+	// piece contiguous.
+	regionRuns := make([][][]int, len(regions))
+	for _, chain := range FindLinearChains(p, gi) {
+		for _, run := range fc.splitChainAtPins(chain) {
+			begin := 0
+			for i := 1; i <= len(run); i++ {
+				if i == len(run) || regionOf[run[i]] != regionOf[run[begin]] {
+					rIdx := regionOf[run[begin]]
+					regionRuns[rIdx] = append(regionRuns[rIdx], run[begin:i])
+					begin = i
+				}
+			}
+		}
+	}
+
+	// Pinned groups never straddle regions after mergeRegionsAtPins
+	regionPins := make([][][]int, len(regions))
+	for _, group := range fc.pinnedGroupsCopy() {
+		rIdx := regionOf[group[0]]
+		regionPins[rIdx] = append(regionPins[rIdx], group)
+	}
+
+	var schedule []ScheduleEntry
+	for rIdx, region := range regions {
+		rgi := regionGraphInfo(gi, region)
+
+		groups := regionPins[rIdx]
+		for _, run := range regionRuns[rIdx] {
+			groups = append(groups, FuseChainDP(p, rgi, run, make(map[int]bool), fc)...)
+		}
+		groups = tryCrossChainFusion(p, rgi, groups, fc)
+
+		schedule = append(schedule, BuildSchedule(p, rgi, groups)...)
+	}
+	fmt.Fprintf(progress, "  Stitched %d schedule entries\n", len(schedule))
+	fc.fixGranularities(schedule)
+
+	return optimizeEntries(p, schedule)
+}
+
+// mergeRegionsAtPins joins consecutive regions that a pinned group spans, so
+// each pinned group lies within a single region
+func mergeRegionsAtPins(regions [][]int, fc *FusionConstraints) [][]int {
+	if fc == nil || len(fc.PinnedGroups) == 0 {
+		return regions
+	}
+
+	regionOf := make(map[int]int)
+	for rIdx, region := range regions {
+		for _, opIdx := range region {
+			regionOf[opIdx] = rIdx
+		}
+	}
+
+	joinNext := make([]bool, len(regions))
+	for _, group := range fc.PinnedGroups {
+		lo, hi := regionOf[group[0]], regionOf[group[0]]
+		for _, opIdx := range group {
+			lo = MinInt(lo, regionOf[opIdx])
+			hi = MaxInt(hi, regionOf[opIdx])
+		}
+		for rIdx := lo; rIdx < hi; rIdx++ {
+			joinNext[rIdx] = true
+		}
+	}
+
+	var merged [][]int
+	var current []int
+	for rIdx, region := range regions {
+		current = append(current, region...)
+		if !joinNext[rIdx] {
+			merged = append(merged, current)
+			current = nil
+		}
+	}
+	return merged
+}
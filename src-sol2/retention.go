@@ -34,13 +34,25 @@ func PlanRetentionGlobal(
 	for tIdx := range currentResident {
 		retainableTensors[tIdx] = true
 	}
+	// An input the next subgraph also reads, such as a weight shared by
+	// independent ops, can stay instead of being loaded twice
+	nextInputs := GetSubgraphBoundary(p, schedule[currentIdx+1].Ops).BoundaryInputs
+	for tIdx := range currentBoundary.BoundaryInputs {
+		if nextInputs[tIdx] {
+			retainableTensors[tIdx] = true
+		}
+	}
 
 	// For each retainable tensor, compute the savings from retaining it
 	bw := float64(p.SlowMemoryBandwidth)
 	var candidates []RetentionCandidate
 
-	for tIdx := range retainableTensors {
+	reserved := current.Reserved
+	for _, tIdx := range sortedKeys(retainableTensors) {
 		size := FullTensorSize(p, tIdx)
+		if size == 0 || IsPinnedTensor(p, tIdx) || isGraphOutput(p, tIdx) || containsInt(reserved, tIdx) {
+			continue
+		}
 
 		savings := 0.0
 
@@ -50,7 +62,7 @@ func PlanRetentionGlobal(
 			nextBoundary := GetSubgraphBoundary(p, schedule[nextIdx].Ops)
 			if nextBoundary.BoundaryInputs[tIdx] {
 				nextGran := schedule[nextIdx].Granularity
-				nextOutT := p.Tensors[GetOutputTensor(p, schedule[nextIdx].Ops)]
+				nextOutT := GetOutputShape(p, schedule[nextIdx].Ops)
 
 				nCols := CeilDiv(nextOutT.Width, nextGran[0])
 				nRows := CeilDiv(nextOutT.Height, nextGran[1])
@@ -59,8 +71,7 @@ func PlanRetentionGlobal(
 				role := InputTileRole(p, schedule[nextIdx].Ops, tIdx)
 				tileSize := InputTileSize(p, schedule[nextIdx].Ops, tIdx, nextGran[0], nextGran[1], nextGran[2])
 
-				maxK := GetMaxK(p, schedule[nextIdx].Ops)
-				nK := CeilDiv(maxK, nextGran[2])
+				nK := InputKSteps(p, schedule[nextIdx].Ops, tIdx, nextGran[2])
 
 				var loads int
 				switch role {
@@ -70,13 +81,16 @@ func PlanRetentionGlobal(
 					loads = nCols * nK
 				case "PW":
 					loads = nSpatial
+				case "BROADCAST":
+					loads = 1
 				}
 
-				savings = float64(tileSize) * float64(loads) / bw
+				// A compressed tensor is decompressed wherever it was loaded
+				savings = float64(tileSize)*float64(loads)/bw - decompressTime(p, tIdx, tileSize)*float64(loads)
 
 				// Also save on eviction from current subgraph
 				if currentBoundary.BoundaryOutputs[tIdx] {
-					savings += float64(size) / bw
+					savings += float64(size) / StoreBandwidth(p)
 				}
 			}
 		}
@@ -93,14 +107,14 @@ func PlanRetentionGlobal(
 		if savings > 0 {
 			candidates = append(candidates, RetentionCandidate{
 				TensorIdx: tIdx,
-				Size:      size,
+				Size:      ResidentSize(p, tIdx),
 				Savings:   savings,
 			})
 		}
 	}
 
 	// Sort by savings/size ratio (bang per buck)
-	sort.Slice(candidates, func(i, j int) bool {
+	sort.SliceStable(candidates, func(i, j int) bool {
 		ri := candidates[i].Savings / float64(candidates[i].Size)
 		rj := candidates[j].Savings / float64(candidates[j].Size)
 		return ri > rj
@@ -112,43 +126,34 @@ func PlanRetentionGlobal(
 
 	// Compute base working set of next subgraph with no retained tensors
 	baseWS := ComputeWorkingSet(p, nextOps, nextGran, make(map[int]bool))
-	availableCapacity := p.FastMemoryCapacity - baseWS
+	availableCapacity := p.CapacityAt(currentIdx+1) - baseWS
 
 	// But we also need to account for resident tensors that won't be consumed by the next subgraph
 	// If we retain tensor T and next subgraph doesn't use it, it still sits in fast memory
 	nextBoundary := GetSubgraphBoundary(p, nextOps)
 
-	var retained []int
-	usedCapacity := int64(0)
-
-	for _, cand := range candidates {
-		tIdx := cand.TensorIdx
-
-		// Compute the additional capacity cost of retaining this tensor
-		additionalCost := cand.Size
-
-		// If the next subgraph uses this tensor as a boundary input, then
-		// ComputeWorkingSet already counted its tile size. Retaining it means
-		// we replace the tile-sized entry with full-tensor-sized entry.
-		if nextBoundary.BoundaryInputs[tIdx] {
-			tileSize := InputTileSize(p, nextOps, tIdx, nextGran[0], nextGran[1], nextGran[2])
-			additionalCost = cand.Size - tileSize
-			// If full tensor is smaller than or equal to tile (small tensors), cost might be 0 or negative
-			if additionalCost < 0 {
-				additionalCost = 0
-			}
-		}
+	// Reserved tensors are kept first, whatever they save
+	for _, tIdx := range reserved {
+		availableCapacity -= retentionCost(p, nextOps, nextGran, nextBoundary, tIdx)
+	}
 
-		if usedCapacity+additionalCost <= availableCapacity {
-			retained = append(retained, tIdx)
-			usedCapacity += additionalCost
-		}
+	costs := make([]int64, len(candidates))
+	savings := make([]float64, len(candidates))
+	for i, cand := range candidates {
+		costs[i] = retentionCost(p, nextOps, nextGran, nextBoundary, cand.TensorIdx)
+		savings[i] = cand.Savings
 	}
 
+	retained := append([]int{}, reserved...)
+	for _, i := range packRetention(costs, savings, availableCapacity) {
+		retained = append(retained, candidates[i].TensorIdx)
+	}
 	return retained
 }
 
-// PlanRetentionSimple is a simpler retention planner for when we don't have full schedule
+// PlanRetentionSimple is a simpler retention planner for when we don't have
+// full schedule. nextIdx is the next subgraph's position, whose capacity the
+// retained tensors must fit in.
 func PlanRetentionSimple(
 	p *Problem,
 	currentOps []int,
@@ -156,6 +161,7 @@ func PlanRetentionSimple(
 	currentGran [3]int,
 	nextGran [3]int,
 	currentResident map[int]bool,
+	nextIdx int,
 ) []int {
 
 	if nextOps == nil {
@@ -176,11 +182,14 @@ func PlanRetentionSimple(
 	var candidates []candidate
 
 	// Check outputs of current subgraph
-	for tIdx := range currentBoundary.BoundaryOutputs {
+	for _, tIdx := range sortedKeys(currentBoundary.BoundaryOutputs) {
 		if nextBoundary.BoundaryInputs[tIdx] {
 			size := FullTensorSize(p, tIdx)
+			if size == 0 || IsPinnedTensor(p, tIdx) || isGraphOutput(p, tIdx) {
+				continue
+			}
 
-			nextOutT := p.Tensors[GetOutputTensor(p, nextOps)]
+			nextOutT := GetOutputShape(p, nextOps)
 			nCols := CeilDiv(nextOutT.Width, nextGran[0])
 			nRows := CeilDiv(nextOutT.Height, nextGran[1])
 			nSpatial := nCols * nRows
@@ -188,8 +197,7 @@ func PlanRetentionSimple(
 			role := InputTileRole(p, nextOps, tIdx)
 			tileSize := InputTileSize(p, nextOps, tIdx, nextGran[0], nextGran[1], nextGran[2])
 
-			maxK := GetMaxK(p, nextOps)
-			nK := CeilDiv(maxK, nextGran[2])
+			nK := InputKSteps(p, nextOps, tIdx, nextGran[2])
 
 			var loads int
 			switch role {
@@ -199,19 +207,25 @@ func PlanRetentionSimple(
 				loads = nCols * nK
 			case "PW":
 				loads = nSpatial
+			case "BROADCAST":
+				loads = 1
 			}
 
-			savings := float64(tileSize)*float64(loads)/bw + float64(size)/bw
-			candidates = append(candidates, candidate{tIdx, size, savings})
+			savings := float64(tileSize)*float64(loads)/bw + float64(size)/StoreBandwidth(p)
+			savings -= decompressTime(p, tIdx, tileSize) * float64(loads)
+			candidates = append(candidates, candidate{tIdx, ResidentSize(p, tIdx), savings})
 		}
 	}
 
 	// Check currently resident tensors
-	for tIdx := range currentResident {
+	for _, tIdx := range sortedKeys(currentResident) {
 		if nextBoundary.BoundaryInputs[tIdx] {
 			size := FullTensorSize(p, tIdx)
+			if size == 0 || IsPinnedTensor(p, tIdx) || isGraphOutput(p, tIdx) {
+				continue
+			}
 
-			nextOutT := p.Tensors[GetOutputTensor(p, nextOps)]
+			nextOutT := GetOutputShape(p, nextOps)
 			nCols := CeilDiv(nextOutT.Width, nextGran[0])
 			nRows := CeilDiv(nextOutT.Height, nextGran[1])
 			nSpatial := nCols * nRows
@@ -219,8 +233,7 @@ func PlanRetentionSimple(
 			role := InputTileRole(p, nextOps, tIdx)
 			tileSize := InputTileSize(p, nextOps, tIdx, nextGran[0], nextGran[1], nextGran[2])
 
-			maxK := GetMaxK(p, nextOps)
-			nK := CeilDiv(maxK, nextGran[2])
+			nK := InputKSteps(p, nextOps, tIdx, nextGran[2])
 
 			var loads int
 			switch role {
@@ -230,40 +243,479 @@ func PlanRetentionSimple(
 				loads = nCols * nK
 			case "PW":
 				loads = nSpatial
+			case "BROADCAST":
+				loads = 1
 			}
 
-			savings := float64(tileSize) * float64(loads) / bw
-			candidates = append(candidates, candidate{tIdx, size, savings})
+			savings := float64(tileSize)*float64(loads)/bw - decompressTime(p, tIdx, tileSize)*float64(loads)
+			candidates = append(candidates, candidate{tIdx, ResidentSize(p, tIdx), savings})
 		}
 	}
 
-	sort.Slice(candidates, func(i, j int) bool {
+	sort.SliceStable(candidates, func(i, j int) bool {
 		ri := candidates[i].savings / float64(candidates[i].size)
 		rj := candidates[j].savings / float64(candidates[j].size)
 		return ri > rj
 	})
 
 	baseWS := ComputeWorkingSet(p, nextOps, nextGran, make(map[int]bool))
-	availableCapacity := p.FastMemoryCapacity - baseWS
+	availableCapacity := p.CapacityAt(nextIdx) - baseWS
+
+	costs := make([]int64, len(candidates))
+	savings := make([]float64, len(candidates))
+	for i, cand := range candidates {
+		costs[i] = retentionCost(p, nextOps, nextGran, nextBoundary, cand.tIdx)
+		savings[i] = cand.savings
+	}
 
 	var retained []int
-	usedCapacity := int64(0)
-
-	for _, cand := range candidates {
-		additionalCost := cand.size
-		if nextBoundary.BoundaryInputs[cand.tIdx] {
-			tileSize := InputTileSize(p, nextOps, cand.tIdx, nextGran[0], nextGran[1], nextGran[2])
-			additionalCost = cand.size - tileSize
-			if additionalCost < 0 {
-				additionalCost = 0
+	for _, i := range packRetention(costs, savings, availableCapacity) {
+		retained = append(retained, candidates[i].tIdx)
+	}
+	return retained
+}
+
+// retentionCost is the fast memory retaining tIdx adds to the working set of
+// the next subgraph. If that subgraph reads tIdx, ComputeWorkingSet already
+// counted its tile, which the whole tensor replaces; a tensor retained
+// compressed still needs the tile to decompress into.
+func retentionCost(p *Problem, nextOps []int, nextGran [3]int, nextBoundary *SubgraphBoundary, tIdx int) int64 {
+	cost := AlignedSize(p, ResidentSize(p, tIdx))
+	if nextBoundary.BoundaryInputs[tIdx] && !retainedCompressed(p, tIdx) {
+		tileSize := AlignedSize(p, InputTileSize(p, nextOps, tIdx, nextGran[0], nextGran[1], nextGran[2]))
+		// A tensor no bigger than its tile costs nothing extra
+		cost = MaxInt64(cost-tileSize, 0)
+	}
+	return cost
+}
+
+// knapsackBuckets bounds the capacity axis of packRetention's table
+const knapsackBuckets = 1 << 14
+
+// packRetention picks the candidates with the largest total savings whose
+// costs fit in capacity (0/1 knapsack), returning their indices in input
+// order. Costs are measured in units of their common divisor; if capacity
+// still spans more than knapsackBuckets units, the unit is coarsened and
+// costs rounded up, so the chosen set always fits but may miss a tight
+// exact optimum.
+func packRetention(costs []int64, savings []float64, capacity int64) []int {
+	if capacity < 0 || len(costs) == 0 {
+		return nil
+	}
+
+	unit := int64(0)
+	for _, cost := range costs {
+		unit = gcd64(unit, cost)
+	}
+	if unit == 0 {
+		unit = 1
+	}
+	if capacity/unit > knapsackBuckets {
+		unit = (capacity + knapsackBuckets - 1) / knapsackBuckets
+	}
+	width := int(capacity/unit) + 1
+
+	// best[c] is the largest savings using at most c units; take[i][c]
+	// records whether candidate i is in that set after considering it
+	best := make([]float64, width)
+	take := make([][]bool, len(costs))
+	for i, cost := range costs {
+		take[i] = make([]bool, width)
+		w := int((cost + unit - 1) / unit)
+		if cost > capacity || savings[i] <= 0 {
+			continue
+		}
+		for c := width - 1; c >= w; c-- {
+			if v := best[c-w] + savings[i]; v > best[c] {
+				best[c] = v
+				take[i][c] = true
 			}
 		}
+	}
 
-		if usedCapacity+additionalCost <= availableCapacity {
-			retained = append(retained, cand.tIdx)
-			usedCapacity += additionalCost
+	var chosen []int
+	c := width - 1
+	for i := len(costs) - 1; i >= 0; i-- {
+		if take[i][c] {
+			chosen = append(chosen, i)
+			c -= int((costs[i] + unit - 1) / unit)
 		}
 	}
+	sort.Ints(chosen)
+	return chosen
+}
 
-	return retained
+// residentFrom builds the residency map a retention list produces
+func residentFrom(retain []int) map[int]bool {
+	resident := make(map[int]bool)
+	for _, tIdx := range retain {
+		resident[tIdx] = true
+	}
+	return resident
+}
+
+// nextResident is the residency model. After a subgraph of ops, fast memory
+// holds the tensors it retains plus each tensor resident before it that it
+// neither reads nor drops and that a later subgraph still reads
+// (readLater). A retained tensor so stays resident until its next reader,
+// which must retain it again to keep it longer, or until a subgraph drops
+// it: retention ends at last use unless something ends it sooner.
+func nextResident(p *Problem, ops, retain, drop []int, resident map[int]bool, readLater func(tIdx int) bool) map[int]bool {
+	next := residentFrom(retain)
+	var read map[int]bool
+	for tIdx := range resident {
+		if next[tIdx] || containsInt(drop, tIdx) {
+			continue
+		}
+		if read == nil {
+			read = GetSubgraphBoundary(p, ops).AllConsumed
+		}
+		if !read[tIdx] && readLater(tIdx) {
+			next[tIdx] = true
+		}
+	}
+	return next
+}
+
+// readsTensor reports whether any of ops reads tIdx
+func readsTensor(p *Problem, ops []int, tIdx int) bool {
+	for _, opIdx := range ops {
+		if containsInt(p.Ops[opIdx].Inputs, tIdx) {
+			return true
+		}
+	}
+	return false
+}
+
+// residentAfter returns what is resident after subgraph i of subgraphs,
+// given what was resident before it
+func residentAfter(p *Problem, subgraphs []Subgraph, i int, resident map[int]bool) map[int]bool {
+	sg := subgraphs[i]
+	return nextResident(p, sg.Ops, sg.TensorsToRetain, sg.TensorsToDrop, resident, func(tIdx int) bool {
+		for _, later := range subgraphs[i+1:] {
+			if readsTensor(p, later.Ops, tIdx) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// residentBefore replays subgraphs up to subgraph i and returns what is
+// resident when it starts
+func residentBefore(p *Problem, subgraphs []Subgraph, i int) map[int]bool {
+	resident := make(map[int]bool)
+	for k := 0; k < i; k++ {
+		resident = residentAfter(p, subgraphs, k, resident)
+	}
+	return resident
+}
+
+// readAfter returns the readLater function of nextResident for entry i of
+// schedule
+func readAfter(p *Problem, schedule []ScheduleEntry, i int) func(tIdx int) bool {
+	return func(tIdx int) bool {
+		for _, later := range schedule[i+1:] {
+			if readsTensor(p, later.Ops, tIdx) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// entryResidentAfter is residentAfter for entry i of a schedule
+func entryResidentAfter(p *Problem, schedule []ScheduleEntry, i int, resident map[int]bool) map[int]bool {
+	entry := schedule[i]
+	return nextResident(p, entry.Ops, entry.Retain, entry.Drop, resident, readAfter(p, schedule, i))
+}
+
+// entryResidentBefore is residentBefore for entry i of a schedule
+func entryResidentBefore(p *Problem, schedule []ScheduleEntry, i int) map[int]bool {
+	resident := make(map[int]bool)
+	for k := 0; k < i; k++ {
+		resident = entryResidentAfter(p, schedule, k, resident)
+	}
+	return resident
+}
+
+// reserveReusedInputs finds the graph inputs that at least minUses entries
+// of schedule read and reserves each in the Reserved and Retain lists of
+// the entries from its first read up to its last, so it is loaded once.
+// Inputs read most often go first; one is skipped if some entry of its span
+// could not fit it resident even with its smallest tile.
+func reserveReusedInputs(p *Problem, schedule []ScheduleEntry, minUses int) []ScheduleEntry {
+	produced := make(map[int]bool)
+	for _, op := range p.Ops {
+		for _, tIdx := range op.Outputs {
+			produced[tIdx] = true
+		}
+	}
+	readBy := make(map[int][]int)
+	for i, entry := range schedule {
+		for tIdx := range GetSubgraphBoundary(p, entry.Ops).BoundaryInputs {
+			if !produced[tIdx] && !IsPinnedTensor(p, tIdx) && FullTensorSize(p, tIdx) > 0 {
+				readBy[tIdx] = append(readBy[tIdx], i)
+			}
+		}
+	}
+
+	var reused []int
+	for tIdx, uses := range readBy {
+		if len(uses) >= minUses {
+			reused = append(reused, tIdx)
+		}
+	}
+	sort.Slice(reused, func(a, b int) bool {
+		if na, nb := len(readBy[reused[a]]), len(readBy[reused[b]]); na != nb {
+			return na > nb
+		}
+		return reused[a] < reused[b]
+	})
+
+	for _, tIdx := range reused {
+		uses := readBy[tIdx]
+		first, last := uses[0], uses[len(uses)-1]
+
+		fits := true
+		for k := first; k <= last && fits; k++ {
+			resident := make(map[int]bool)
+			if k > first {
+				resident[tIdx] = true
+			}
+			if k > 0 {
+				for _, r := range schedule[k-1].Reserved {
+					resident[r] = true
+				}
+			}
+			retain := schedule[k].Reserved
+			if k < last {
+				retain = append(append([]int{}, retain...), tIdx)
+			}
+			gran, err := findSmallestFeasible(p.atSubgraph(k), schedule[k].Ops, resident)
+			fits = err == nil && ComputeWorkingSetWithRetained(p, schedule[k].Ops, gran, resident, retain) <= p.CapacityAt(k)
+		}
+		if !fits {
+			continue
+		}
+		for k := first; k < last; k++ {
+			schedule[k].Reserved = append(schedule[k].Reserved, tIdx)
+			schedule[k].Retain = append([]int{}, schedule[k].Reserved...)
+		}
+	}
+	return schedule
+}
+
+// maxCarrySpan is the most subgraphs carryRetentions keeps a tensor
+// resident through without using it
+const maxCarrySpan = 4
+
+// isCarried reports whether entry keeps tIdx without producing or reading
+// it, holding it only for a later subgraph
+func isCarried(p *Problem, entry ScheduleEntry, tIdx int) bool {
+	if !containsInt(entry.Retain, tIdx) {
+		return false
+	}
+	boundary := GetSubgraphBoundary(p, entry.Ops)
+	return !boundary.AllProduced[tIdx] && !boundary.AllConsumed[tIdx]
+}
+
+// carryRetentions hands tensors across more than one subgraph boundary. A
+// tensor subgraph i retains stays resident through the subgraphs that do
+// not read it, so one that i has in fast memory and subgraph j > i+1 reads
+// next need only be retained by i. For each such tensor it tries exactly
+// that, and keeps it when the entries i..j fit and get faster overall. The
+// tensor is dropped after j unless j's own plan keeps it: retention ends at
+// last use.
+func carryRetentions(p *Problem, schedule []ScheduleEntry) []ScheduleEntry {
+	resident := make(map[int]bool)
+	for i := 0; i+2 < len(schedule); i++ {
+		if i > 0 {
+			resident = entryResidentAfter(p, schedule, i-1, resident)
+		}
+		boundary := GetSubgraphBoundary(p, schedule[i].Ops)
+		after := entryResidentAfter(p, schedule, i, resident)
+
+		// Tensors i holds whole: its outputs and what it had resident
+		held := make(map[int]bool)
+		for tIdx := range boundary.BoundaryOutputs {
+			held[tIdx] = true
+		}
+		for tIdx := range resident {
+			held[tIdx] = true
+		}
+
+		for _, tIdx := range sortedKeys(held) {
+			if after[tIdx] || FullTensorSize(p, tIdx) == 0 || IsPinnedTensor(p, tIdx) || isGraphOutput(p, tIdx) {
+				continue
+			}
+			j := nextUse(p, schedule, i+1, tIdx)
+			if j <= i+1 || j-i > maxCarrySpan {
+				continue
+			}
+			if trial, ok := tryCarry(p, schedule, i, j, tIdx, resident); ok {
+				copy(schedule[i:j+1], trial)
+				after = entryResidentAfter(p, schedule, i, resident)
+			}
+		}
+	}
+	return schedule
+}
+
+// nextUse returns the first entry at or after from that reads tIdx or
+// produces it anew, or -1
+func nextUse(p *Problem, schedule []ScheduleEntry, from, tIdx int) int {
+	for k := from; k < len(schedule); k++ {
+		boundary := GetSubgraphBoundary(p, schedule[k].Ops)
+		if boundary.AllConsumed[tIdx] || boundary.AllProduced[tIdx] {
+			return k
+		}
+	}
+	return -1
+}
+
+// tryCarry adds tIdx to the retain list of entry i, which starts with
+// resident, and re-evaluates entries i..j, through which tIdx now stays
+// resident. It returns the changed entries if all of them fit and their
+// total latency drops.
+func tryCarry(p *Problem, schedule []ScheduleEntry, i, j, tIdx int, resident map[int]bool) ([]ScheduleEntry, bool) {
+	if !GetSubgraphBoundary(p, schedule[j].Ops).AllConsumed[tIdx] {
+		return nil, false
+	}
+
+	trial := append([]ScheduleEntry{}, schedule...)
+	trial[i].Retain = append(append([]int{}, trial[i].Retain...), tIdx)
+
+	before, after := 0.0, 0.0
+	for k := i; k <= j; k++ {
+		entry := &trial[k]
+		before += entry.Latency
+
+		if ComputeWorkingSetWithRetained(p, entry.Ops, entry.Granularity, resident, entry.Retain) > p.CapacityAt(k) {
+			return nil, false
+		}
+		lat, err := EvaluateSubgraphDataflow(p, entry.Ops, entry.Granularity, entry.Retain, entry.Traversal, resident, entry.Dataflow)
+		if err != nil {
+			return nil, false
+		}
+		entry.Latency = lat
+		after += lat
+		resident = entryResidentAfter(p, trial, k, resident)
+	}
+
+	return trial[i : j+1], latencyLess(after, before)
+}
+
+// RefineRetentionGranularity searches retention and granularity jointly.
+// Retention is planned after granularity, so a retained tensor can hold the
+// next subgraph to a smaller tile than it could otherwise use. For each
+// boundary it tries the current retain set, the set minus each tensor, and
+// nothing, re-optimizing both subgraphs' granularity for each, and keeps the
+// combination with the lowest two-subgraph latency. A boundary that retains
+// nothing tries each output the next subgraph reads instead, which may only
+// fit once both tiles shrink. Options that would change what stays resident
+// past the next subgraph are skipped, as later entries are not re-evaluated.
+func RefineRetentionGranularity(p *Problem, schedule []ScheduleEntry) []ScheduleEntry {
+	residentI := make(map[int]bool)
+	for i := 0; i+1 < len(schedule); i++ {
+		if i > 0 {
+			residentI = entryResidentAfter(p, schedule, i-1, residentI)
+		}
+		afterNext := entryResidentAfter(p, schedule, i+1, entryResidentAfter(p, schedule, i, residentI))
+
+		options := [][]int{schedule[i].Retain}
+		if len(schedule[i].Retain) == 0 {
+			produced := GetSubgraphBoundary(p, schedule[i].Ops).BoundaryOutputs
+			read := GetSubgraphBoundary(p, schedule[i+1].Ops).BoundaryInputs
+			for _, tIdx := range sortedKeys(produced) {
+				if read[tIdx] && !IsPinnedTensor(p, tIdx) && !isGraphOutput(p, tIdx) {
+					options = append(options, []int{tIdx})
+				}
+			}
+		} else {
+			options = append(options, []int{})
+		}
+		for rIdx := range schedule[i].Retain {
+			without := make([]int, 0, len(schedule[i].Retain)-1)
+			without = append(without, schedule[i].Retain[:rIdx]...)
+			without = append(without, schedule[i].Retain[rIdx+1:]...)
+			if len(without) > 0 {
+				options = append(options, without)
+			}
+		}
+
+		bestTotal := schedule[i].Latency + schedule[i+1].Latency
+		var best *[2]ScheduleEntry
+
+		for _, retain := range options {
+			if len(setDifference(schedule[i].Reserved, retain)) > 0 {
+				continue
+			}
+			cur := schedule[i]
+			cur.Retain = retain
+			cur.Granularity = granularityFor(p.atSubgraph(i), cur, residentI, retain)
+			if ComputeWorkingSetWithRetained(p, cur.Ops, cur.Granularity, residentI, retain) > p.CapacityAt(i) {
+				continue
+			}
+			cur.Traversal = BestTraversalWithResident(p, cur.Ops, cur.Granularity, residentI)
+			latI, err := EvaluateSubgraphDetailed(p, cur.Ops, cur.Granularity, retain, cur.Traversal, residentI, ReuseSnake)
+			if err != nil {
+				continue
+			}
+			cur.Latency = latI
+
+			// The next entry may carry a tensor on that it holds only
+			// because this one retains it
+			residentNext := nextResident(p, cur.Ops, retain, cur.Drop, residentI, readAfter(p, schedule, i))
+			if !holdsRetained(p, schedule[i+1], residentNext) {
+				continue
+			}
+			next := schedule[i+1]
+			if !sameKeys(afterNext, nextResident(p, next.Ops, next.Retain, next.Drop, residentNext, readAfter(p, schedule, i+1))) {
+				continue
+			}
+			next.Granularity = granularityFor(p.atSubgraph(i+1), next, residentNext, next.Retain)
+			if ComputeWorkingSetWithRetained(p, next.Ops, next.Granularity, residentNext, next.Retain) > p.CapacityAt(i+1) {
+				continue
+			}
+			next.Traversal = BestTraversalWithResident(p, next.Ops, next.Granularity, residentNext)
+			latNext, err := EvaluateSubgraphDetailed(p, next.Ops, next.Granularity, next.Retain, next.Traversal, residentNext, ReuseSnake)
+			if err != nil {
+				continue
+			}
+			next.Latency = latNext
+
+			if total := latI + latNext; latencyLess(total, bestTotal) {
+				bestTotal = total
+				best = &[2]ScheduleEntry{cur, next}
+			}
+		}
+
+		if best != nil {
+			schedule[i] = best[0]
+			schedule[i+1] = best[1]
+		}
+	}
+
+	return schedule
+}
+
+// holdsRetained reports whether entry has every tensor it retains: it
+// produced or read it, or holds it in resident
+func holdsRetained(p *Problem, entry ScheduleEntry, resident map[int]bool) bool {
+	boundary := GetSubgraphBoundary(p, entry.Ops)
+	for _, tIdx := range entry.Retain {
+		if !boundary.AllProduced[tIdx] && !boundary.AllConsumed[tIdx] && !resident[tIdx] {
+			return false
+		}
+	}
+	return true
+}
+
+// gcd64 returns the greatest common divisor of a and b, with gcd64(0, b) = b
+func gcd64(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestOptimizeScheduleHoldsRetained checks every planned entry has each
+// tensor it retains, under the residency EvaluateSolution tracks. On mlsys-2026-17 RefineRetentionGranularity once
+// dropped a tensor from one entry's retain list while the next entry, which
+// does not read it, still carried it on.
+func TestOptimizeScheduleHoldsRetained(t *testing.T) {
+	// mlsys-2026-17 writes its MatMuls with transposed operand shapes
+	defer func(c SolverConfig) { Config = c }(Config)
+	Config.AllowShapeMismatch = true
+
+	p, err := ReadProblem(filepath.Join("..", "benchmarks", "mlsys-2026-17.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sol := OptimizeSchedule(p, AnalyzeGraph(p))
+	resident := make(map[int]bool)
+	for i, sg := range sol.Subgraphs {
+		entry := ScheduleEntry{Ops: sg.Ops, Retain: sg.TensorsToRetain}
+		if !holdsRetained(p, entry, resident) {
+			t.Errorf("subgraph %d %v retains %v holding only %v", i, sg.Ops, sg.TensorsToRetain, sortedKeys(resident))
+		}
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+	}
+}
+
+// TestCarryRetentions checks a tensor produced by entry 0 and read next by
+// entry 2 is carried by retaining it in entry 0 alone: it stays resident
+// through entry 1, which does not list it, and entry 2 does not reload it
+func TestCarryRetentions(t *testing.T) {
+	tensor := Tensor{Width: 256, Height: 256}
+	p := &Problem{
+		Tensors: []Tensor{tensor, tensor, tensor, tensor, tensor},
+		Ops: []Op{
+			{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 1000},
+			{OpType: "Pointwise", Inputs: []int{2}, Outputs: []int{3}, BaseCost: 1000},
+			{OpType: "Pointwise", Inputs: []int{1}, Outputs: []int{4}, BaseCost: 1000},
+		},
+		FastMemoryCapacity:  1 << 20,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{128, 128},
+	}
+	gran := [3]int{128, 128, 1}
+	schedule := []ScheduleEntry{
+		{Ops: []int{0}, Granularity: gran},
+		{Ops: []int{1}, Granularity: gran},
+		{Ops: []int{2}, Granularity: gran},
+	}
+	before, err := NewEvaluationContext(p, schedule).Total()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedule = carryRetentions(p, schedule)
+	for i, want := range [][]int{{1}, nil, nil} {
+		if got := schedule[i].Retain; len(got) != len(want) || (len(want) > 0 && got[0] != want[0]) {
+			t.Errorf("entry %d retains %v, want %v", i, got, want)
+		}
+	}
+	if resident := entryResidentBefore(p, schedule, 2); !resident[1] {
+		t.Errorf("entry 2 starts with %v, want tensor 1 resident", sortedKeys(resident))
+	}
+	after, err := NewEvaluationContext(p, schedule).Total()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latencyLess(after, before) {
+		t.Errorf("latency %.1f after carrying, want below %.1f", after, before)
+	}
+}
+
+// TestPackRetention checks the knapsack picks the best-savings set that
+// fits, including where packing by score or by savings per unit would stop
+// at a worse one
+func TestPackRetention(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		costs    []int64
+		savings  []float64
+		capacity int64
+		want     []int
+	}{
+		// By savings per unit, 0 goes first and nothing else fits: 7 < 10
+		{"ratio order", []int64{6, 5, 5}, []float64{7, 5, 5}, 10, []int{1, 2}},
+		// By savings, 0 goes first and fills capacity: 10 < 12
+		{"score order", []int64{10, 3, 3, 3}, []float64{10, 4, 4, 4}, 10, []int{1, 2, 3}},
+		{"all fit", []int64{2, 3}, []float64{1, 1}, 10, []int{0, 1}},
+		{"too big", []int64{11, 4}, []float64{100, 1}, 10, []int{1}},
+		{"no savings", []int64{1, 1}, []float64{0, -1}, 10, nil},
+		{"no capacity", []int64{1}, []float64{1}, -1, nil},
+		// Capacity spans more than knapsackBuckets units of 1, so the unit is
+		// coarsened to 129 and costs round up: {0, 1} fits exactly but no
+		// longer fits in units, and the best set that does is taken instead
+		{"coarsened", []int64{1 << 20, 1<<20 + 1, 3}, []float64{5, 5, 1}, 1<<21 + 3, []int{0, 2}},
+	} {
+		got := packRetention(tc.costs, tc.savings, tc.capacity)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: packed %v, want %v", tc.name, got, tc.want)
+		}
+		var used int64
+		for _, i := range got {
+			used += tc.costs[i]
+		}
+		if len(got) > 0 && used > tc.capacity {
+			t.Errorf("%s: packed %d, capacity %d", tc.name, used, tc.capacity)
+		}
+	}
+}
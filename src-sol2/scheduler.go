@@ -12,6 +12,25 @@ type ScheduleEntry struct {
 	Traversal   []int
 	Retain      []int
 	Latency     float64
+	Dataflow    Dataflow
+	// FixedGranularity entries keep Granularity as given; the optimization
+	// phases drop retention around them rather than change it
+	FixedGranularity bool
+	// Reserved are tensors reserveReusedInputs holds resident across this
+	// entry; they stay in Retain whatever the retention planners decide
+	Reserved []int
+	// Drop evicts resident tensors a later entry reads, as
+	// Subgraph.TensorsToDrop does
+	Drop []int
+}
+
+// granularityFor returns entry's granularity when it is fixed, otherwise the
+// best one for ops under resident with retain kept afterwards
+func granularityFor(p *Problem, entry ScheduleEntry, resident map[int]bool, retain []int) [3]int {
+	if entry.FixedGranularity {
+		return entry.Granularity
+	}
+	return FindBestGranularityWithRetain(p, entry.Ops, resident, retain)
 }
 
 // BuildSchedule is the main scheduling function
@@ -59,23 +78,27 @@ func BuildSchedule(p *Problem, gi *GraphInfo, groups [][]int) []ScheduleEntry {
 	var schedule []int
 	lastScheduled := -1
 
-	remaining := make(map[int]bool)
+	remaining := make([]bool, numGroups)
 	for i := range groups {
 		remaining[i] = true
 	}
 
 	for len(schedule) < numGroups {
+		// Ready groups are collected in index order and sorted stably, so
+		// affinity ties always resolve the same way
 		var ready []int
-		for gIdx := range remaining {
-			if inDegree[gIdx] == 0 {
+		for gIdx := range groups {
+			if remaining[gIdx] && inDegree[gIdx] == 0 {
 				ready = append(ready, gIdx)
 			}
 		}
 
 		if len(ready) == 0 {
-			fmt.Println("WARNING: cycle detected in group dependencies")
-			for gIdx := range remaining {
-				ready = append(ready, gIdx)
+			fmt.Fprintln(progress, "WARNING: cycle detected in group dependencies")
+			for gIdx := range groups {
+				if remaining[gIdx] {
+					ready = append(ready, gIdx)
+				}
 			}
 		}
 
@@ -83,7 +106,7 @@ func BuildSchedule(p *Problem, gi *GraphInfo, groups [][]int) []ScheduleEntry {
 			lastOutputs := GetSubgraphBoundary(p, groups[lastScheduled]).BoundaryOutputs
 			lastInputs := groupBoundaryInputs[lastScheduled]
 
-			sort.Slice(ready, func(i, j int) bool {
+			sort.SliceStable(ready, func(i, j int) bool {
 				scoreI := computeAffinity(p, groupBoundaryInputs[ready[i]], lastOutputs, lastInputs)
 				scoreJ := computeAffinity(p, groupBoundaryInputs[ready[j]], lastOutputs, lastInputs)
 				return scoreI > scoreJ
@@ -92,7 +115,7 @@ func BuildSchedule(p *Problem, gi *GraphInfo, groups [][]int) []ScheduleEntry {
 
 		chosen := ready[0]
 		schedule = append(schedule, chosen)
-		delete(remaining, chosen)
+		remaining[chosen] = false
 		lastScheduled = chosen
 
 		for dep := range groupDependents[chosen] {
@@ -126,89 +149,196 @@ func computeAffinity(p *Problem, nextInputs map[int]bool, lastOutputs map[int]bo
 
 // OptimizeSchedule takes initial groups and produces a fully optimized schedule
 func OptimizeSchedule(p *Problem, gi *GraphInfo) *Solution {
-	// Phase 1: Form initial groups via chain fusion
-	chains := FindLinearChains(p, gi)
-	fmt.Printf("  Found %d linear chains\n", len(chains))
-
-	var allGroups [][]int
-	for _, chain := range chains {
-		if len(chain) <= 3 {
-			groups := FuseChainGreedy(p, chain, make(map[int]bool))
-			allGroups = append(allGroups, groups...)
-		} else {
-			groups := FuseChainDP(p, chain, make(map[int]bool))
-			allGroups = append(allGroups, groups...)
-		}
+	return optimizeScheduleConstrained(p, gi, nil)
+}
+
+// optimizeScheduleConstrained is OptimizeSchedule with fusion restricted by fc
+func optimizeScheduleConstrained(p *Problem, gi *GraphInfo, fc *FusionConstraints) *Solution {
+	if len(p.Ops) > partitionThresholdOps {
+		return solvePartitioned(p, gi, fc, defaultPartitionOps)
 	}
-	fmt.Printf("  Formed %d groups after chain fusion\n", len(allGroups))
+	allGroups := formGroups(p, gi, fc)
+	return scheduleGroups(p, gi, allGroups, fc)
+}
+
+// formGroups runs chain fusion and cross-chain fusion (phases 1-2)
+func formGroups(p *Problem, gi *GraphInfo, fc *FusionConstraints) [][]int {
+	allGroups := chainFusionGroups(p, gi, fc)
 
 	// Phase 2: Try cross-chain fusion for groups sharing large inputs
-	allGroups = tryCrossChainFusion(p, gi, allGroups)
-	fmt.Printf("  %d groups after cross-chain fusion\n", len(allGroups))
+	withPhase("cross-chain", func() {
+		allGroups = tryCrossChainFusion(p, gi, allGroups, fc)
+	})
+	fmt.Fprintf(progress, "  %d groups after cross-chain fusion\n", len(allGroups))
 
-	// Phase 3: Order groups
-	schedule := BuildSchedule(p, gi, allGroups)
-	fmt.Printf("  Ordered %d schedule entries\n", len(schedule))
+	return allGroups
+}
 
-	// Phase 4: Optimize granularity
-	for i := range schedule {
-		resident := make(map[int]bool)
-		if i > 0 {
-			for _, tIdx := range schedule[i-1].Retain {
-				resident[tIdx] = true
+// chainFusionGroups is phase 1 of formGroups: every linear chain, split at
+// pins, fused by FuseChainDP
+func chainFusionGroups(p *Problem, gi *GraphInfo, fc *FusionConstraints) [][]int {
+	var chains [][]int
+	withPhase("chains", func() {
+		chains = FindLinearChains(p, gi)
+	})
+	fmt.Fprintf(progress, "  Found %d linear chains\n", len(chains))
+
+	allGroups := fc.pinnedGroupsCopy()
+	withPhase("fusion-dp", func() {
+		for _, chain := range chains {
+			for _, run := range fc.splitChainAtPins(chain) {
+				// Short chains use the DP too: greedy extension stops at a
+				// poor two-op prefix even when fusing the whole chain wins
+				groups := FuseChainDP(p, gi, run, make(map[int]bool), fc)
+				allGroups = append(allGroups, groups...)
 			}
 		}
+	})
+	fmt.Fprintf(progress, "  Formed %d groups after chain fusion\n", len(allGroups))
+	return allGroups
+}
+
+// scheduleGroups orders groups and optimizes granularity, traversal and
+// retention for them (phases 3-9)
+func scheduleGroups(p *Problem, gi *GraphInfo, allGroups [][]int, fc *FusionConstraints) *Solution {
+	// Phase 3: Order groups
+	var schedule []ScheduleEntry
+	withPhase("ordering", func() {
+		schedule = BuildSchedule(p, gi, allGroups)
+	})
+	fmt.Fprintf(progress, "  Ordered %d schedule entries\n", len(schedule))
+	fc.fixGranularities(schedule)
+
+	return optimizeEntries(p, schedule)
+}
 
-		gran := FindBestGranularity(p, schedule[i].Ops, resident)
-		trav := BestTraversal(p, schedule[i].Ops, gran)
-		schedule[i].Granularity = gran
-		schedule[i].Traversal = trav
+// optimizeEntries optimizes granularity, traversal, retention and dataflow
+// for an ordered schedule (phases 4-9) and converts it to a Solution
+func optimizeEntries(p *Problem, schedule []ScheduleEntry) *Solution {
+	schedule = planEntries(p, schedule)
+
+	// Phase 8: Prune, then carry tensors past subgraphs that do not use them
+	withPhase("pruning", func() {
+		schedule = pruneRetentions(p, schedule)
+		schedule = carryRetentions(p, schedule)
+	})
+
+	// Phase 9: Switch MatMul subgraphs to input-stationary where cheaper, if
+	// enabled. Retention is fixed by now, so each entry only changes its own
+	// latency.
+	if Config.InputStationary {
+		withPhase("dataflow", func() { chooseDataflows(p, schedule) })
 	}
 
-	// Phase 5: Plan retention
+	return scheduleSolution(schedule)
+}
+
+// chooseDataflows is phase 9 of optimizeEntries
+func chooseDataflows(p *Problem, schedule []ScheduleEntry) {
+	resident := make(map[int]bool)
 	for i := range schedule {
-		resident := make(map[int]bool)
 		if i > 0 {
-			for _, tIdx := range schedule[i-1].Retain {
-				resident[tIdx] = true
-			}
+			resident = entryResidentAfter(p, schedule, i-1, resident)
+		}
+		if !HasMatMul(p, schedule[i].Ops) || schedule[i].FixedGranularity {
+			continue
 		}
 
-		retain := PlanRetentionGlobal(p, i, schedule, resident)
-		schedule[i].Retain = retain
+		gran, dataflow := FindBestDataflowGranularity(p.atSubgraph(i), schedule[i].Ops, resident, schedule[i].Retain)
+		if dataflow != InputStationary {
+			continue
+		}
+		trav := BestTraversalWithResident(p, schedule[i].Ops, gran, resident)
+		lat, err := EvaluateSubgraphDataflow(p, schedule[i].Ops, gran, schedule[i].Retain, trav, resident, dataflow)
+		if err == nil && latencyLess(lat, schedule[i].Latency) {
+			schedule[i].Granularity = gran
+			schedule[i].Traversal = trav
+			schedule[i].Latency = lat
+			schedule[i].Dataflow = dataflow
+		}
 	}
+}
 
-	// Phase 6: Re-optimize granularity
-	for i := range schedule {
+// planEntries sizes, orders traversal for and plans retention of an ordered
+// schedule (phases 4-7), leaving its grouping and order as they are
+func planEntries(p *Problem, schedule []ScheduleEntry) []ScheduleEntry {
+	if Config.ReusedInputMinUses > 0 {
+		schedule = reserveReusedInputs(p, schedule, Config.ReusedInputMinUses)
+	}
+
+	// Phase 4: Optimize granularity
+	withPhase("granularity", func() {
 		resident := make(map[int]bool)
-		if i > 0 {
-			for _, tIdx := range schedule[i-1].Retain {
-				resident[tIdx] = true
+		for i := range schedule {
+			if i > 0 {
+				resident = entryResidentAfter(p, schedule, i-1, resident)
 			}
-		}
 
-		retainAfter := schedule[i].Retain
-		ws := ComputeWorkingSetWithRetained(p, schedule[i].Ops, schedule[i].Granularity, resident, retainAfter)
-		if ws > p.FastMemoryCapacity {
-			gran := FindBestGranularityWithRetain(p, schedule[i].Ops, resident, retainAfter)
+			gran := schedule[i].Granularity
+			if !schedule[i].FixedGranularity {
+				gran = FindBestGranularity(p.atSubgraph(i), schedule[i].Ops, resident)
+			}
 			trav := BestTraversal(p, schedule[i].Ops, gran)
 			schedule[i].Granularity = gran
 			schedule[i].Traversal = trav
 		}
+	})
+
+	// Phase 5: Plan retention
+	withPhase("retention", func() {
+		resident := make(map[int]bool)
+		for i := range schedule {
+			if i > 0 {
+				resident = entryResidentAfter(p, schedule, i-1, resident)
+			}
 
-		lat, err := EvaluateSubgraphDetailed(
-			p, schedule[i].Ops, schedule[i].Granularity,
-			schedule[i].Retain, schedule[i].Traversal, resident,
-		)
-		if err != nil {
-			lat = 0
+			// The plan weighs every resident tensor for the next boundary
+			// only, so what it does not keep is dropped, not carried on
+			retain := PlanRetentionGlobal(p, i, schedule, resident)
+			schedule[i].Retain = retain
+			schedule[i].Drop = setDifference(sortedKeys(resident), retain)
 		}
-		schedule[i].Latency = lat
-	}
+	})
 
-	// Phase 7: Prune
-	schedule = pruneRetentions(p, schedule)
+	// Phase 6: Re-optimize granularity
+	withPhase("granularity", func() {
+		resident := make(map[int]bool)
+		for i := range schedule {
+			if i > 0 {
+				resident = entryResidentAfter(p, schedule, i-1, resident)
+			}
+
+			if schedule[i].FixedGranularity {
+				resident = fitFixedGranularity(p, schedule, i, resident)
+			}
+			retainAfter := schedule[i].Retain
+			ws := ComputeWorkingSetWithRetained(p, schedule[i].Ops, schedule[i].Granularity, resident, retainAfter)
+			if ws > p.CapacityAt(i) && !schedule[i].FixedGranularity {
+				gran := FindBestGranularityWithRetain(p.atSubgraph(i), schedule[i].Ops, resident, retainAfter)
+				schedule[i].Granularity = gran
+			}
+			schedule[i].Traversal = BestTraversalWithResident(p, schedule[i].Ops, schedule[i].Granularity, resident)
+
+			lat, err := EvaluateSubgraphDetailed(
+				p, schedule[i].Ops, schedule[i].Granularity,
+				schedule[i].Retain, schedule[i].Traversal, resident, ReuseSnake,
+			)
+			if err != nil {
+				lat = 0
+			}
+			schedule[i].Latency = lat
+		}
+	})
+
+	// Phase 7: Trade retention against granularity
+	withPhase("refine", func() {
+		schedule = RefineRetentionGranularity(p, schedule)
+	})
+	return schedule
+}
 
+// scheduleSolution converts an optimized schedule to a Solution
+func scheduleSolution(schedule []ScheduleEntry) *Solution {
 	subgraphs := make([]Subgraph, len(schedule))
 	for i, entry := range schedule {
 		subgraphs[i] = Subgraph{
@@ -217,82 +347,74 @@ func OptimizeSchedule(p *Problem, gi *GraphInfo) *Solution {
 			TensorsToRetain: entry.Retain,
 			TraversalOrder:  entry.Traversal,
 			SubgraphLatency: entry.Latency,
+			Dataflow:        entry.Dataflow,
+			TensorsToDrop:   entry.Drop,
 		}
 	}
 
 	return &Solution{Subgraphs: subgraphs}
 }
 
+// fitFixedGranularity makes room for entry i's fixed granularity, first by
+// dropping what it retains and then, if needed, everything the previous
+// entry keeps resident for it, which is re-evaluated. It returns entry i's residency.
+func fitFixedGranularity(p *Problem, schedule []ScheduleEntry, i int, resident map[int]bool) map[int]bool {
+	entry := &schedule[i]
+	if ComputeWorkingSetWithRetained(p, entry.Ops, entry.Granularity, resident, entry.Retain) <= p.CapacityAt(i) {
+		return resident
+	}
+	entry.Retain = []int{}
+	if i == 0 || ComputeWorkingSet(p, entry.Ops, entry.Granularity, resident) <= p.CapacityAt(i) {
+		return resident
+	}
+
+	prev := &schedule[i-1]
+	prevResident := entryResidentBefore(p, schedule, i-1)
+	prev.Retain = []int{}
+	prev.Drop = sortedKeys(prevResident)
+	lat, err := EvaluateSubgraphDataflow(p, prev.Ops, prev.Granularity, nil, prev.Traversal, prevResident, prev.Dataflow)
+	if err == nil {
+		prev.Latency = lat
+	}
+	return make(map[int]bool)
+}
+
+// pruneRetentions drops each retained tensor whose removal lowers the
+// schedule's latency, re-evaluating only the entries a removal affects
 func pruneRetentions(p *Problem, schedule []ScheduleEntry) []ScheduleEntry {
+	ec := NewEvaluationContext(p, schedule)
+	best, err := ec.Total()
+	if err != nil {
+		return schedule
+	}
+
 	improved := true
 	for improved {
 		improved = false
 		for i := range schedule {
-			if len(schedule[i].Retain) == 0 {
-				continue
-			}
-
 			for rIdx := len(schedule[i].Retain) - 1; rIdx >= 0; rIdx-- {
-				currentTotal := schedule[i].Latency
-				if i+1 < len(schedule) {
-					currentTotal += schedule[i+1].Latency
-				}
-
-				newRetain := make([]int, 0, len(schedule[i].Retain)-1)
-				for j, t := range schedule[i].Retain {
-					if j != rIdx {
-						newRetain = append(newRetain, t)
-					}
-				}
-
-				residentI := make(map[int]bool)
-				if i > 0 {
-					for _, t := range schedule[i-1].Retain {
-						residentI[t] = true
-					}
+				// The next subgraph holds a carried tensor for a later one
+				// and cannot keep it if it never arrives
+				if i+1 < len(schedule) && isCarried(p, schedule[i+1], schedule[i].Retain[rIdx]) {
+					continue
 				}
-
-				latI, errI := EvaluateSubgraphDetailed(
-					p, schedule[i].Ops, schedule[i].Granularity,
-					newRetain, schedule[i].Traversal, residentI,
-				)
-				if errI != nil {
+				if containsInt(schedule[i].Reserved, schedule[i].Retain[rIdx]) {
 					continue
 				}
 
-				newTotal := latI
-				if i+1 < len(schedule) {
-					residentNext := make(map[int]bool)
-					for _, t := range newRetain {
-						residentNext[t] = true
-					}
-
-					latNext, errNext := EvaluateSubgraphDetailed(
-						p, schedule[i+1].Ops, schedule[i+1].Granularity,
-						schedule[i+1].Retain, schedule[i+1].Traversal, residentNext,
-					)
-					if errNext != nil {
-						continue
-					}
-					newTotal += latNext
-				}
+				oldRetain := schedule[i].Retain
+				newRetain := make([]int, 0, len(oldRetain)-1)
+				newRetain = append(newRetain, oldRetain[:rIdx]...)
+				schedule[i].Retain = append(newRetain, oldRetain[rIdx+1:]...)
+				ec.InvalidateFrom(i)
 
-				if newTotal < currentTotal {
-					schedule[i].Retain = newRetain
-					schedule[i].Latency = latI
-					if i+1 < len(schedule) {
-						residentNext := make(map[int]bool)
-						for _, t := range newRetain {
-							residentNext[t] = true
-						}
-						latNext, _ := EvaluateSubgraphDetailed(
-							p, schedule[i+1].Ops, schedule[i+1].Granularity,
-							schedule[i+1].Retain, schedule[i+1].Traversal, residentNext,
-						)
-						schedule[i+1].Latency = latNext
-					}
+				if total, err := ec.Total(); err == nil && latencyLess(total, best) {
+					best = total
 					improved = true
+					continue
 				}
+				schedule[i].Retain = oldRetain
+				ec.InvalidateFrom(i)
 			}
 		}
 	}
@@ -2,43 +2,132 @@ package main
 
 import (
 	"fmt"
+	"slices"
 )
 
-// SolveOptimized is the main solver entry point
-func SolveOptimized(p *Problem) *Solution {
-	fmt.Println("  Running sol-2 optimized solver...")
+// SolveOptimized is the main solver entry point. It returns an error only
+// if no schedule respects Config.MinTileArea.
+func SolveOptimized(p *Problem) (*Solution, error) {
+	fmt.Fprintln(progress, "  Running sol-2 optimized solver...")
 
 	// Phase 1: Analyze graph
 	gi := AnalyzeGraph(p)
-	fmt.Printf("  Graph: %d ops, %d graph inputs, %d graph outputs\n",
+	fmt.Fprintf(progress, "  Graph: %d ops, %d graph inputs, %d graph outputs\n",
 		len(p.Ops), len(gi.GraphInputs), len(gi.GraphOutputs))
 
+	return solveAnalyzed(p, gi)
+}
+
+// solveAnalyzed is SolveOptimized for a graph already analyzed into gi
+func solveAnalyzed(p *Problem, gi *GraphInfo) (*Solution, error) {
+	defer cacheFusions(p)()
+
+	// The whole graph as one subgraph is priced as EvaluateSolution prices
+	// any solution, overheads included. At the lower bound it cannot be
+	// beaten.
+	var whole *Solution
+	var wholeLat float64
+	if sg, fits := wholeGraphSubgraph(p, gi); fits {
+		if lat, err := EvaluateSolution(p, &Solution{Subgraphs: []Subgraph{sg}}); err == nil {
+			whole, wholeLat = &Solution{Subgraphs: []Subgraph{sg}}, lat
+		}
+	}
+	if whole != nil && latencyTie(wholeLat, ComputeLowerBound(p)) {
+		fmt.Fprintf(progress, "  Whole graph fits as one subgraph at the lower bound, latency %.1f\n", wholeLat)
+		return verifyOrRecover(p, gi, whole)
+	}
+
 	// Phase 2-7: Full optimization pipeline
 	sol := OptimizeSchedule(p, gi)
 
-	// Final verification
+	// Phase 10: Fuse subgraphs across short tensor live ranges
+	sol = MergeLiveRanges(p, gi, sol)
+
+	// Phase 11: Fuse adjacent pointwise subgraphs, whatever chain they came from
+	sol = MergeAdjacentPointwise(p, gi, sol)
+
+	if whole != nil {
+		if lat, err := EvaluateSolution(p, sol); err != nil || latencyLess(wholeLat, lat) {
+			fmt.Fprintf(progress, "  Whole graph as one subgraph beats the pipeline, latency %.1f\n", wholeLat)
+			sol = whole
+		}
+	}
+
+	return verifyOrRecover(p, gi, sol)
+}
+
+// wholeGraphSubgraph fuses every op of p into one subgraph, sized and
+// ordered for it. It returns false if the ops cannot share a subgraph or
+// do not fit in fast memory at any granularity.
+func wholeGraphSubgraph(p *Problem, gi *GraphInfo) (Subgraph, bool) {
+	ops := gi.TopoOrder
+	if len(ops) == 0 || len(ops) > maxFusedOps(p, len(ops)) || !fusible(p, ops) || !gridCompatible(p, ops) {
+		return Subgraph{}, false
+	}
+
+	pi := p.atSubgraph(0)
+	gran, dataflow := FindBestGranularity(pi, ops, nil), OutputStationary
+	if Config.InputStationary && HasMatMul(p, ops) {
+		gran, dataflow = FindBestDataflowGranularity(pi, ops, nil, nil)
+	}
+	if ComputeWorkingSet(p, ops, gran, nil) > pi.FastMemoryCapacity {
+		return Subgraph{}, false
+	}
+	trav := BestTraversal(p, ops, gran)
+	lat, err := EvaluateSubgraphDataflow(p, ops, gran, nil, trav, nil, dataflow)
+	if err != nil {
+		return Subgraph{}, false
+	}
+
+	return Subgraph{
+		Ops:             append([]int{}, ops...),
+		Granularity:     gran,
+		TensorsToRetain: []int{},
+		TraversalOrder:  trav,
+		SubgraphLatency: lat,
+		Dataflow:        dataflow,
+	}, true
+}
+
+// verifyOrRecover validates sol, falling back to recovery and then the
+// baseline schedule if it does not evaluate cleanly. It returns an error if
+// the baseline needs tiles below Config.MinTileArea.
+func verifyOrRecover(p *Problem, gi *GraphInfo, sol *Solution) (*Solution, error) {
 	totalLat, err := EvaluateSolution(p, sol)
 	if err != nil {
-		fmt.Printf("  WARNING: Validation failed: %v\n", err)
-		fmt.Println("  Attempting recovery...")
-		sol = recoverSolution(p, gi, sol)
-		totalLat, err = EvaluateSolution(p, sol)
+		fmt.Fprintf(progress, "  WARNING: Validation failed: %v\n", err)
+		fmt.Fprintln(progress, "  Attempting recovery...")
+		recovered, recErr := recoverSolution(p, gi, sol)
+		if recErr == nil {
+			sol = recovered
+			totalLat, err = EvaluateSolution(p, sol)
+		} else {
+			err = recErr
+		}
 		if err != nil {
-			fmt.Printf("  FATAL: Recovery failed: %v\n", err)
+			fmt.Fprintf(progress, "  FATAL: Recovery failed: %v\n", err)
 			// Last resort: baseline
-			fmt.Println("  Falling back to baseline...")
-			sol = baselineSolution(p, gi)
+			fmt.Fprintln(progress, "  Falling back to baseline...")
+			if sol, err = baselineSolution(p, gi); err != nil {
+				return nil, fmt.Errorf("infeasible: %w", err)
+			}
 			totalLat, _ = EvaluateSolution(p, sol)
 		}
 	}
 
-	fmt.Printf("  Final latency: %.1f\n", totalLat)
-	return sol
+	fmt.Fprintf(progress, "  Final latency: %.1f\n", totalLat)
+	if lb := ComputeLowerBound(p); lb > 0 {
+		fmt.Fprintf(progress, "  Solution is within %.1f%% of lower bound %.1f\n", (totalLat-lb)/lb*100, lb)
+	}
+	return sol, nil
 }
 
-// recoverSolution attempts to fix a broken solution
-func recoverSolution(p *Problem, gi *GraphInfo, broken *Solution) *Solution {
-	// Strategy: keep the grouping but recompute everything else conservatively
+// recoverSolution attempts to fix a broken solution. It returns an error if
+// a subgraph fits only with tiles below Config.MinTileArea.
+func recoverSolution(p *Problem, gi *GraphInfo, broken *Solution) (*Solution, error) {
+	// Strategy: keep the grouping but recompute everything else
+	// conservatively. Each recovered subgraph drops whatever it does not
+	// retain, so residency never spans more than one boundary.
 	var subgraphs []Subgraph
 
 	resident := make(map[int]bool)
@@ -50,25 +139,39 @@ func recoverSolution(p *Problem, gi *GraphInfo, broken *Solution) *Solution {
 		ops = sortOpsTopologically(gi, ops)
 
 		// Find a granularity that fits with current residency
-		gran := FindBestGranularity(p, ops, resident)
+		pi := p.atSubgraph(len(subgraphs))
+		gran := FindBestGranularity(pi, ops, resident)
 
 		// Check working set
 		ws := ComputeWorkingSet(p, ops, gran, resident)
-		if ws > p.FastMemoryCapacity {
+		if ws > pi.FastMemoryCapacity && len(resident) > 0 {
+			// Dropping the previous retention and shrinking the tile is a
+			// much smaller change than splitting the group
+			resident = make(map[int]bool)
+			dropLastRetention(p, subgraphs)
+			gran = FindBestGranularity(pi, ops, resident)
+			ws = ComputeWorkingSet(p, ops, gran, resident)
+		}
+		if ws > pi.FastMemoryCapacity {
 			// Split the group into individual ops
 			for _, opIdx := range ops {
 				singleOps := []int{opIdx}
-				singleGran := FindBestGranularity(p, singleOps, resident)
+				ps := p.atSubgraph(len(subgraphs))
+				singleGran := FindBestGranularity(ps, singleOps, resident)
 				singleWS := ComputeWorkingSet(p, singleOps, singleGran, resident)
 
-				if singleWS > p.FastMemoryCapacity {
+				if singleWS > ps.FastMemoryCapacity {
 					// Need to evict retained tensors
 					resident = make(map[int]bool)
-					singleGran = FindBestGranularity(p, singleOps, resident)
+					dropLastRetention(p, subgraphs)
+					singleGran = FindBestGranularity(ps, singleOps, resident)
+				}
+				if err := checkTileArea(ps, singleOps, singleGran); err != nil {
+					return nil, err
 				}
 
 				trav := BestTraversal(p, singleOps, singleGran)
-				lat, err := EvaluateSubgraphDetailed(p, singleOps, singleGran, nil, trav, resident)
+				lat, err := EvaluateSubgraphDetailed(p, singleOps, singleGran, nil, trav, resident, ReuseSnake)
 				if err != nil {
 					lat = 0
 				}
@@ -79,12 +182,16 @@ func recoverSolution(p *Problem, gi *GraphInfo, broken *Solution) *Solution {
 					TensorsToRetain: []int{},
 					TraversalOrder:  trav,
 					SubgraphLatency: lat,
+					TensorsToDrop:   sortedKeys(resident),
 				})
 
 				resident = make(map[int]bool)
 			}
 			continue
 		}
+		if err := checkTileArea(pi, ops, gran); err != nil {
+			return nil, err
+		}
 
 		trav := BestTraversal(p, ops, gran)
 
@@ -92,17 +199,18 @@ func recoverSolution(p *Problem, gi *GraphInfo, broken *Solution) *Solution {
 		var retain []int
 		if i+1 < len(broken.Subgraphs) {
 			nextOps := sortOpsTopologically(gi, broken.Subgraphs[i+1].Ops)
-			nextGran := FindBestGranularity(p, nextOps, make(map[int]bool))
-			retain = PlanRetentionSimple(p, ops, nextOps, gran, nextGran, resident)
+			pNext := p.atSubgraph(len(subgraphs) + 1)
+			nextGran := FindBestGranularity(pNext, nextOps, make(map[int]bool))
+			retain = PlanRetentionSimple(p, ops, nextOps, gran, nextGran, resident, len(subgraphs)+1)
 
 			// Verify retention fits
 			wsRetain := ComputeWorkingSetWithRetained(p, ops, gran, resident, retain)
-			if wsRetain > p.FastMemoryCapacity {
+			if wsRetain > pi.FastMemoryCapacity {
 				retain = []int{} // drop all retention
 			}
 		}
 
-		lat, err := EvaluateSubgraphDetailed(p, ops, gran, retain, trav, resident)
+		lat, err := EvaluateSubgraphDetailed(p, ops, gran, retain, trav, resident, ReuseSnake)
 		if err != nil {
 			lat = 0
 		}
@@ -113,6 +221,7 @@ func recoverSolution(p *Problem, gi *GraphInfo, broken *Solution) *Solution {
 			TensorsToRetain: retain,
 			TraversalOrder:  trav,
 			SubgraphLatency: lat,
+			TensorsToDrop:   setDifference(sortedKeys(resident), retain),
 		})
 
 		// Update resident
@@ -122,19 +231,51 @@ func recoverSolution(p *Problem, gi *GraphInfo, broken *Solution) *Solution {
 		}
 	}
 
-	return &Solution{Subgraphs: subgraphs}
+	return &Solution{Subgraphs: subgraphs}, nil
+}
+
+// dropLastRetention clears the retain list of the last recovered subgraph so
+// the next one starts with nothing resident, and re-evaluates its latency
+func dropLastRetention(p *Problem, subgraphs []Subgraph) {
+	if len(subgraphs) == 0 {
+		return
+	}
+	last := &subgraphs[len(subgraphs)-1]
+	if len(last.TensorsToRetain) == 0 {
+		return
+	}
+	last.TensorsToRetain = []int{}
+
+	resident := make(map[int]bool)
+	if len(subgraphs) > 1 {
+		for _, tIdx := range subgraphs[len(subgraphs)-2].TensorsToRetain {
+			resident[tIdx] = true
+		}
+	}
+	last.TensorsToDrop = sortedKeys(resident)
+	lat, err := EvaluateSubgraphDataflow(p, last.Ops, last.Granularity, nil, last.TraversalOrder, resident, last.Dataflow)
+	if err != nil {
+		lat = 0
+	}
+	last.SubgraphLatency = lat
 }
 
-// baselineSolution produces a safe fallback: one op per subgraph, no retention
-func baselineSolution(p *Problem, gi *GraphInfo) *Solution {
+// baselineSolution produces a safe fallback: one op per subgraph, no
+// retention. It returns an error if an op fits only with tiles below
+// Config.MinTileArea.
+func baselineSolution(p *Problem, gi *GraphInfo) (*Solution, error) {
 	var subgraphs []Subgraph
 
-	for _, opIdx := range gi.TopoOrder {
+	for i, opIdx := range gi.TopoOrder {
 		ops := []int{opIdx}
-		gran := FindBestGranularity(p, ops, make(map[int]bool))
+		pi := p.atSubgraph(i)
+		gran := FindBestGranularity(pi, ops, make(map[int]bool))
+		if err := checkTileArea(pi, ops, gran); err != nil {
+			return nil, fmt.Errorf("op %d: %w", opIdx, err)
+		}
 		trav := BestTraversal(p, ops, gran)
 
-		lat, err := EvaluateSubgraphDetailed(p, ops, gran, nil, trav, make(map[int]bool))
+		lat, err := EvaluateSubgraphDetailed(p, ops, gran, nil, trav, make(map[int]bool), ReuseSnake)
 		if err != nil {
 			lat = 0
 		}
@@ -148,17 +289,76 @@ func baselineSolution(p *Problem, gi *GraphInfo) *Solution {
 		})
 	}
 
-	return &Solution{Subgraphs: subgraphs}
+	return &Solution{Subgraphs: subgraphs}, nil
 }
 
 // PrintSolutionSummary prints a human-readable summary
 func PrintSolutionSummary(p *Problem, sol *Solution) {
 	total := 0.0
 	for i, sg := range sol.Subgraphs {
-		fmt.Printf("  SG %d: ops=%v gran=[%d,%d,%d] retain=%v lat=%.1f\n",
+		fmt.Fprintf(progress, "  SG %d: ops=%v gran=[%d,%d,%d] retain=%v lat=%.1f\n",
 			i, sg.Ops, sg.Granularity[0], sg.Granularity[1], sg.Granularity[2],
 			sg.TensorsToRetain, sg.SubgraphLatency)
 		total += sg.SubgraphLatency
 	}
-	fmt.Printf("  Total: %.1f\n", total)
+	fmt.Fprintf(progress, "  Total: %.1f\n", total)
+}
+
+// CanonicalizeOpOrder sorts the ops of every subgraph of sol into the
+// graph's topological order, so the same grouping is written the same way
+// however it was formed. A subgraph whose order changes is re-evaluated,
+// since the evaluator takes some input roles from a tensor's first use.
+func CanonicalizeOpOrder(p *Problem, gi *GraphInfo, sol *Solution) {
+	resident := make(map[int]bool)
+	for i := range sol.Subgraphs {
+		sg := &sol.Subgraphs[i]
+		if sorted := sortOpsTopologically(gi, sg.Ops); !slices.Equal(sorted, sg.Ops) {
+			sg.Ops = sorted
+			lat, err := EvaluateSubgraphDataflow(p, sg.Ops, sg.Granularity, sg.TensorsToRetain, sg.TraversalOrder, resident, sg.Dataflow)
+			if err == nil {
+				sg.SubgraphLatency = lat
+			}
+		}
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+	}
+}
+
+// NormalizeSolution clamps every subgraph's granularity to its output tensor
+// and reduction depth, re-deriving traversal and latency for any subgraph it
+// touches. Over-large tiles are rejected by some downstream validators.
+func NormalizeSolution(p *Problem, sol *Solution) {
+	resident := make(map[int]bool)
+
+	for i := range sol.Subgraphs {
+		sg := &sol.Subgraphs[i]
+		outT := GetOutputShape(p, sg.Ops)
+		maxK := GetMaxK(p, sg.Ops)
+
+		if isZeroSized(outT) {
+			// Nothing to tile; EvaluateSolution reports and skips it
+			resident = residentAfter(p, sol.Subgraphs, i, resident)
+			continue
+		}
+
+		clamped := [3]int{
+			MaxInt(1, MinInt(sg.Granularity[0], outT.Width)),
+			MaxInt(1, MinInt(sg.Granularity[1], outT.Height)),
+			MaxInt(1, MinInt(sg.Granularity[2], maxK)),
+		}
+
+		if clamped != sg.Granularity {
+			fmt.Fprintf(progress, "  Clamped SG %d granularity [%d,%d,%d] -> [%d,%d,%d]\n",
+				i, sg.Granularity[0], sg.Granularity[1], sg.Granularity[2],
+				clamped[0], clamped[1], clamped[2])
+
+			sg.Granularity = clamped
+			sg.TraversalOrder = BestTraversal(p, sg.Ops, clamped)
+			lat, err := EvaluateSubgraphDataflow(p, sg.Ops, clamped, sg.TensorsToRetain, sg.TraversalOrder, resident, sg.Dataflow)
+			if err == nil {
+				sg.SubgraphLatency = lat
+			}
+		}
+
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+	}
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"io"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// chainProblem is a chain of n pointwise ops over 256x256 tensors, small
+// enough to run whole as one subgraph
+func chainProblem(n int) *Problem {
+	p := &Problem{
+		FastMemoryCapacity:  1 << 20,
+		SlowMemoryBandwidth: 10,
+		NativeGranularity:   [2]int{128, 128},
+	}
+	for i := 0; i <= n; i++ {
+		p.Tensors = append(p.Tensors, Tensor{Width: 256, Height: 256})
+	}
+	for i := 0; i < n; i++ {
+		p.Ops = append(p.Ops, Op{OpType: "Pointwise", Inputs: []int{i}, Outputs: []int{i + 1}, BaseCost: 1000})
+	}
+	return p
+}
+
+// TestSolveWholeGraphSameTerms checks the whole-graph subgraph and the
+// pipeline are compared as EvaluateSolution prices them, overheads
+// included: the solution returned is never worse than the whole graph.
+func TestSolveWholeGraphSameTerms(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+	Config.PerSubgraphOverhead = 500
+	Config.ContextSwitchCost = 100
+
+	p := chainProblem(4)
+	gi := AnalyzeGraph(p)
+	sg, fits := wholeGraphSubgraph(p, gi)
+	if !fits {
+		t.Fatal("whole graph does not fit")
+	}
+	wholeLat, err := EvaluateSolution(p, &Solution{Subgraphs: []Subgraph{sg}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sol, err := SolveOptimized(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lat, err := EvaluateSolution(p, sol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latencyLess(wholeLat, lat) {
+		t.Errorf("solution latency %.1f, whole graph %.1f", lat, wholeLat)
+	}
+}
+
+// TestSolvePrimaryOutputMatchesReference checks every emitted subgraph is in
+// topological order with its grid taken from the last op's first output, the
+// tensor the reference evaluator sizes the grid by.
+func TestSolvePrimaryOutputMatchesReference(t *testing.T) {
+	for _, name := range []string{"mlsys-2026-5", "mlsys-2026-13"} {
+		p, err := ReadProblem(filepath.Join("..", "benchmarks", name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sol, err := SolveOptimized(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, sg := range sol.Subgraphs {
+			if err := checkTopologicalOrder(p, sg.Ops); err != nil {
+				t.Errorf("%s subgraph %d: %v", name, i, err)
+			}
+			want := p.Ops[sg.Ops[len(sg.Ops)-1]].Outputs[0]
+			if got := GetOutputTensor(p, sg.Ops); got != want {
+				t.Errorf("%s subgraph %d %v: grid from tensor %d, reference uses %d", name, i, sg.Ops, got, want)
+			}
+		}
+	}
+}
+
+// TestSolveCapacityDrop checks a capacity schedule that shrinks fast memory
+// for one subgraph mid-schedule gives just that subgraph a smaller
+// granularity, and EvaluateSolution accepts the result
+func TestSolveCapacityDrop(t *testing.T) {
+	p := chainProblem(4)
+	p.MaxSubgraphOps = 1
+	p.CapacitySchedule = []int64{0, 0, 40000}
+
+	sol, err := SolveOptimized(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sol.Subgraphs) != 4 {
+		t.Fatalf("%d subgraphs, want 4", len(sol.Subgraphs))
+	}
+	for i, sg := range sol.Subgraphs {
+		area := sg.Granularity[0] * sg.Granularity[1]
+		switch {
+		case i == 2 && area >= 256*256:
+			t.Errorf("subgraph 2 under capacity 40000 has granularity %v", sg.Granularity)
+		case i != 2 && area != 256*256:
+			t.Errorf("subgraph %d has granularity %v, want the whole 256x256 tensor", i, sg.Granularity)
+		}
+	}
+	if _, err := EvaluateSolution(p, sol); err != nil {
+		t.Errorf("solution rejected: %v", err)
+	}
+}
+
+// TestNormalizeSolution checks an over-large granularity is clamped to the
+// output tensor and reduction depth, with a traversal for the clamped grid,
+// and the normalized solution is valid
+func TestNormalizeSolution(t *testing.T) {
+	p := chainProblem(2)
+	for _, tc := range []struct {
+		gran, want [3]int
+	}{
+		{[3]int{512, 1024, 64}, [3]int{256, 256, 1}},
+		{[3]int{64, 512, 1}, [3]int{64, 256, 1}},
+		{[3]int{128, 128, 1}, [3]int{128, 128, 1}},
+	} {
+		sol := &Solution{Subgraphs: []Subgraph{
+			{Ops: []int{0}, Granularity: tc.gran},
+			{Ops: []int{1}, Granularity: [3]int{128, 128, 1}, TraversalOrder: []int{0, 1, 3, 2}},
+		}}
+		NormalizeSolution(p, sol)
+
+		if got := sol.Subgraphs[0].Granularity; got != tc.want {
+			t.Errorf("granularity %v: clamped to %v, want %v", tc.gran, got, tc.want)
+		}
+		if err := checkTraversal(sol.Subgraphs[0].TraversalOrder, gridTiles(p, []int{0}, tc.want)); err != nil {
+			t.Errorf("granularity %v: %v", tc.gran, err)
+		}
+		if got := sol.Subgraphs[1].TraversalOrder; !slices.Equal(got, []int{0, 1, 3, 2}) {
+			t.Errorf("granularity %v: untouched subgraph's traversal changed to %v", tc.gran, got)
+		}
+		if _, err := EvaluateSolution(p, sol); err != nil {
+			t.Errorf("granularity %v: normalized solution rejected: %v", tc.gran, err)
+		}
+	}
+}
+
+// TestSolvePerSubgraphOverhead checks a larger per-subgraph overhead fuses
+// mlsys-2026-5 into fewer subgraphs, and EvaluateSolution charges the
+// overhead once per subgraph
+func TestSolvePerSubgraphOverhead(t *testing.T) {
+	defer func(c SolverConfig) { Config = c }(Config)
+
+	p, err := ReadProblem(filepath.Join("..", "benchmarks", "mlsys-2026-5.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := len(p.Ops) + 1
+	for _, overhead := range []float64{0, 1e5, 1e6} {
+		Config.PerSubgraphOverhead = overhead
+		sol, err := SolveOptimized(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(sol.Subgraphs); n >= prev {
+			t.Errorf("overhead %g: %d subgraphs, want fewer than %d", overhead, n, prev)
+		}
+		prev = len(sol.Subgraphs)
+
+		total, err := EvaluateSolution(p, sol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Config.PerSubgraphOverhead = 0
+		bare, err := EvaluateSolution(p, sol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := bare + overhead*float64(len(sol.Subgraphs)); math.Abs(total-want) > 1e-6*want {
+			t.Errorf("overhead %g: total %.1f, want %.1f", overhead, total, want)
+		}
+	}
+}
+
+// TestSolveMaxSubgraphOps checks no subgraph exceeds the problem's
+// max_subgraph_ops, and that EvaluateSolution rejects one that does
+func TestSolveMaxSubgraphOps(t *testing.T) {
+	defer func(w io.Writer) { progress = w }(progress)
+	progress = io.Discard
+
+	for _, tc := range []struct {
+		name  string
+		limit int
+	}{
+		{"mlsys-2026-5", 3},
+		{"mlsys-2026-5", 1},
+		{"mlsys-2026-13", 3},
+	} {
+		p, err := ReadProblem(filepath.Join("..", "benchmarks", tc.name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		unlimited, err := SolveOptimized(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p.MaxSubgraphOps = tc.limit
+		sol, err := SolveOptimized(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, sg := range sol.Subgraphs {
+			if len(sg.Ops) > tc.limit {
+				t.Errorf("%s limit %d: subgraph %d has %d ops", tc.name, tc.limit, i, len(sg.Ops))
+			}
+		}
+		if _, err := EvaluateSolution(p, sol); err != nil {
+			t.Errorf("%s limit %d: %v", tc.name, tc.limit, err)
+		}
+
+		// The unlimited solution fuses past the limit somewhere
+		if _, err := EvaluateSolution(p, unlimited); err == nil || !strings.Contains(err.Error(), "ops, limit is") {
+			t.Errorf("%s limit %d: unlimited solution gave error %v, want a limit error", tc.name, tc.limit, err)
+		}
+	}
+}
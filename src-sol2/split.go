@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// gridTiles returns the number of spatial tiles ops run at gran, or 0 when
+// the granularity is invalid
+func gridTiles(p *Problem, ops []int, gran [3]int) int {
+	if len(ops) == 0 || gran[0] <= 0 || gran[1] <= 0 {
+		return 0
+	}
+	outT := GetOutputShape(p, ops)
+	return CeilDiv(outT.Width, gran[0]) * CeilDiv(outT.Height, gran[1])
+}
+
+// isPartialGrid reports whether order names a proper, non-empty subset of
+// the nSpatial tiles, each at most once
+func isPartialGrid(order []int, nSpatial int) bool {
+	if len(order) == 0 || len(order) >= nSpatial {
+		return false
+	}
+	seen := make(map[int]bool, len(order))
+	for _, tileIdx := range order {
+		if tileIdx < 0 || tileIdx >= nSpatial || seen[tileIdx] {
+			return false
+		}
+		seen[tileIdx] = true
+	}
+	return true
+}
+
+// SplitSpatial splits sg into up to nParts subgraphs over the same ops, each
+// running a contiguous range of sg's traversal order. Spatial tiles are
+// independent, so the parts can be scheduled as separate units.
+//
+// resident is the residency sg starts with. Every part but the last keeps it
+// resident for the next part. The last part keeps only those of sg's
+// retained tensors that were already resident: sg's own outputs are spread
+// over all parts and are never whole in fast memory, so they are stored.
+func SplitSpatial(p *Problem, sg Subgraph, resident map[int]bool, nParts int) []Subgraph {
+	nSpatial := gridTiles(p, sg.Ops, sg.Granularity)
+	if nParts > nSpatial {
+		nParts = nSpatial
+	}
+	if nParts <= 1 || isPartialGrid(sg.TraversalOrder, nSpatial) {
+		return []Subgraph{sg}
+	}
+
+	order := sg.TraversalOrder
+	if len(order) != nSpatial {
+		order = make([]int, nSpatial)
+		for i := range order {
+			order[i] = i
+		}
+	}
+
+	carried := sortedKeys(resident)
+	var lastRetain []int
+	for _, tIdx := range sg.TensorsToRetain {
+		if resident[tIdx] {
+			lastRetain = append(lastRetain, tIdx)
+		}
+	}
+
+	parts := make([]Subgraph, nParts)
+	for i := range parts {
+		begin, end := i*nSpatial/nParts, (i+1)*nSpatial/nParts
+		part := sg
+		part.TraversalOrder = append([]int{}, order[begin:end]...)
+		part.TensorsToRetain, part.TensorsToDrop = carried, nil
+		if i == nParts-1 {
+			part.TensorsToRetain, part.TensorsToDrop = lastRetain, sg.TensorsToDrop
+		}
+		part.SubgraphLatency = 0
+		parts[i] = part
+	}
+	return parts
+}
+
+// splitSolutionSpatial applies SplitSpatial to every subgraph of sol and
+// re-evaluates the latency of each part under its own residency
+func splitSolutionSpatial(p *Problem, sol *Solution, nParts int) {
+	var subgraphs []Subgraph
+	resident := make(map[int]bool)
+
+	for i, sg := range sol.Subgraphs {
+		parts := []Subgraph{sg}
+		if !isZeroSized(GetOutputShape(p, sg.Ops)) {
+			parts = SplitSpatial(p, sg, resident, nParts)
+		}
+		for _, part := range parts {
+			if len(parts) > 1 {
+				lat, err := EvaluateSubgraphDataflow(p, part.Ops, part.Granularity, part.TensorsToRetain, part.TraversalOrder, resident, part.Dataflow)
+				if err == nil {
+					part.SubgraphLatency = lat
+				}
+			}
+			subgraphs = append(subgraphs, part)
+			rest := append([]Subgraph{part}, sol.Subgraphs[i+1:]...)
+			resident = residentAfter(p, rest, 0, resident)
+		}
+	}
+
+	sol.Subgraphs = subgraphs
+}
+
+// checkTileCoverage returns an error if subgraphs that each run part of a
+// grid do not run all of its tiles between them. Parts belong together when
+// they have the same ops and granularity; an op also run by a full-grid
+// subgraph is covered regardless.
+func checkTileCoverage(p *Problem, sol *Solution) error {
+	type grid struct {
+		ops   []int
+		total int
+		tiles map[int]bool
+	}
+	grids := make(map[string]*grid)
+	fullOps := make(map[int]bool)
+
+	for _, sg := range sol.Subgraphs {
+		nSpatial := gridTiles(p.withPrimaryOutput(sg.PrimaryOutput), sg.Ops, sg.Granularity)
+		if !isPartialGrid(sg.TraversalOrder, nSpatial) {
+			for _, opIdx := range sg.Ops {
+				fullOps[opIdx] = true
+			}
+			continue
+		}
+		key := fmt.Sprint(sg.Ops, sg.Granularity, GetOutputTensor(p.withPrimaryOutput(sg.PrimaryOutput), sg.Ops))
+		g := grids[key]
+		if g == nil {
+			g = &grid{ops: sg.Ops, total: nSpatial, tiles: make(map[int]bool)}
+			grids[key] = g
+		}
+		for _, tileIdx := range sg.TraversalOrder {
+			g.tiles[tileIdx] = true
+		}
+	}
+
+	keys := make([]string, 0, len(grids))
+	for key := range grids {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		g := grids[key]
+		if len(g.tiles) == g.total {
+			continue
+		}
+		for _, opIdx := range g.ops {
+			if !fullOps[opIdx] {
+				return fmt.Errorf("split subgraphs of ops %v run %d of %d tiles", g.ops, len(g.tiles), g.total)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// SyntheticPattern is the shape of graph GenerateSyntheticProblem builds
+type SyntheticPattern int
+
+const (
+	// SyntheticChain is a linear chain of MatMuls, each with its own weight
+	SyntheticChain SyntheticPattern = iota
+	// SyntheticTransformer repeats a transformer block: Q/K/V projections,
+	// attention through a transposed K, an output projection, a residual
+	// add and a two-layer MLP with its own residual add
+	SyntheticTransformer
+	// SyntheticRandom is a random DAG of MatMuls and pointwise ops
+	SyntheticRandom
+)
+
+// String returns the flag spelling of the pattern
+func (s SyntheticPattern) String() string {
+	switch s {
+	case SyntheticChain:
+		return "chain"
+	case SyntheticTransformer:
+		return "transformer"
+	case SyntheticRandom:
+		return "random"
+	}
+	return fmt.Sprintf("SyntheticPattern(%d)", int(s))
+}
+
+// ParseSyntheticPattern parses the flag spelling of a pattern
+func ParseSyntheticPattern(s string) (SyntheticPattern, error) {
+	for _, pat := range []SyntheticPattern{SyntheticChain, SyntheticTransformer, SyntheticRandom} {
+		if s == pat.String() {
+			return pat, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown pattern %q (want chain, transformer or random)", s)
+}
+
+// SyntheticConfig describes a generated problem
+type SyntheticConfig struct {
+	Pattern SyntheticPattern
+	// Size is the chain length, the number of transformer blocks, or the
+	// number of ops of a random DAG
+	Size int
+	// Dim is the side of chain tensors and the hidden size of transformer
+	// blocks; SeqLen is the transformer sequence length
+	Dim    int
+	SeqLen int
+	// FanOut caps how many ops of a random DAG read one tensor, and Sizes
+	// are the tensor sides it draws from uniformly
+	FanOut int
+	Sizes  []int
+
+	NativeGranularity   [2]int
+	FastMemoryCapacity  int64
+	SlowMemoryBandwidth int64
+	// MatMulCost is the base cost of a MatMul per native width of K;
+	// PointwiseCost is the base cost of a pointwise op
+	MatMulCost    int64
+	PointwiseCost int64
+}
+
+// DefaultSyntheticConfig returns a config resembling the benchmarks
+func DefaultSyntheticConfig() SyntheticConfig {
+	return SyntheticConfig{
+		Pattern:             SyntheticChain,
+		Size:                8,
+		Dim:                 512,
+		SeqLen:              512,
+		FanOut:              2,
+		Sizes:               []int{128, 256, 512},
+		NativeGranularity:   [2]int{128, 128},
+		FastMemoryCapacity:  600000,
+		SlowMemoryBandwidth: 50,
+		MatMulCost:          500,
+		PointwiseCost:       500,
+	}
+}
+
+// syntheticBuilder accumulates the tensors and ops of a generated problem
+type syntheticBuilder struct {
+	cfg SyntheticConfig
+	p   *Problem
+}
+
+func (b *syntheticBuilder) tensor(w, h int) int {
+	b.p.Tensors = append(b.p.Tensors, Tensor{Width: w, Height: h})
+	return len(b.p.Tensors) - 1
+}
+
+// matMul adds lhs x rhs and returns its output tensor
+func (b *syntheticBuilder) matMul(lhs, rhs int) int {
+	k := b.p.Tensors[lhs].Width
+	out := b.tensor(b.p.Tensors[rhs].Width, b.p.Tensors[lhs].Height)
+	cost := MaxInt64(1, b.cfg.MatMulCost*int64(k)/int64(b.cfg.NativeGranularity[0]))
+	b.p.Ops = append(b.p.Ops, Op{OpType: "MatMul", Inputs: []int{lhs, rhs}, Outputs: []int{out}, BaseCost: cost})
+	return out
+}
+
+// pointwise adds an op over inputs, which share the first input's shape
+func (b *syntheticBuilder) pointwise(inputs ...int) int {
+	t := b.p.Tensors[inputs[0]]
+	out := b.tensor(t.Width, t.Height)
+	b.p.Ops = append(b.p.Ops, Op{OpType: "Pointwise", Inputs: inputs, Outputs: []int{out}, BaseCost: b.cfg.PointwiseCost})
+	return out
+}
+
+func (b *syntheticBuilder) transpose(in int) int {
+	t := b.p.Tensors[in]
+	out := b.tensor(t.Height, t.Width)
+	b.p.Ops = append(b.p.Ops, Op{OpType: "Transpose", Inputs: []int{in}, Outputs: []int{out}})
+	return out
+}
+
+// GenerateSyntheticProblem builds a problem of the pattern and size cfg
+// describes, for scaling experiments. Equal configs give identical problems;
+// random DAGs also depend on Config.Seed.
+func GenerateSyntheticProblem(cfg SyntheticConfig) (*Problem, error) {
+	if cfg.Size < 1 {
+		return nil, fmt.Errorf("size must be positive, got %d", cfg.Size)
+	}
+	if cfg.NativeGranularity[0] < 1 || cfg.NativeGranularity[1] < 1 {
+		return nil, fmt.Errorf("native granularity must be positive, got %v", cfg.NativeGranularity)
+	}
+
+	b := &syntheticBuilder{cfg: cfg, p: &Problem{
+		FastMemoryCapacity:  cfg.FastMemoryCapacity,
+		SlowMemoryBandwidth: cfg.SlowMemoryBandwidth,
+		StoreBandwidth:      cfg.SlowMemoryBandwidth,
+		NativeGranularity:   cfg.NativeGranularity,
+	}}
+
+	switch cfg.Pattern {
+	case SyntheticChain:
+		if cfg.Dim < 1 {
+			return nil, fmt.Errorf("dim must be positive, got %d", cfg.Dim)
+		}
+		x := b.tensor(cfg.Dim, cfg.Dim)
+		for i := 0; i < cfg.Size; i++ {
+			x = b.matMul(x, b.tensor(cfg.Dim, cfg.Dim))
+		}
+	case SyntheticTransformer:
+		if cfg.Dim < 1 || cfg.SeqLen < 1 {
+			return nil, fmt.Errorf("dim and sequence length must be positive, got %d and %d", cfg.Dim, cfg.SeqLen)
+		}
+		x := b.tensor(cfg.Dim, cfg.SeqLen)
+		for i := 0; i < cfg.Size; i++ {
+			x = b.transformerBlock(x)
+		}
+	case SyntheticRandom:
+		if cfg.FanOut < 1 || len(cfg.Sizes) == 0 {
+			return nil, fmt.Errorf("random DAGs need a positive fan-out and at least one size")
+		}
+		for _, s := range cfg.Sizes {
+			if s < 1 {
+				return nil, fmt.Errorf("sizes must be positive, got %d", s)
+			}
+		}
+		b.randomDAG(NewRand(b.p))
+	default:
+		return nil, fmt.Errorf("unknown pattern %v", cfg.Pattern)
+	}
+
+	for i, t := range b.p.Tensors {
+		if err := checkTensorSize(t); err != nil {
+			return nil, fmt.Errorf("tensor %d: %w", i, err)
+		}
+	}
+	b.p.indexGraphOutputs()
+	return b.p, nil
+}
+
+// transformerBlock adds one block over x, which is hidden size wide and
+// sequence length high, and returns the block's output of the same shape
+func (b *syntheticBuilder) transformerBlock(x int) int {
+	d := b.cfg.Dim
+
+	q := b.matMul(x, b.tensor(d, d))
+	k := b.matMul(x, b.tensor(d, d))
+	v := b.matMul(x, b.tensor(d, d))
+	scores := b.matMul(q, b.transpose(k))
+	probs := b.pointwise(scores)
+	attn := b.matMul(probs, v)
+	h := b.pointwise(x, b.matMul(attn, b.tensor(d, d)))
+
+	hidden := b.pointwise(b.matMul(h, b.tensor(4*d, d)))
+	return b.pointwise(h, b.matMul(hidden, b.tensor(d, 4*d)))
+}
+
+// randomDAG adds cfg.Size ops. Each reads tensors already in the graph that
+// fewer than FanOut ops read yet, or fresh graph inputs when none fit:
+// MatMuls multiply by a weight of a random width, pointwise ops combine
+// one or two tensors of equal shape.
+func (b *syntheticBuilder) randomDAG(rng *rand.Rand) {
+	size := func() int { return b.cfg.Sizes[rng.Intn(len(b.cfg.Sizes))] }
+	readers := make(map[int]int)
+	var open []int
+
+	// pick returns an open tensor other than except, of shape w x h unless
+	// w is zero
+	pick := func(w, h, except int) int {
+		var fits []int
+		for _, t := range open {
+			if t == except {
+				continue
+			}
+			if w <= 0 || (b.p.Tensors[t].Width == w && b.p.Tensors[t].Height == h) {
+				fits = append(fits, t)
+			}
+		}
+		if len(fits) == 0 {
+			if w <= 0 {
+				w, h = size(), size()
+			}
+			return b.tensor(w, h)
+		}
+		return fits[rng.Intn(len(fits))]
+	}
+	read := func(tensors ...int) {
+		for _, t := range tensors {
+			readers[t]++
+		}
+		kept := open[:0]
+		for _, t := range open {
+			if readers[t] < b.cfg.FanOut {
+				kept = append(kept, t)
+			}
+		}
+		open = kept
+	}
+
+	for i := 0; i < b.cfg.Size; i++ {
+		var out int
+		if rng.Intn(2) == 0 {
+			lhs := pick(0, 0, -1)
+			read(lhs)
+			out = b.matMul(lhs, b.tensor(size(), b.p.Tensors[lhs].Width))
+		} else {
+			in := pick(0, 0, -1)
+			read(in)
+			inputs := []int{in}
+			if rng.Intn(2) == 0 {
+				other := pick(b.p.Tensors[in].Width, b.p.Tensors[in].Height, in)
+				read(other)
+				inputs = append(inputs, other)
+			}
+			out = b.pointwise(inputs...)
+		}
+		open = append(open, out)
+	}
+}
@@ -1,9 +1,19 @@
 package main
 
+import "fmt"
+
 // Tensor represents a 2D matrix in the computation graph.
 type Tensor struct {
 	Width  int
 	Height int
+
+	// CompressionRatio is how many times less fast memory the tensor takes
+	// while retained compressed, under Config.RetainCompressed. Zero or one
+	// means it does not compress.
+	CompressionRatio float64
+	// DecompressCost is the compute time, per element, of decompressing a
+	// tile of the compressed tensor each time a step reads one
+	DecompressCost float64
 }
 
 // Op represents one operation in the DAG.
@@ -21,6 +31,82 @@ type Problem struct {
 	FastMemoryCapacity  int64
 	SlowMemoryBandwidth int64
 	NativeGranularity   [2]int
+
+	// StoreBandwidth is the bandwidth for evicting outputs to slow memory.
+	// Zero means stores run at SlowMemoryBandwidth, like loads.
+	StoreBandwidth int64
+
+	// PinnedTensors stay whole in fast memory for the entire schedule. They
+	// take capacity in every subgraph and are never loaded or evicted.
+	PinnedTensors []int
+
+	// MaxSubgraphOps caps the number of ops in one subgraph. Zero means
+	// no limit.
+	MaxSubgraphOps int
+
+	// Unfusable lists ops that must run alone, each in a subgraph of its
+	// own, such as ops with side effects.
+	Unfusable []int
+
+	// OutputTensors are the tensors the graph must produce. When empty,
+	// every op is needed; otherwise ops that feed none of them are dead.
+	OutputTensors []int
+
+	// Alignment is the block size fast memory allocates in: every tile and
+	// tensor occupies its size rounded up to a multiple of it. Zero or one
+	// means exact sizes.
+	Alignment int64
+
+	// CapacitySchedule overrides FastMemoryCapacity for the subgraph at
+	// each position of the schedule, as when part of fast memory is
+	// reserved for other work. Zero entries and positions past its end
+	// use FastMemoryCapacity.
+	CapacitySchedule []int64
+
+	// graphOutputs marks the tensors isGraphOutput reports, indexed once
+	// by indexGraphOutputs when the problem is built
+	graphOutputs []bool
+
+	// primaryOutput is set on a withPrimaryOutput view to the tensor that
+	// drives the subgraph's spatial grid
+	primaryOutput *int
+}
+
+// CapacityAt returns the fast memory capacity of the subgraph at position i
+func (p *Problem) CapacityAt(i int) int64 {
+	if i >= 0 && i < len(p.CapacitySchedule) && p.CapacitySchedule[i] > 0 {
+		return p.CapacitySchedule[i]
+	}
+	return p.FastMemoryCapacity
+}
+
+// atSubgraph returns p as seen by the subgraph at position i: p itself when
+// that position has the global capacity, otherwise a copy whose
+// FastMemoryCapacity is the position's. Granularity search and working set
+// checks on the copy honor the position's capacity. The copy is not for
+// TryFuseOps, whose cache is keyed by problem.
+func (p *Problem) atSubgraph(i int) *Problem {
+	c := p.CapacityAt(i)
+	if c == p.FastMemoryCapacity {
+		return p
+	}
+	view := *p
+	view.FastMemoryCapacity = c
+	return &view
+}
+
+// withPrimaryOutput returns p as seen by a subgraph whose grid is driven by
+// tensor *t: p itself when t is nil, otherwise a copy on which
+// GetOutputTensor returns *t for any ops producing it. Granularity search
+// and evaluation on the copy tile that tensor. Like atSubgraph's copy, it
+// is not for TryFuseOps.
+func (p *Problem) withPrimaryOutput(t *int) *Problem {
+	if t == nil {
+		return p
+	}
+	view := *p
+	view.primaryOutput = t
+	return &view
 }
 
 // Subgraph is one step in our execution schedule.
@@ -30,6 +116,49 @@ type Subgraph struct {
 	TensorsToRetain []int
 	TraversalOrder  []int
 	SubgraphLatency float64
+	Dataflow        Dataflow
+
+	// TensorsToDrop are tensors resident before the subgraph that it evicts
+	// when it finishes although a later subgraph reads them. Without a drop such a tensor
+	// stays resident until its next reader; see residentAfter.
+	TensorsToDrop []int
+
+	// PrimaryOutput, when set, is the tensor whose shape drives the spatial
+	// grid in place of the one GetOutputTensor picks. The reference
+	// evaluator always takes the last op's first output, so the solver
+	// leaves it nil.
+	PrimaryOutput *int
+}
+
+// Dataflow is the loop order a subgraph runs its steps in.
+type Dataflow int
+
+const (
+	// OutputStationary finishes every k-step of an output tile before
+	// moving to the next tile.
+	OutputStationary Dataflow = iota
+	// InputStationary sweeps all output tiles once per k-step and spills
+	// partial sums between sweeps.
+	InputStationary
+)
+
+// String returns the solution-file spelling of the dataflow.
+func (d Dataflow) String() string {
+	if d == InputStationary {
+		return "input_stationary"
+	}
+	return "output_stationary"
+}
+
+// ParseDataflow parses the solution-file spelling of a dataflow.
+func ParseDataflow(s string) (Dataflow, error) {
+	switch s {
+	case "", "output_stationary":
+		return OutputStationary, nil
+	case "input_stationary":
+		return InputStationary, nil
+	}
+	return OutputStationary, fmt.Errorf("unknown dataflow %q", s)
 }
 
 // Solution is the full output.
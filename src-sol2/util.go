@@ -1,7 +1,21 @@
 package main
 
+import "math"
+
+// CeilDiv returns ceil(a / b), rounding toward positive infinity for any
+// sign of a. A non-positive b, such as a zero granularity dimension from a
+// malformed input, gives 0 instead of panicking; callers that must reject
+// such input check it themselves.
+// Example: CeilDiv(512, 128) = 4, CeilDiv(513, 128) = 5, CeilDiv(0, 128) = 0
 func CeilDiv(a, b int) int {
-	return (a + b - 1) / b
+	if b <= 0 {
+		return 0
+	}
+	q := a / b
+	if a%b > 0 {
+		q++
+	}
+	return q
 }
 
 func MaxInt(a, b int) int {
@@ -32,6 +46,13 @@ func MaxInt64(a, b int64) int64 {
 	return b
 }
 
+func MinInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func MinFloat(a, b float64) float64 {
 	if a < b {
 		return a
@@ -39,6 +60,16 @@ func MinFloat(a, b float64) float64 {
 	return b
 }
 
+// FloatEqual reports whether a and b differ by at most absTol, or by at
+// most relTol times the larger magnitude, whichever allows more
+func FloatEqual(a, b, relTol, absTol float64) bool {
+	if a == b {
+		return true
+	}
+	diff := math.Abs(a - b)
+	return diff <= absTol || diff <= relTol*math.Max(math.Abs(a), math.Abs(b))
+}
+
 func AbsInt(a int) int {
 	if a < 0 {
 		return -a
@@ -67,7 +98,8 @@ func uniqueInts(s []int) []int {
 	return result
 }
 
-// divisorsOf returns all divisors of n that are >= minVal, sorted ascending
+// divisorsOf returns all divisors of n that are >= minVal, sorted ascending.
+// A non-positive n has none.
 func divisorsOf(n, minVal int) []int {
 	var divs []int
 	for i := 1; i*i <= n; i++ {
@@ -92,12 +124,14 @@ func divisorsOf(n, minVal int) []int {
 	return divs
 }
 
-// powersOf2UpTo returns powers of 2 from minVal up to maxVal
+// powersOf2UpTo returns minVal doubled repeatedly up to maxVal. A
+// non-positive minVal starts at 1, since doubling it would never pass maxVal.
 func powersOf2UpTo(maxVal, minVal int) []int {
 	var result []int
-	for v := minVal; v <= maxVal; v *= 2 {
-		if v > 0 {
-			result = append(result, v)
+	for v := MaxInt(minVal, 1); v <= maxVal; v *= 2 {
+		result = append(result, v)
+		if v > maxVal/2 {
+			break // doubling again would pass maxVal, or overflow
 		}
 	}
 	return result
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCeilDiv(t *testing.T) {
+	for _, tc := range []struct{ a, b, want int }{
+		{512, 128, 4},
+		{513, 128, 5},
+		{0, 5, 0},
+		{1, 1, 1},
+		// A non-positive divisor has no tiles
+		{7, 0, 0},
+		{7, -3, 0},
+		// Negative dividends round toward positive infinity
+		{-3, 2, -1},
+		{-4, 2, -2},
+		{-1, 4, 0},
+		// a+b-1 would overflow
+		{math.MaxInt - 1, math.MaxInt, 1},
+		{math.MaxInt, 2, math.MaxInt/2 + 1},
+	} {
+		if got := CeilDiv(tc.a, tc.b); got != tc.want {
+			t.Errorf("CeilDiv(%d, %d) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestMinMaxIntNegative(t *testing.T) {
+	if got := MaxInt(-1, -2); got != -1 {
+		t.Errorf("MaxInt(-1, -2) = %d, want -1", got)
+	}
+	if got := MinInt(-1, -2); got != -2 {
+		t.Errorf("MinInt(-1, -2) = %d, want -2", got)
+	}
+	if got := MaxInt64(-1, -2); got != -1 {
+		t.Errorf("MaxInt64(-1, -2) = %d, want -1", got)
+	}
+}
+
+func TestDivisorsOf(t *testing.T) {
+	for _, tc := range []struct {
+		n, minVal int
+		want      []int
+	}{
+		{0, 1, nil},
+		{-12, 1, nil},
+		{1, 1, []int{1}},
+		{12, 3, []int{3, 4, 6, 12}},
+		{16, 1, []int{1, 2, 4, 8, 16}},
+	} {
+		if got := divisorsOf(tc.n, tc.minVal); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("divisorsOf(%d, %d) = %v, want %v", tc.n, tc.minVal, got, tc.want)
+		}
+	}
+}
+
+func TestPowersOf2UpTo(t *testing.T) {
+	for _, tc := range []struct {
+		maxVal, minVal int
+		want           []int
+	}{
+		{64, 8, []int{8, 16, 32, 64}},
+		// A non-positive minVal starts at 1 instead of doubling 0 forever
+		{5, 0, []int{1, 2, 4}},
+		{5, -4, []int{1, 2, 4}},
+		{0, 1, nil},
+		{4, 8, nil},
+	} {
+		if got := powersOf2UpTo(tc.maxVal, tc.minVal); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("powersOf2UpTo(%d, %d) = %v, want %v", tc.maxVal, tc.minVal, got, tc.want)
+		}
+	}
+
+	// Doubling stops before it would overflow
+	got := powersOf2UpTo(math.MaxInt, 1)
+	if n := len(got); n != 63 || got[n-1] != 1<<62 {
+		t.Errorf("powersOf2UpTo(MaxInt, 1) has %d powers up to %d, want 63 up to 1<<62", n, got[len(got)-1])
+	}
+}
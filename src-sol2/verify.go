@@ -0,0 +1,32 @@
+package main
+
+// LatencyMismatch is a subgraph whose stored SubgraphLatency disagrees with
+// a fresh evaluation of it
+type LatencyMismatch struct {
+	Subgraph  int
+	Stored    float64
+	Evaluated float64
+	// Err is why the subgraph could not be evaluated, if it could not
+	Err error
+}
+
+// VerifyLatencies evaluates every subgraph of sol again, under the
+// residency the earlier subgraphs' retention gives it, and returns those
+// whose stored latency differs from the result beyond the solver's latency
+// tolerance. Stored latencies are compared after the rounding
+// WriteSolution applies. Zero-sized subgraphs, which EvaluateSolution
+// skips, are skipped here too.
+func VerifyLatencies(p *Problem, sol *Solution) []LatencyMismatch {
+	var mismatches []LatencyMismatch
+	resident := make(map[int]bool)
+	for i, sg := range sol.Subgraphs {
+		if len(sg.Ops) == 0 || !isZeroSized(GetOutputShape(p, sg.Ops)) {
+			lat, err := EvaluateSubgraphDataflow(p.atSubgraph(i).withPrimaryOutput(sg.PrimaryOutput), sg.Ops, sg.Granularity, sg.TensorsToRetain, sg.TraversalOrder, resident, sg.Dataflow)
+			if err != nil || !latencyTie(roundLatency(sg.SubgraphLatency), roundLatency(lat)) {
+				mismatches = append(mismatches, LatencyMismatch{Subgraph: i, Stored: sg.SubgraphLatency, Evaluated: lat, Err: err})
+			}
+		}
+		resident = residentAfter(p, sol.Subgraphs, i, resident)
+	}
+	return mismatches
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+// TestVerifyLatencies checks a solved schedule verifies clean, and that a
+// stored latency altered afterwards is reported against a fresh evaluation.
+func TestVerifyLatencies(t *testing.T) {
+	p := chainProblem(4)
+	sol, err := SolveOptimized(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches := VerifyLatencies(p, sol); len(mismatches) != 0 {
+		t.Fatalf("solved schedule: %+v", mismatches)
+	}
+
+	last := len(sol.Subgraphs) - 1
+	stored := sol.Subgraphs[last].SubgraphLatency
+	sol.Subgraphs[last].SubgraphLatency = stored * 2
+	mismatches := VerifyLatencies(p, sol)
+	if len(mismatches) != 1 {
+		t.Fatalf("got %d mismatches, want 1: %+v", len(mismatches), mismatches)
+	}
+	if m := mismatches[0]; m.Subgraph != last || m.Stored != stored*2 || m.Evaluated != stored || m.Err != nil {
+		t.Errorf("mismatch = %+v, want subgraph %d stored %.1f evaluated %.1f", m, last, stored*2, stored)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+// residentInputProblem is a pointwise op reading tensor 0, with tensor 0
+// and the unrelated tensor 2 retained from the previous subgraph. src-sol1
+// and src-sol2 test the same case, so the three working sets can be
+// compared side by side.
+func residentInputProblem() (*Problem, *Subgraph, map[int]bool) {
+	p := &Problem{
+		Tensors:            []Tensor{{Width: 128, Height: 128}, {Width: 128, Height: 128}, {Width: 64, Height: 64}},
+		Ops:                []Op{{OpType: "Pointwise", Inputs: []int{0}, Outputs: []int{1}, BaseCost: 10}},
+		FastMemoryCapacity: 1 << 20,
+		NativeGranularity:  [2]int{128, 128},
+	}
+	sg := &Subgraph{Ops: []int{0}, Granularity: [3]int{32, 32, 1}}
+	return p, sg, map[int]bool{0: true, 2: true}
+}
+
+// TestComputeWorkingSetResidentInput pins the reference semantics: a
+// resident input counts as one input tile, an unrelated resident tensor at
+// full size. The solvers count the resident input whole (21504 for this
+// case) and so never accept a subgraph the reference rejects.
+func TestComputeWorkingSetResidentInput(t *testing.T) {
+	p, sg, resident := residentInputProblem()
+	if got, want := ComputeWorkingSet(p, sg, resident), int64(32*32+32*32+64*64); got != want {
+		t.Errorf("ComputeWorkingSet = %d, want %d", got, want)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
@@ -36,9 +39,37 @@ func renderDotToPNG(dotFile, pngFile string) error {
 	return nil
 }
 
-// VisualizeProblem generates a Graphviz DOT file and renders it as PNG.
-func VisualizeProblem(p *Problem, dotFile, pngFile string) error {
-	// Identify graph inputs and outputs
+// RenderError reports that a DOT file was written but Graphviz could not
+// render it as PNG. Batch callers can note it and carry on, since the DOT
+// file is still usable.
+type RenderError struct {
+	DotFile string
+	PNGFile string
+	Err     error
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("rendering %s from %s: %v", e.PNGFile, e.DotFile, e.Err)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// renderOrReport renders dotFile as pngFile, printing how to view the DOT
+// file instead if that fails. Failures come back as a *RenderError.
+func renderOrReport(dotFile, pngFile string) error {
+	if err := renderDotToPNG(dotFile, pngFile); err != nil {
+		fmt.Printf("   ⚠ Could not render PNG: %v\n", err)
+		fmt.Printf("   → You can view the DOT file at: https://dreampuf.github.io/GraphvizOnline/\n")
+		fmt.Printf("   → Or manually convert: dot -Tpng %s -o %s\n", dotFile, pngFile)
+		return &RenderError{DotFile: dotFile, PNGFile: pngFile, Err: err}
+	}
+	return nil
+}
+
+// graphEndpoints returns the tensors no op produces and the tensors no op consumes
+func graphEndpoints(p *Problem) (graphInputs, graphOutputs map[int]bool) {
 	producedBy := make(map[int]int)
 	consumedBy := make(map[int][]int)
 
@@ -51,8 +82,8 @@ func VisualizeProblem(p *Problem, dotFile, pngFile string) error {
 		}
 	}
 
-	graphInputs := make(map[int]bool)
-	graphOutputs := make(map[int]bool)
+	graphInputs = make(map[int]bool)
+	graphOutputs = make(map[int]bool)
 
 	for i := range p.Tensors {
 		if _, produced := producedBy[i]; !produced {
@@ -63,7 +94,13 @@ func VisualizeProblem(p *Problem, dotFile, pngFile string) error {
 		}
 	}
 
-	// Build DOT content
+	return graphInputs, graphOutputs
+}
+
+// GenerateProblemDOT returns the Graphviz DOT text for the problem DAG
+func GenerateProblemDOT(p *Problem) string {
+	graphInputs, graphOutputs := graphEndpoints(p)
+
 	var sb strings.Builder
 	sb.WriteString("digraph DAG {\n")
 	sb.WriteString("  rankdir=TB;\n")
@@ -124,50 +161,39 @@ func VisualizeProblem(p *Problem, dotFile, pngFile string) error {
 
 	sb.WriteString("}\n")
 
-	// Write DOT file
-	if err := os.WriteFile(dotFile, []byte(sb.String()), 0644); err != nil {
+	return sb.String()
+}
+
+// writeDOTFile writes DOT text to dotFile
+func writeDOTFile(dotFile, dot string) error {
+	if err := os.WriteFile(dotFile, []byte(dot), 0644); err != nil {
 		return fmt.Errorf("writing DOT file: %w", err)
 	}
-
 	fmt.Printf("   ✓ Created DOT file: %s\n", dotFile)
-
-	// Render to PNG
-	if err := renderDotToPNG(dotFile, pngFile); err != nil {
-		fmt.Printf("   ⚠ Could not render PNG: %v\n", err)
-		fmt.Printf("   → You can view the DOT file at: https://dreampuf.github.io/GraphvizOnline/\n")
-		fmt.Printf("   → Or manually convert: dot -Tpng %s -o %s\n", dotFile, pngFile)
-		return err
-	}
-
 	return nil
 }
 
-// VisualizeSolution shows the execution schedule with subgraph boundaries.
-func VisualizeSolution(p *Problem, sol *Solution, dotFile, pngFile string) error {
-	// Identify graph inputs and outputs
-	producedBy := make(map[int]int)
-	consumedBy := make(map[int][]int)
+// WriteDOT writes the problem DAG as a DOT file. It never runs Graphviz, so
+// it works on machines without the dot binary.
+func WriteDOT(p *Problem, dotFile string) error {
+	return writeDOTFile(dotFile, GenerateProblemDOT(p))
+}
 
-	for i, op := range p.Ops {
-		for _, t := range op.Outputs {
-			producedBy[t] = i
-		}
-		for _, t := range op.Inputs {
-			consumedBy[t] = append(consumedBy[t], i)
-		}
+// VisualizeProblem generates a Graphviz DOT file and renders it as PNG. If
+// only rendering fails the DOT file is kept and the error is a *RenderError.
+func VisualizeProblem(p *Problem, dotFile, pngFile string) error {
+	if err := WriteDOT(p, dotFile); err != nil {
+		return err
 	}
+	return renderOrReport(dotFile, pngFile)
+}
 
-	graphInputs := make(map[int]bool)
-	graphOutputs := make(map[int]bool)
-
-	for i := range p.Tensors {
-		if _, produced := producedBy[i]; !produced {
-			graphInputs[i] = true
-		}
-		if len(consumedBy[i]) == 0 {
-			graphOutputs[i] = true
-		}
-	}
+// GenerateSolutionDOT returns the Graphviz DOT text for a solution, with
+// each subgraph drawn as a cluster and retained tensors highlighted.
+// Clusters are shaded from green to red by SubgraphLatency and labeled with
+// their share of the total.
+func GenerateSolutionDOT(p *Problem, sol *Solution) string {
+	graphInputs, graphOutputs := graphEndpoints(p)
 
 	// Map ops to subgraphs
 	opToSubgraph := make(map[int]int)
@@ -200,13 +226,19 @@ func VisualizeSolution(p *Problem, sol *Solution, dotFile, pngFile string) error
 
 	sb.WriteString("\n")
 
-	// Draw subgraphs as clusters
+	// Draw subgraphs as clusters, shaded by latency
+	minLat, maxLat, totalLat := latencyRange(sol)
 	for sgIdx, sg := range sol.Subgraphs {
+		share := 0.0
+		if totalLat > 0 {
+			share = 100 * sg.SubgraphLatency / totalLat
+		}
 		sb.WriteString(fmt.Sprintf("  subgraph cluster_%d {\n", sgIdx))
-		sb.WriteString(fmt.Sprintf("    label=\"Subgraph %d\\nGran=[%d,%d,%d]\\nLatency=%.1f\";\n",
-			sgIdx, sg.Granularity[0], sg.Granularity[1], sg.Granularity[2], sg.SubgraphLatency))
+		sb.WriteString(fmt.Sprintf("    label=\"Subgraph %d\\nGran=[%d,%d,%d]\\nLatency=%.1f (%.1f%%)\";\n",
+			sgIdx, sg.Granularity[0], sg.Granularity[1], sg.Granularity[2], sg.SubgraphLatency, share))
 		sb.WriteString("    style=filled;\n")
 		sb.WriteString("    color=lightgrey;\n")
+		sb.WriteString(fmt.Sprintf("    fillcolor=\"%s\";\n", latencyHeatColor(sg.SubgraphLatency, minLat, maxLat)))
 		sb.WriteString("    node [style=filled, fillcolor=lightyellow];\n\n")
 
 		for _, opIdx := range sg.Ops {
@@ -254,25 +286,54 @@ func VisualizeSolution(p *Problem, sol *Solution, dotFile, pngFile string) error
 
 	sb.WriteString("}\n")
 
-	// Write DOT file
-	if err := os.WriteFile(dotFile, []byte(sb.String()), 0644); err != nil {
-		return fmt.Errorf("writing DOT file: %w", err)
+	return sb.String()
+}
+
+// latencyRange returns the smallest, largest and total SubgraphLatency of sol
+func latencyRange(sol *Solution) (min, max, total float64) {
+	for i, sg := range sol.Subgraphs {
+		if i == 0 || sg.SubgraphLatency < min {
+			min = sg.SubgraphLatency
+		}
+		if i == 0 || sg.SubgraphLatency > max {
+			max = sg.SubgraphLatency
+		}
+		total += sg.SubgraphLatency
 	}
+	return min, max, total
+}
 
-	fmt.Printf("   ✓ Created DOT file: %s\n", dotFile)
+// latencyHeatColor returns a DOT color code for lat, interpolated linearly
+// from green at min to red at max. Equal min and max give green.
+func latencyHeatColor(lat, min, max float64) string {
+	f := 0.0
+	if max > min {
+		f = (lat - min) / (max - min)
+	}
+	if f < 0 {
+		f = 0
+	} else if f > 1 {
+		f = 1
+	}
+	lerp := func(from, to int) int {
+		return from + int(math.Round(float64(to-from)*f))
+	}
+	// lightgreen #90ee90 to a light red #ff6060, so op labels stay readable
+	return fmt.Sprintf("#%02x%02x%02x", lerp(0x90, 0xff), lerp(0xee, 0x60), lerp(0x90, 0x60))
+}
 
-	// Render to PNG
-	if err := renderDotToPNG(dotFile, pngFile); err != nil {
-		fmt.Printf("   ⚠ Could not render PNG: %v\n", err)
-		fmt.Printf("   → You can view the DOT file at: https://dreampuf.github.io/GraphvizOnline/\n")
+// VisualizeSolution shows the execution schedule with subgraph boundaries.
+// Like VisualizeProblem, a failed render is a *RenderError.
+func VisualizeSolution(p *Problem, sol *Solution, dotFile, pngFile string) error {
+	if err := writeDOTFile(dotFile, GenerateSolutionDOT(p, sol)); err != nil {
 		return err
 	}
-
-	return nil
+	return renderOrReport(dotFile, pngFile)
 }
 
 // VisualizeExecutionTimeline creates a horizontal timeline showing when each
-// subgraph executes and how long it takes.
+// subgraph executes and how long it takes. Like VisualizeProblem, a failed
+// render is a *RenderError.
 func VisualizeExecutionTimeline(sol *Solution, dotFile, pngFile string) error {
 	var sb strings.Builder
 	sb.WriteString("digraph Timeline {\n")
@@ -302,17 +363,35 @@ func VisualizeExecutionTimeline(sol *Solution, dotFile, pngFile string) error {
 
 	sb.WriteString("}\n")
 
-	if err := os.WriteFile(dotFile, []byte(sb.String()), 0644); err != nil {
-		return fmt.Errorf("writing DOT file: %w", err)
-	}
-
-	fmt.Printf("   ✓ Created DOT file: %s\n", dotFile)
-
-	if err := renderDotToPNG(dotFile, pngFile); err != nil {
-		fmt.Printf("   ⚠ Could not render PNG: %v\n", err)
-		fmt.Printf("   → You can view the DOT file at: https://dreampuf.github.io/GraphvizOnline/\n")
+	if err := writeDOTFile(dotFile, sb.String()); err != nil {
 		return err
 	}
+	return renderOrReport(dotFile, pngFile)
+}
 
-	return nil
+// VisualizeAll writes dag, solution and timeline DOT files into dir and
+// renders each as PNG. A failed render does not stop the batch: every DOT
+// file is still written and the failures come back as renderFailures. err
+// is set only if a DOT file cannot be written.
+func VisualizeAll(p *Problem, sol *Solution, dir string) (renderFailures []error, err error) {
+	steps := []struct {
+		name      string
+		visualize func(dotFile, pngFile string) error
+	}{
+		{"dag", func(dotFile, pngFile string) error { return VisualizeProblem(p, dotFile, pngFile) }},
+		{"solution", func(dotFile, pngFile string) error { return VisualizeSolution(p, sol, dotFile, pngFile) }},
+		{"timeline", func(dotFile, pngFile string) error { return VisualizeExecutionTimeline(sol, dotFile, pngFile) }},
+	}
+	for _, step := range steps {
+		dotFile := filepath.Join(dir, step.name+".dot")
+		pngFile := filepath.Join(dir, step.name+".png")
+		if err := step.visualize(dotFile, pngFile); err != nil {
+			var renderErr *RenderError
+			if !errors.As(err, &renderErr) {
+				return renderFailures, err
+			}
+			renderFailures = append(renderFailures, err)
+		}
+	}
+	return renderFailures, nil
 }
@@ -27,16 +27,8 @@ func mainVisualize() {
 	fmt.Printf("=== Problem Visualization ===\n")
 	fmt.Printf("Tensors: %d, Ops: %d\n", len(problem.Tensors), len(problem.Ops))
 
-	// 1. Visualize the original DAG
-	fmt.Println("\n1. Generating DAG visualization...")
-	if err := VisualizeProblem(problem, "dag.dot", "dag.png"); err != nil {
-		fmt.Fprintf(os.Stderr, "Error visualizing problem: %v\n", err)
-	} else {
-		fmt.Println("   ✓ Saved: dag.png")
-	}
-
-	// 2. Solve with baseline
-	fmt.Println("\n2. Running baseline solver...")
+	// 1. Solve with baseline
+	fmt.Println("\n1. Running baseline solver...")
 	solution := SolveBaseline(problem)
 
 	totalLat, err := EvaluateSolution(problem, solution)
@@ -46,27 +38,28 @@ func mainVisualize() {
 		fmt.Printf("   ✓ Total latency: %.1f\n", totalLat)
 	}
 
-	// 3. Visualize the solution (with subgraph clusters)
-	fmt.Println("\n3. Generating solution visualization...")
-	if err := VisualizeSolution(problem, solution, "solution.dot", "solution.png"); err != nil {
-		fmt.Fprintf(os.Stderr, "Error visualizing solution: %v\n", err)
-	} else {
-		fmt.Println("   ✓ Saved: solution.png")
-	}
-
-	// 4. Visualize execution timeline
-	fmt.Println("\n4. Generating execution timeline...")
-	if err := VisualizeExecutionTimeline(solution, "timeline.dot", "timeline.png"); err != nil {
-		fmt.Fprintf(os.Stderr, "Error visualizing timeline: %v\n", err)
-	} else {
-		fmt.Println("   ✓ Saved: timeline.png")
+	// 2. Visualize the DAG, the solution (with subgraph clusters) and the
+	// execution timeline. Missing Graphviz only costs the PNGs.
+	fmt.Println("\n2. Generating visualizations...")
+	renderFailures, err := VisualizeAll(problem, solution, ".")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error visualizing: %v\n", err)
+		os.Exit(1)
 	}
 
 	fmt.Println("\n=== Summary ===")
 	fmt.Printf("Total subgraphs: %d\n", len(solution.Subgraphs))
 	fmt.Printf("Total latency: %.1f\n", totalLat)
 	fmt.Println("\nGenerated files:")
-	fmt.Println("  - dag.png       (original computation graph)")
-	fmt.Println("  - solution.png  (solution with subgraph clusters)")
-	fmt.Println("  - timeline.png  (execution timeline)")
+	fmt.Println("  - dag.dot       (original computation graph)")
+	fmt.Println("  - solution.dot  (solution with subgraph clusters)")
+	fmt.Println("  - timeline.dot  (execution timeline)")
+	if len(renderFailures) == 0 {
+		fmt.Println("  - and a .png of each")
+		return
+	}
+	fmt.Printf("\n%d PNGs could not be rendered:\n", len(renderFailures))
+	for _, err := range renderFailures {
+		fmt.Printf("  - %v\n", err)
+	}
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateProblemDOT(t *testing.T) {
+	// T0 @ T1 -> T2, then a pointwise op T2 -> T3
+	p := &Problem{
+		Tensors: []Tensor{{Width: 64, Height: 32}, {Width: 16, Height: 64}, {Width: 16, Height: 32}, {Width: 16, Height: 32}},
+		Ops: []Op{
+			{OpType: "MatMul", Inputs: []int{0, 1}, Outputs: []int{2}, BaseCost: 100},
+			{OpType: "Pointwise", Inputs: []int{2}, Outputs: []int{3}, BaseCost: 10},
+		},
+	}
+	dot := GenerateProblemDOT(p)
+	for _, tc := range []struct{ name, want string }{
+		{"header", "digraph DAG {"},
+		{"input tensor", `T0 [label="Tensor[0]\n64x32\n(input)", fillcolor="lightgreen"`},
+		{"intermediate tensor", `T2 [label="Tensor[2]\n16x32", fillcolor="white"`},
+		{"output tensor", `T3 [label="Tensor[3]\n16x32\n(output)", fillcolor="lightblue"`},
+		{"matmul node", `Op0 [label="Op[0]\nMatMul\ncost=100"`},
+		{"pointwise node", `Op1 [label="Op[1]\nPointwise\ncost=10"`},
+		{"lhs edge", `T0 -> Op0 [label="LHS"];`},
+		{"rhs edge", `T1 -> Op0 [label="RHS"];`},
+		{"pointwise edge", "T2 -> Op1 ;"},
+		{"output edges", "Op0 -> T2;\n  Op1 -> T3;"},
+	} {
+		if !strings.Contains(dot, tc.want) {
+			t.Errorf("%s: DOT lacks %q:\n%s", tc.name, tc.want, dot)
+		}
+	}
+
+	// WriteDOT writes exactly the generated text and runs nothing
+	dotFile := filepath.Join(t.TempDir(), "dag.dot")
+	if err := WriteDOT(p, dotFile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(dotFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != dot {
+		t.Errorf("WriteDOT wrote %q, want %q", data, dot)
+	}
+}